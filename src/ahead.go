@@ -7,15 +7,18 @@ import (
 )
 
 // compile to exe
-func AheadCompile(File *File) *ir.Module {
+func AheadCompile(File *File, Options *Options) *ir.Module {
 	start := time.Now()
-	compiler := &Compiler{File: File}
+	compiler := &Compiler{File: File, Options: Options}
 	tokens := Lex(compiler)
 	tokens = ProcessDirectives(compiler, tokens)
 	ast := Parse(compiler, tokens)
+	ast = Resolve(compiler, ast)
 	ast = Check(compiler, ast)
+	compiler.StopOnErrors()
 	optimized := Optimize(compiler, ast)
 	result := Generate(compiler, optimized)
+	compiler.Flush()
 	end := time.Since(start)
 	Log("compilation took ", end.Seconds(), "seconds")
 	return result
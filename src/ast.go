@@ -9,12 +9,17 @@ type Visitor interface {
 	VisitForAST(ForAST *ForAST) interface{}
 	VisitIfAST(IfAST *IfAST) interface{}
 	VisitStructAST(StructAST *StructAST) interface{}
+	VisitUnionAST(UnionAST *UnionAST) interface{}
+	VisitInterfaceAST(InterfaceAST *InterfaceAST) interface{}
+	VisitMatchAST(MatchAST *MatchAST) interface{}
 	VisitFnAST(FnAST *FnAST) interface{}
 	VisitVarDefAST(VarDefAST *VarDefAST) interface{}
 	VisitBlockAST(BlockAST *BlockAST) interface{}
 	VisitExprSmtAST(ExprStmtAST *ExprStmtAST) interface{}
 	VisitStructSetAST(StructSetAST *StructSetAST) interface{}
 	VisitVarSetAST(VarSetAST *VarSetAST) interface{}
+	VisitIndexSetAST(IndexSetAST *IndexSetAST) interface{}
+	VisitFieldsAST(FieldsAST *FieldsAST) interface{}
 	// expressions
 	VisitLiteralAST(LiteralAST *LiteralAST) interface{}
 	VisitListAST(ListAST *ListAST) interface{}
@@ -24,16 +29,40 @@ type Visitor interface {
 	VisitConnectiveAST(ConnectiveAST *ConnectiveAST) interface{}
 	VisitCallAST(CallAST *CallAST) interface{}
 	VisitStructGetAST(StructGet *StructGetAST) interface{}
+	VisitStructLitAST(StructLitAST *StructLitAST) interface{}
 	VisitGroupAST(GroupAST *GroupAST) interface{}
+	VisitIndexAST(IndexAST *IndexAST) interface{}
+	VisitClosureAST(ClosureAST *ClosureAST) interface{}
+	VisitTypeOfAST(TypeOfAST *TypeOfAST) interface{}
+	VisitRunAST(RunAST *RunAST) interface{}
 }
 
 type AST interface {
 	Visit(Visitor Visitor) interface{}
+	Span() Span
+	SetSpan(span Span)
+}
+
+// embedded in every AST node to store the range of source it was parsed from
+type Node struct {
+	Range Span
+}
+
+func (Node *Node) Span() Span {
+	return Node.Range
+}
+
+func (Node *Node) SetSpan(span Span) {
+	Node.Range = span
 }
 
 // statements
 type RootAST struct {
+	Node
 	Statements []AST
+	SymTable   *SymTable // the global scope, built by the resolver
+	// the number of symbols the resolver declared, instances of generic functions declared later continue from it
+	Symbols uint32
 }
 
 func (RootAST *RootAST) Visit(Visitor Visitor) interface{} {
@@ -41,8 +70,11 @@ func (RootAST *RootAST) Visit(Visitor Visitor) interface{} {
 }
 
 type CastAST struct {
+	Node
 	TavType TavType
 	Expr    AST
+	Checked bool // a downcast of an any e.g. x.(i32), which fails at runtime if it holds another type
+	Escapes bool // set by the checker if the box made by a cast to any can outlive the function
 }
 
 func (CastAST *CastAST) Visit(Visitor Visitor) interface{} {
@@ -50,6 +82,7 @@ func (CastAST *CastAST) Visit(Visitor Visitor) interface{} {
 }
 
 type ReturnAST struct {
+	Node
 	Value AST
 }
 
@@ -57,13 +90,16 @@ func (ReturnAST *ReturnAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitReturnAST(ReturnAST)
 }
 
-type BreakAST struct{}
+type BreakAST struct {
+	Node
+}
 
 func (BreakAST *BreakAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitBreakAST(BreakAST)
 }
 
-type ForAST struct{
+type ForAST struct {
+	Node
 	Condition AST
 	Body      AST
 }
@@ -73,15 +109,29 @@ func (ForAST *ForAST) Visit(Visitor Visitor) interface{} {
 }
 
 type VarSetAST struct {
+	Node
 	Identifier *Token
 	Value      AST
+	Symbol     *Symbol // the variable being assigned, linked by the resolver
 }
 
 func (VarSetAST *VarSetAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitVarSetAST(VarSetAST)
 }
 
+type IndexSetAST struct {
+	Node
+	Array AST
+	Index AST
+	Value AST
+}
+
+func (IndexSetAST *IndexSetAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitIndexSetAST(IndexSetAST)
+}
+
 type IfAST struct {
+	Node
 	IfCondition AST
 	IfBody      AST
 
@@ -96,21 +146,100 @@ func (IfAST *IfAST) Visit(Visitor Visitor) interface{} {
 }
 
 type StructAST struct {
+	Node
 	Identifier *Token
 	Fields     []*VarDefAST
 	Packed     bool
+	Implements []*Token // the interfaces the struct is declared to implement e.g. Circle : struct (Shape) {...}
+	Generic    *Generic // set if the struct has type paramaters e.g. Box : struct ($T) {...}
+	Made       *Note    // for an instance of a generic struct, where it was first used
+	Symbol     *Symbol
 }
 
 func (StructAST *StructAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitStructAST(StructAST)
 }
 
+type UnionAST struct {
+	Node
+	Identifier *Token
+	Variants   []*VarDefAST // each variant is a named payload, the tag is its index
+	Symbol     *Symbol
+}
+
+func (UnionAST *UnionAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitUnionAST(UnionAST)
+}
+
+// the methods a struct needs to be used as the interface, without the paramater for the struct itself
+type InterfaceAST struct {
+	Node
+	Identifier *Token
+	Methods    []*FnAST // prototypes e.g. area : fn f32 ();
+	Symbol     *Symbol
+}
+
+func (InterfaceAST *InterfaceAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitInterfaceAST(InterfaceAST)
+}
+
+// a type paramater of a generic decleration e.g. $T, or $T/Shape if its type argument must implement Shape
+type TypeParam struct {
+	Name       *Token
+	Constraint *Token // nil if any type can be used
+}
+
+// a generic function or struct is only checked and generated through its instances, each instance is
+// parsed again from the tokens of the decleration with the type paramaters replaced e.g. max[i32]
+type Generic struct {
+	Params   []*TypeParam // in the order they are first used
+	Tokens   []*Token
+	SymTable *SymTable // the global scope of the parser, so the instance sees the same declerations
+	Methods  []*FnAST  // the methods of a generic struct, they are instantiated with each instance of it
+}
+
+// returns true if a top level decleration has type paramaters, it is only checked and generated through its instances
+func IsGenericDecl(statement AST) bool {
+	switch statement := statement.(type) {
+	case *FnAST:
+		return statement.Generic != nil
+	case *StructAST:
+		return statement.Generic != nil
+	}
+	return false
+}
+
+// a single arm of a match statement e.g. case Circle(r) {...}
+type MatchCase struct {
+	Variant *Token
+	Binding *Token // optional, nil if the payload isn't bound
+	Body    AST
+	Symbol  *Symbol // the symbol of the binding
+}
+
+type MatchAST struct {
+	Node
+	Value    AST
+	Cases    []*MatchCase
+	ElseBody AST // optional catch all, nil if every variant must be matched
+}
+
+func (MatchAST *MatchAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitMatchAST(MatchAST)
+}
+
 type FnAST struct {
+	Node
 	Identifier *Token
 	Params     []VarDefAST // the paramaters is an array of definitions
 	Body       []AST
 	RetType    TavType
 	Variadic   bool
+	Proto      bool // declared without a body e.g. puts : fn i32 (s : string); the definition is linked in
+	Receiver   *Token // the struct a method belongs to e.g. Vec2 in Vec2.len, nil for functions and the methods of interfaces
+	Generic    *Generic // set if the function has type paramaters e.g. max : fn $T (a : $T, b : $T) {...}
+	Made       *Note    // for an instance of a generic function or method, where it was first used
+	Symbol     *Symbol
 }
 
 func (FnAST *FnAST) Visit(Visitor Visitor) interface{} {
@@ -118,9 +247,14 @@ func (FnAST *FnAST) Visit(Visitor Visitor) interface{} {
 }
 
 type VarDefAST struct {
+	Node
 	Identifier *Token
 	Type       TavType
 	Assignment AST
+	Constant   bool // declared with '::', the assignment is folded at compile time
+	Uninit     bool // declared with '= ---', the variable is left uninitialised
+	Inferred   bool // declared with ':=', the type is inferred from the assignment by the checker
+	Symbol     *Symbol
 }
 
 func (VarDefAST *VarDefAST) Visit(Visitor Visitor) interface{} {
@@ -128,6 +262,7 @@ func (VarDefAST *VarDefAST) Visit(Visitor Visitor) interface{} {
 }
 
 type BlockAST struct {
+	Node
 	Statements []AST
 }
 
@@ -135,7 +270,26 @@ func (BlockAST *BlockAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitBlockAST(BlockAST)
 }
 
+// a loop over the fields of a struct e.g. #for v.f : Vec2 {...}, unrolled by the resolver. the body is parsed
+// again from its tokens for each field, with f in v.f replaced by the name of the field, so v.f is that
+// field of v, anywhere else f is the field's TypeField
+type FieldsAST struct {
+	Node
+	Root       *Token // v in #for v.f : Vec2, nil if the body only uses the TypeField
+	Identifier *Token
+	Type       TavType
+	Tokens     []*Token
+	SymTable   *SymTable
+	Subst      map[string]TavType // the type arguments if the loop is in an instance of a generic function
+	Unrolled   *BlockAST          // set by the resolver, a block per field
+}
+
+func (FieldsAST *FieldsAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitFieldsAST(FieldsAST)
+}
+
 type ExprStmtAST struct {
+	Node
 	Expression AST
 }
 
@@ -144,22 +298,32 @@ func (ExprStmtAST *ExprStmtAST) Visit(Visitor Visitor) interface{} {
 }
 
 type LiteralAST struct {
-	Type  TavType
-	Value TavValue
+	Node
+	Type    TavType
+	Value   TavValue
+	Untyped bool // number literals without a suffix adopt the type their context expects
+	// an untyped integer keeps its exact value as a magnitude and a sign until it is given a type, so it can
+	// be anything from -max u64 to max u64. Value.Int holds the same value wrapped around to 64 bits
+	Magnitude uint64
+	Negative  bool
 }
 
 func (LiteralAST *LiteralAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitLiteralAST(LiteralAST)
 }
 
-type ListAST struct{}
+type ListAST struct {
+	Node
+}
 
 func (ListAST *ListAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitListAST(ListAST)
 }
 
 type VariableAST struct {
+	Node
 	Identifier *Token
+	Symbol     *Symbol // the decleration the name refers to, linked by the resolver
 }
 
 func (VariableAST *VariableAST) Visit(Visitor Visitor) interface{} {
@@ -167,6 +331,7 @@ func (VariableAST *VariableAST) Visit(Visitor Visitor) interface{} {
 }
 
 type UnaryAST struct {
+	Node
 	Operator *Token
 	Right    AST
 }
@@ -176,6 +341,7 @@ func (UnaryAST *UnaryAST) Visit(Visitor Visitor) interface{} {
 }
 
 type BinaryAST struct {
+	Node
 	Left     AST
 	Operator *Token
 	Right    AST
@@ -186,6 +352,7 @@ func (BinaryAST *BinaryAST) Visit(Visitor Visitor) interface{} {
 }
 
 type ConnectiveAST struct {
+	Node
 	Left     AST
 	Operator *Token
 	Right    AST
@@ -196,8 +363,12 @@ func (ConnectiveAST *ConnectiveAST) Visit(Visitor Visitor) interface{} {
 }
 
 type CallAST struct {
-	Caller AST
-	Args   []AST
+	Node
+	Caller   AST
+	Args     []AST
+	Implicit bool // a function without paramaters named without parentheses e.g. main
+	// an implicit call where a function is expected, so the function itself is the value
+	Reference bool
 }
 
 func (CallAST *CallAST) Visit(Visitor Visitor) interface{} {
@@ -205,16 +376,32 @@ func (CallAST *CallAST) Visit(Visitor Visitor) interface{} {
 }
 
 type StructGetAST struct {
+	Node
 	Struct AST
 	Member *Token
 	Deref  bool
+	Method *Symbol // set by the checker if the member is a method that is being called e.g. v.len()
 }
 
 func (StructGetAST *StructGetAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitStructGetAST(StructGetAST)
 }
 
+// a struct literal e.g. Vec2{1, 2} or Vec2{x = 1, y = 2}
+type StructLitAST struct {
+	Node
+	Identifier *Token
+	Fields     []*Token // the named fields, nil if the values are positional
+	Values     []AST
+	Args       []TavType // the type arguments of an instance of a generic struct e.g. Box[i32]{1}
+}
+
+func (StructLitAST *StructLitAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitStructLitAST(StructLitAST)
+}
+
 type StructSetAST struct {
+	Node
 	Struct AST
 	Member *Token
 	Value  AST
@@ -226,9 +413,55 @@ func (StructSetAST *StructSetAST) Visit(Visitor Visitor) interface{} {
 }
 
 type GroupAST struct {
+	Node
 	Group AST
 }
 
 func (GroupAST *GroupAST) Visit(Visitor Visitor) interface{} {
 	return Visitor.VisitGroupAST(GroupAST)
 }
+
+type IndexAST struct {
+	Node
+	Array AST
+	Index AST
+}
+
+func (IndexAST *IndexAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitIndexAST(IndexAST)
+}
+
+// an anonymous function used as an expression e.g. fn i32 (x : i32) { ret x * 2; }
+type ClosureAST struct {
+	Node
+	Fn       *FnAST
+	Captures []*Symbol // the variables of enclosing functions it uses, found by the resolver
+	Escapes  bool      // set by the checker if it can outlive the function that creates it
+}
+
+func (ClosureAST *ClosureAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitClosureAST(ClosureAST)
+}
+
+// the TypeInfo of a type e.g. type_of(Vec2), or of the value of an expression e.g. type_of(x).
+// the TypeInfo of an any is the type of the value it holds
+type TypeOfAST struct {
+	Node
+	Type  *TavType // nil if the argument is an expression
+	Value AST
+}
+
+func (TypeOfAST *TypeOfAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitTypeOfAST(TypeOfAST)
+}
+
+// an expression evaluated at compile time e.g. #run #type_info(Vec2).size, the checker folds it into a literal
+type RunAST struct {
+	Node
+	Expr  AST
+	Value *LiteralAST // set by the checker
+}
+
+func (RunAST *RunAST) Visit(Visitor Visitor) interface{} {
+	return Visitor.VisitRunAST(RunAST)
+}
@@ -21,7 +21,8 @@ const (
 
 func BuildExe(filename string, module *ir.Module) uint8 {
 	ioutil.WriteFile(TAV_OUT+filename+".ll", []byte(module.String()), 0644)
-	c := exec.Command("llc", TAV_OUT+filename+".ll")
+	// gcc links position independent executables by default, so the code must be position independent too
+	c := exec.Command("llc", "-relocation-model=pic", TAV_OUT+filename+".ll")
 	err := c.Run()
 	Log("llc err",err)
 	c = exec.Command("gcc", "-c", TAV_OUT+filename+".s", "-o", TAV_OUT+filename+".o")
@@ -1,35 +1,31 @@
 package src
 
-const (
-	ERR_REDECLARED          = 0x0
-	ERR_INVALID_RETURN_TYPE = 0x1
-	ERR_NO_VAR              = 0x2
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 // implements Visitor
 type Checker struct {
 	Compiler *Compiler
-	// used for scope checking
+	// the global scope built by the resolver, used to look up types
 	SymTable *SymTable
 	Reporter *Reporter
 	Root     *RootAST
-}
-
-func (Checker *Checker) PrintfProto() {
-	retType := NewTavType(TYPE_I32, "", 0, nil)
-	Checker.SymTable.Add("printf", NewTavType(TYPE_FN, "", 0, &retType), nil)
-}
-
-func (Checker *Checker) PutsProto() {
-	retType := NewTavType(TYPE_I32, "", 0, nil)
-	Checker.SymTable.Add("puts", NewTavType(TYPE_FN, "", 0, &retType), nil)
+	Fn       *FnAST // the function being checked
+	Loops    int    // how many loops the statement being checked is nested in
+	// variables that might not have been assigned yet at the statement being checked
+	Unassigned map[*Symbol]bool
+	// the unassigned variables at each break out of the loop being checked
+	Breaking []map[*Symbol]bool
 }
 
 func Check(compiler *Compiler, RootAST *RootAST) *RootAST {
 	reporter := NewReporter(compiler.File.Filename, compiler.File.Source)
 	checker := Checker{
 		Compiler: compiler,
-		SymTable: NewSymTable(),
+		SymTable: RootAST.SymTable,
 		Reporter: reporter,
 		Root:     RootAST,
 	}
@@ -42,140 +38,686 @@ func (checker *Checker) Run() {
 }
 
 func (checker *Checker) VisitRootAST(RootAST *RootAST) interface{} {
-	checker.PrintfProto()
-	checker.PutsProto()
+	// types and globals are checked before any function, so the defaults and inferred types they
+	// use are known wherever they are declared
 	for _, statement := range RootAST.Statements {
-		statement.Visit(checker)
+		switch statement := statement.(type) {
+		case *VarDefAST:
+			checker.Global(statement)
+		case *StructAST, *UnionAST, *InterfaceAST:
+			statement.Visit(checker)
+		case *FnAST:
+			checker.Signature(statement)
+		}
 	}
+	for _, statement := range RootAST.Statements {
+		switch statement.(type) {
+		case *VarDefAST, *StructAST, *UnionAST, *InterfaceAST:
+		default:
+			statement.Visit(checker)
+		}
+	}
+	Escape(RootAST)
 	return nil
 }
 
+// check a global variable, globals live in the data section so they must have a constant initialiser
+func (checker *Checker) Global(VarDefAST *VarDefAST) {
+	checker.Reporter.Mark(VarDefAST.Identifier.Span)
+	if VarDefAST.Constant || VarDefAST.Assignment == nil {
+		checker.Variable(VarDefAST)
+		return
+	}
+	if lit, ok := VarDefAST.Assignment.(*StructLitAST); ok {
+		lit.Visit(checker)
+		// fold each of the values so the generator can emit a constant struct
+		for i, val := range lit.Values {
+			folded, ok := Fold(val, checker.SymTable)
+			if !ok {
+				checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "global '"+VarDefAST.Identifier.Lexme()+"' must have a constant initialiser")
+			}
+			lit.Values[i] = folded
+		}
+	} else if !checker.Function(VarDefAST.Type, VarDefAST.Assignment) {
+		folded, ok := Fold(VarDefAST.Assignment, checker.SymTable)
+		if !ok {
+			checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "global '"+VarDefAST.Identifier.Lexme()+"' must have a constant initialiser")
+		}
+		VarDefAST.Assignment = folded
+	}
+	checker.Variable(VarDefAST)
+}
+
+// check if an expression names a function, whose address is a constant once the program is linked e.g.
+// saved : fn i32 () = zero;
+func (checker *Checker) Function(tavType TavType, expression AST) bool {
+	// a function without paramaters is only the value where a function is expected
+	if call, ok := expression.(*CallAST); ok && call.Implicit && tavType.Type == TYPE_FN && tavType.Indirection == 0 {
+		expression = call.Caller
+	}
+	v, ok := expression.(*VariableAST)
+	return ok && v.Symbol != nil && v.Symbol.Kind == SYMBOL_FN
+}
+
 func (checker *Checker) VisitCastAST(CastAST *CastAST) interface{} {
+	checker.Length(&CastAST.TavType)
 	CastAST.Expr.Visit(checker)
+	from, to := InferType(CastAST.Expr, checker.SymTable), CastAST.TavType
+	checker.At(CastAST)
+	switch {
+	case CastAST.Checked && !from.IsAny():
+		checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "can only downcast an any", Note{Message: "found " + from.String()})
+	case CastAST.Checked && (to.IsAny() || (to.Type == TYPE_VOID && to.Indirection == 0)):
+		checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "cannot downcast to "+to.String())
+	case to.IsAny() && !from.IsAny():
+		checker.Box(to, CastAST.Expr)
+	// a cast can only take a pointer to the value an any holds, which doesn't check its type
+	case !CastAST.Checked && from.IsAny() && !to.IsAny() && to.Indirection == 0:
+		checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "cannot cast any to "+to.String(),
+			Note{Message: "use x.(" + to.String() + ") to get the value an any holds"})
+	}
 	return nil
 }
 
 func (checker *Checker) VisitVarSetAST(VarSetAST *VarSetAST) interface{} {
-	checker.Reporter.Position = VarSetAST.Identifier.Position
-	if InferType(VarSetAST.Value, checker.SymTable) != checker.SymTable.Get(VarSetAST.Identifier.Lexme()).Type {
-		checker.Compiler.Critical(checker.Reporter, ERR_INVALID_TYPE, "cannot assign type to variable")
+	VarSetAST.Value.Visit(checker)
+	checker.Reporter.Mark(VarSetAST.Identifier.Span)
+	sym := VarSetAST.Symbol
+	checker.Fixed(sym)
+	VarSetAST.Value = checker.Box(sym.Type, VarSetAST.Value)
+	checker.Assignable(sym.Type, VarSetAST.Value, "cannot assign type to variable")
+	delete(checker.Unassigned, sym)
+	return nil
+}
+
+// constants and the TypeField of a #for can't be changed, they are folded wherever a constant is needed.
+// neither can a function, a variable of a function type holds a function that can change
+func (checker *Checker) Fixed(sym *Symbol) {
+	declared := Note{Span: sym.Span, Message: "'" + sym.Identifier + "' is declared here"}
+	if _, ok := sym.Value.(*IndexAST); ok {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "cannot assign to '"+sym.Identifier+"', it is the field of a #for", declared)
+	}
+	if sym.Kind == SYMBOL_CONST {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "cannot assign to constant '"+sym.Identifier+"'", declared)
 	}
+	if sym.Kind == SYMBOL_FN {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "cannot assign to function '"+sym.Identifier+"'", declared,
+			Note{Message: "declare a variable to hold a function e.g. f : " + sym.Type.String() + " = " + sym.Identifier + ";"})
+	}
+}
+
+func (checker *Checker) VisitIndexSetAST(IndexSetAST *IndexSetAST) interface{} {
+	checker.Index(IndexSetAST.Array, IndexSetAST.Index)
+	IndexSetAST.Value.Visit(checker)
+	elem := ElemType(InferType(IndexSetAST.Array, checker.SymTable))
+	IndexSetAST.Value = checker.Box(elem, IndexSetAST.Value)
+	checker.Assignable(elem, IndexSetAST.Value, "cannot assign type to array element")
 	return nil
 }
 
 func (checker *Checker) VisitReturnAST(ReturnAST *ReturnAST) interface{} {
+	retType := checker.Fn.RetType
+	declared := Note{Span: checker.Fn.Identifier.Span, Message: "'" + checker.Fn.Identifier.Lexme() + "' returns " + retType.String()}
+	if ReturnAST.Value == nil {
+		if retType.Type != TYPE_VOID {
+			checker.At(ReturnAST)
+			checker.Compiler.Critical(checker.Reporter, ERR_RETURN_VALUE, "ret is missing a value", declared)
+		}
+		return nil
+	}
 	ReturnAST.Value.Visit(checker)
+	if retType.Type == TYPE_VOID && retType.Indirection == 0 {
+		checker.At(ReturnAST.Value)
+		checker.Compiler.Critical(checker.Reporter, ERR_RETURN_VALUE, "function without a return type can't return a value", Note{Span: checker.Fn.Identifier.Span, Message: "'" + checker.Fn.Identifier.Lexme() + "' returns nothing"})
+	}
+	ReturnAST.Value = checker.Box(retType, ReturnAST.Value)
+	checker.Assignable(retType, ReturnAST.Value, "return types do not match")
 	return nil
 }
 
 func (checker *Checker) VisitBreakAST(BreakAST *BreakAST) interface{} {
+	if checker.Loops == 0 {
+		checker.At(BreakAST)
+		checker.Compiler.Critical(checker.Reporter, ERR_BREAK_OUTSIDE_LOOP, "break outside of a loop")
+	}
+	checker.Breaking = append(checker.Breaking, Copy(checker.Unassigned))
 	return nil
 }
 
 func (checker *Checker) VisitForAST(ForAST *ForAST) interface{} {
+	ForAST.Condition.Visit(checker)
+	checker.Condition(ForAST.Condition, true)
+	before, breaking := checker.Unassigned, checker.Breaking
+	checker.Breaking = nil
+	checker.Loops++
+	checker.Unassigned = Copy(before)
+	ForAST.Body.Visit(checker)
+	checker.Loops--
+	// the body might never run, so the loop doesn't assign anything for the code after it. the
+	// exception is a loop that never ends, which can only be left through one of its breaks
+	checker.Unassigned = before
+	if lit, ok := Fold(ForAST.Condition, checker.SymTable); ok && lit.Type.Type == TYPE_BOOL && lit.Value.Bool {
+		checker.Unassigned = Join(before, checker.Breaking)
+	}
+	checker.Breaking = breaking
 	return nil
 }
 
 func (checker *Checker) VisitIfAST(IfAST *IfAST) interface{} {
+	IfAST.IfCondition.Visit(checker)
+	checker.Condition(IfAST.IfCondition, false)
+	before := checker.Unassigned
+	after := checker.Branch(before, IfAST.IfBody, nil)
+	for i, condition := range IfAST.ElifCondition {
+		condition.Visit(checker)
+		checker.Condition(condition, false)
+		after = checker.Branch(before, IfAST.ElifBody[i], after)
+	}
+	if IfAST.ElseBody != nil {
+		after = checker.Branch(before, IfAST.ElseBody, after)
+	} else {
+		// none of the bodies might run
+		after = append(after, before)
+	}
+	checker.Unassigned = Join(before, after)
 	return nil
 }
 
+// check one path through an if or match, starting with the variables unassigned before it. the
+// variables still unassigned at the end of the path are added to after, unless control never gets there
+func (checker *Checker) Branch(before map[*Symbol]bool, body AST, after []map[*Symbol]bool) []map[*Symbol]bool {
+	checker.Unassigned = Copy(before)
+	body.Visit(checker)
+	unassigned := checker.Unassigned
+	checker.Unassigned = before
+	if checker.Exit(body) {
+		return after
+	}
+	return append(after, unassigned)
+}
+
+// a variable is unassigned after some paths join if it is unassigned at the end of any of them,
+// if none of the paths reach the join the code after it is unreachable and before is kept
+func Join(before map[*Symbol]bool, paths []map[*Symbol]bool) map[*Symbol]bool {
+	if len(paths) == 0 {
+		return before
+	}
+	joined := make(map[*Symbol]bool)
+	for _, path := range paths {
+		for sym := range path {
+			joined[sym] = true
+		}
+	}
+	return joined
+}
+
+func Copy(unassigned map[*Symbol]bool) map[*Symbol]bool {
+	copied := make(map[*Symbol]bool, len(unassigned))
+	for sym := range unassigned {
+		copied[sym] = true
+	}
+	return copied
+}
+
 func (checker *Checker) VisitStructAST(StructAST *StructAST) interface{} {
-	// create a new symbol table for the struct members
-	checker.SymTable.NewScope(StructAST.Identifier.Lexme() + "_members")
-	// create a new symbol table containing the children
+	if StructAST.Generic != nil {
+		return nil
+	}
+	checker.Compiler.Enter(StructAST.Made)
+	defer checker.Compiler.Leave(StructAST.Made)
+	// the value of each member's symbol is its default
 	for _, member := range StructAST.Fields {
-		checker.SymTable.Add(member.Identifier.Lexme(), member.Type, nil)
+		checker.Reporter.Mark(member.Identifier.Span)
+		checker.MemberType(member)
+		if member.Assignment != nil {
+			// defaults are folded into every literal, so they have to be constant
+			checker.Assignable(member.Type, member.Assignment, "default value does not match the type of the member")
+			lit, ok := Fold(member.Assignment, checker.SymTable)
+			if !ok {
+				checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "default value of a struct member must be a constant")
+			}
+			member.Assignment = lit
+			member.Symbol.Value = lit
+		}
 	}
-	checker.SymTable.PopScope()
+	for _, name := range StructAST.Implements {
+		checker.Reporter.Mark(name.Span)
+		iface := checker.SymTable.Get(name.Lexme())
+		if iface == nil || iface.Type.Type != TYPE_INTERFACE {
+			checker.Compiler.Critical(checker.Reporter, ERR_NO_VAR, "interface '"+name.Lexme()+"' doesn't exist")
+		}
+		checker.Implements(StructAST.Symbol, iface)
+	}
+	return nil
+}
 
-	checker.Reporter.Position = StructAST.Identifier.Position
-	// in the old system, we would add the symbol table here as the value
-	// however, in the new system we create a seperate entry for the members
-	// the symbol table currently would now look like this (after the following line)
-	//
-	// identifier_members: type_scope
-	//		- Symbol: x
-	//		- Symbol: y
-	// identifier:		   type_struct
-	checker.SymTable.Add(StructAST.Identifier.Lexme(), NewTavType(TYPE_STRUCT, "", 0, nil), nil)
+// the variants were declared by the resolver, only the lengths of their arrays may be left
+func (checker *Checker) VisitUnionAST(UnionAST *UnionAST) interface{} {
+	for _, variant := range UnionAST.Variants {
+		checker.MemberType(variant)
+	}
 	return nil
 }
 
-func (checker *Checker) VisitFnAST(FnAST *FnAST) interface{} {
-	checker.Reporter.Position = FnAST.Identifier.Position
+// fold the lengths of the arrays in the type of a member, its symbol was declared with the type
+func (checker *Checker) MemberType(member *VarDefAST) {
+	if member.Type.Size != nil {
+		checker.Length(&member.Type)
+		member.Symbol.Type = member.Type
+	}
+}
+
+// the methods were declared by the resolver, there is nothing to check
+func (checker *Checker) VisitInterfaceAST(InterfaceAST *InterfaceAST) interface{} {
+	return nil
+}
+
+// check that a struct has every method of an interface, with the same paramaters and return type.
+// a struct doesn't have to say which interfaces it implements, it is checked wherever it is used as one
+func (checker *Checker) Implements(s *Symbol, iface *Symbol) {
+	if note := Unimplemented(s, iface); note != nil {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_IMPLEMENTED, "'"+s.Identifier+"' does not implement '"+iface.Identifier+"'", *note)
+	}
+}
+
+// find the first method of an interface a struct doesn't implement, the note explains why
+func Unimplemented(s *Symbol, iface *Symbol) *Note {
+	for _, method := range iface.Members.Symbols {
+		impl := s.Members.Names[method.Identifier]
+		if impl == nil || impl.Kind != SYMBOL_FN {
+			return &Note{Span: method.Span, Message: "missing method '" + method.Identifier + "'"}
+		}
+		// a method without paramaters is missing the struct, it is reported here as the struct may be checked first
+		if len(impl.Type.Params) == 0 {
+			return &Note{Span: impl.Span, Message: "the first paramater of '" + impl.Identifier + "' must be " + s.Identifier + " or *" + s.Identifier}
+		}
+		// the struct itself isn't part of the signature
+		t := impl.Type
+		t.Params = t.Params[1:]
+		if !t.Equals(method.Type) {
+			return &Note{Span: impl.Span, Message: "'" + impl.Identifier + "' has type " + t.String() + ", expected " + method.Type.String()}
+		}
+	}
+	return nil
+}
 
-	if checker.SymTable.Get(FnAST.Identifier.Lexme()) != nil {
-		checker.Compiler.Critical(checker.Reporter, ERR_REDECLARED, "function re-declared")
+// check the type argument of a type paramater implements the interface the type paramater is constrained to.
+// the interface itself, a struct that implements it or a pointer to one can be used
+func Constraint(compiler *Compiler, reporter *Reporter, symTable *SymTable, param *TypeParam, arg TavType) {
+	if param.Constraint == nil {
+		return
 	}
-	// add the function name to the symbol table
-	checker.SymTable.Add(FnAST.Identifier.Lexme(), NewTavType(TYPE_FN, "", 0, &FnAST.RetType), nil)
-	// enter a new scope in the symbol table
-	checker.SymTable.NewScope(FnAST.Identifier.Lexme() + "_body")
-	// visit each paramater (they exist within the function scope)
-	for _, param := range FnAST.Params {
-		param.Visit(checker)
+	name := "$" + param.Name.Lexme() + "/" + param.Constraint.Lexme()
+	iface := symTable.Get(param.Constraint.Lexme())
+	if iface == nil || iface.Type.Type != TYPE_INTERFACE {
+		compiler.Critical(reporter, ERR_NO_VAR, "interface '"+param.Constraint.Lexme()+"' doesn't exist",
+			Note{Span: param.Constraint.Span, Message: "required by '" + name + "'"})
 	}
-	for _, stmt := range FnAST.Body {
-		stmt.Visit(checker)
-		switch s := stmt.(type) {
-		case *ReturnAST:
-			t := InferType(s.Value, checker.SymTable)
-			// check if the return value is of the same type
-			if t != FnAST.RetType {
-				checker.Reporter.Position = FnAST.Identifier.Position
-				// cast the value to the return value automatically
-				if !Cast(FnAST.RetType, s.Value) {
-					checker.Compiler.Critical(checker.Reporter, ERR_INVALID_RETURN_TYPE, "return types do not match")
-				}
-				Log("meme")
+	if arg.Type == TYPE_INSTANCE && arg.Length == 0 {
+		if arg.Instance == iface.Identifier && arg.Indirection == 0 {
+			return
+		}
+		if s := symTable.Get(arg.Instance); s != nil && s.Type.Type == TYPE_STRUCT && arg.Indirection <= 1 {
+			if note := Unimplemented(s, iface); note != nil {
+				compiler.Critical(reporter, ERR_NOT_IMPLEMENTED, "'"+s.Identifier+"' does not implement '"+iface.Identifier+"'",
+					*note, Note{Span: param.Constraint.Span, Message: "required by '" + name + "'"})
 			}
+			return
+		}
+	}
+	compiler.Critical(reporter, ERR_NOT_IMPLEMENTED, "'"+arg.String()+"' does not implement '"+iface.Identifier+"'",
+		Note{Span: param.Constraint.Span, Message: "required by '" + name + "'"})
+}
+
+// the symbol of the interface a type is a value of, or nil if it isn't an interface
+func (checker *Checker) Interface(tavType TavType) *Symbol {
+	if tavType.Type != TYPE_INSTANCE || tavType.Indirection != 0 || tavType.Length != 0 {
+		return nil
+	}
+	if sym := checker.SymTable.Get(tavType.Instance); sym != nil && sym.Type.Type == TYPE_INTERFACE {
+		return sym
+	}
+	return nil
+}
+
+func (checker *Checker) VisitMatchAST(MatchAST *MatchAST) interface{} {
+	MatchAST.Value.Visit(checker)
+	t := InferType(MatchAST.Value, checker.SymTable)
+	union := checker.SymTable.Get(t.Instance)
+	if t.Type != TYPE_INSTANCE || t.Indirection != 0 || union == nil || union.Type.Type != TYPE_UNION {
+		checker.At(MatchAST.Value)
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_UNION, "can only match on a union")
+	}
+	matched := make(map[string]bool)
+	// a match is exhaustive, so one of the bodies always runs
+	before := checker.Unassigned
+	var after []map[*Symbol]bool
+	for _, matchCase := range MatchAST.Cases {
+		checker.Reporter.Mark(matchCase.Variant.Span)
+		variant, _ := checker.SymTable.Member(t.Instance, matchCase.Variant.Lexme())
+		if variant == nil {
+			checker.Compiler.Critical(checker.Reporter, ERR_NO_VARIANT, "union '"+t.Instance+"' has no variant '"+matchCase.Variant.Lexme()+"'")
+		}
+		if matched[variant.Identifier] {
+			checker.Compiler.Critical(checker.Reporter, ERR_DUPLICATE_CASE, "variant '"+variant.Identifier+"' is matched more than once")
+		}
+		matched[variant.Identifier] = true
+		// the binding is the payload of the variant
+		if matchCase.Symbol != nil {
+			matchCase.Symbol.Type = variant.Type
+		}
+		after = checker.Branch(before, matchCase.Body, after)
+	}
+	if MatchAST.ElseBody != nil {
+		after = checker.Branch(before, MatchAST.ElseBody, after)
+	}
+	checker.Unassigned = Join(before, after)
+	if MatchAST.ElseBody != nil {
+		return nil
+	}
+	// without an else, every variant must be handled
+	var missing []string
+	for _, variant := range union.Members.Symbols {
+		if !matched[variant.Identifier] {
+			missing = append(missing, variant.Identifier)
+		}
+	}
+	if len(missing) > 0 {
+		// a missing variant is reported at the match value
+		checker.At(MatchAST.Value)
+		checker.Compiler.Critical(checker.Reporter, ERR_NON_EXHAUSTIVE, "match is not exhaustive, missing "+strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (checker *Checker) VisitFnAST(FnAST *FnAST) interface{} {
+	// only the instances of a generic function are checked
+	if FnAST.Generic != nil {
+		return nil
+	}
+	checker.Compiler.Enter(FnAST.Made)
+	defer checker.Compiler.Leave(FnAST.Made)
+	checker.Fn = FnAST
+	checker.Unassigned = make(map[*Symbol]bool)
+	checker.Signature(FnAST)
+	if FnAST.Receiver != nil {
+		checker.Receiver(FnAST)
+	}
+	for i := range FnAST.Params {
+		checker.Variable(&FnAST.Params[i])
+	}
+	checker.Statements(FnAST.Body)
+	if !FnAST.Proto && FnAST.RetType.Type != TYPE_VOID && !checker.Exits(FnAST.Body) {
+		// point at the closing '}'
+		start, end := FnAST.Span().End, FnAST.Span().End
+		start.Offset--
+		checker.Reporter.Mark(Span{Start: start, End: end})
+		checker.Compiler.Critical(checker.Reporter, ERR_MISSING_RETURN, "missing ret at the end of '"+FnAST.Identifier.Lexme()+"'",
+			Note{Span: FnAST.Identifier.Span, Message: "'" + FnAST.Identifier.Lexme() + "' returns " + FnAST.RetType.String()})
+	}
+	return nil
+}
+
+// the first paramater of a method is the struct it is called on, either by value or through a pointer
+func (checker *Checker) Receiver(FnAST *FnAST) {
+	name := FnAST.Receiver.Lexme()
+	checker.Reporter.Mark(FnAST.Identifier.Span)
+	if len(FnAST.Params) > 0 {
+		self := FnAST.Params[0].Type
+		if self.Type == TYPE_INSTANCE && self.Instance == name && self.Indirection <= 1 && self.Length == 0 {
+			return
 		}
+		checker.At(&FnAST.Params[0])
 	}
-	checker.SymTable.PopScope()
+	checker.Compiler.Critical(checker.Reporter, ERR_RECEIVER, "the first paramater of '"+name+"."+FnAST.Identifier.Lexme()+"' must be "+name+" or *"+name)
+}
+
+// a closure is checked like any other function, in the middle of the function that creates it
+func (checker *Checker) VisitClosureAST(ClosureAST *ClosureAST) interface{} {
+	checker.Nested(ClosureAST.Fn)
 	return nil
 }
 
+// check a function found while checking another one e.g. a closure or an instance of a generic function
+func (checker *Checker) Nested(FnAST *FnAST) {
+	fn, loops, unassigned, breaking := checker.Fn, checker.Loops, checker.Unassigned, checker.Breaking
+	checker.Loops, checker.Breaking = 0, nil
+	checker.VisitFnAST(FnAST)
+	checker.Fn, checker.Loops, checker.Unassigned, checker.Breaking = fn, loops, unassigned, breaking
+}
+
+// check if control never reaches the end of a list of statements
+func (checker *Checker) Exits(statements []AST) bool {
+	for _, stmt := range statements {
+		if checker.Exit(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// check if control never reaches the statement after this one, because every path through it ends
+// in a ret or break, or it is a loop that never ends
+func (checker *Checker) Exit(statement AST) bool {
+	switch s := statement.(type) {
+	case *ReturnAST, *BreakAST:
+		return true
+	case *BlockAST:
+		return checker.Exits(s.Statements)
+	case *FieldsAST:
+		return checker.Exit(s.Unrolled)
+	case *IfAST:
+		if s.ElseBody == nil || !checker.Exit(s.IfBody) || !checker.Exit(s.ElseBody) {
+			return false
+		}
+		for _, body := range s.ElifBody {
+			if !checker.Exit(body) {
+				return false
+			}
+		}
+		return true
+	case *MatchAST:
+		// a match without an else is exhaustive, so it exits if every case does
+		for _, matchCase := range s.Cases {
+			if !checker.Exit(matchCase.Body) {
+				return false
+			}
+		}
+		return s.ElseBody == nil || checker.Exit(s.ElseBody)
+	case *ForAST:
+		lit, ok := Fold(s.Condition, checker.SymTable)
+		return ok && lit.Type.Type == TYPE_BOOL && lit.Value.Bool && !Breaks(s.Body)
+	}
+	return false
+}
+
+// check if a loop body contains a break for that loop, breaks in nested loops belong to those loops
+func Breaks(statement AST) bool {
+	switch s := statement.(type) {
+	case *BreakAST:
+		return true
+	case *BlockAST:
+		for _, stmt := range s.Statements {
+			if Breaks(stmt) {
+				return true
+			}
+		}
+	case *IfAST:
+		if Breaks(s.IfBody) || (s.ElseBody != nil && Breaks(s.ElseBody)) {
+			return true
+		}
+		for _, body := range s.ElifBody {
+			if Breaks(body) {
+				return true
+			}
+		}
+	case *MatchAST:
+		if s.ElseBody != nil && Breaks(s.ElseBody) {
+			return true
+		}
+		for _, matchCase := range s.Cases {
+			if Breaks(matchCase.Body) {
+				return true
+			}
+		}
+	case *FieldsAST:
+		// the loop is unrolled, so a break inside it belongs to the loop around it
+		return Breaks(s.Unrolled)
+	}
+	return false
+}
+
+// check a list of statements, warning about the first statement that follows a ret or break
+func (checker *Checker) Statements(statements []AST) {
+	var exit AST
+	for _, stmt := range statements {
+		if exit != nil {
+			checker.At(stmt)
+			checker.Compiler.Lint(checker.Reporter, "unreachable_code", "unreachable statement", Note{Span: exit.Span(), Message: "any code following this is unreachable"})
+			exit = nil
+		}
+		stmt.Visit(checker)
+		if checker.Exit(stmt) {
+			exit = stmt
+		}
+	}
+}
+
+// warn about a condition that is always true. conditions using named constants aren't folded so they
+// can be used to switch code on and off, and 'for true' is allowed as an infinite loop
+func (checker *Checker) Condition(condition AST, loop bool) {
+	lit, ok := Fold(condition, nil)
+	if !ok || lit.Type.Type != TYPE_BOOL || !lit.Value.Bool {
+		return
+	}
+	if _, literal := condition.(*LiteralAST); literal && loop {
+		return
+	}
+	checker.At(condition)
+	checker.Compiler.Lint(checker.Reporter, "constant_condition", "condition is always true")
+}
+
 // visit a variable decleration
 // return nothing
 //	b.NewStore(assignment.(value.Value), v) as this is never used in a return evaulation
 func (checker *Checker) VisitVarDefAST(VarDefAST *VarDefAST) interface{} {
-	checker.Reporter.Position = VarDefAST.Identifier.Position
+	checker.Variable(VarDefAST)
+	return nil
+}
 
-	// only check the local scope, otherwise we can redeclare global variables
-	if checker.SymTable.GetLocal(VarDefAST.Identifier.Lexme()) != nil {
-		checker.Compiler.Critical(checker.Reporter, ERR_REDECLARED, "variable re-declared")
+// check a variable decleration, the resolver has already declared its symbol
+func (checker *Checker) Variable(VarDefAST *VarDefAST) {
+	checker.Reporter.Mark(VarDefAST.Identifier.Span)
+	sym := VarDefAST.Symbol
+	if VarDefAST.Type.Size != nil {
+		checker.Length(&VarDefAST.Type)
+		sym.Type = VarDefAST.Type
+	}
+	if VarDefAST.Constant {
+		if _, ok := VarDefAST.Assignment.(*LiteralAST); !ok {
+			checker.Fold(VarDefAST)
+		}
+		checker.Assignable(VarDefAST.Type, VarDefAST.Assignment, "types do not match")
+		return
 	}
-	// add the define to the symbol table
-	checker.SymTable.Add(VarDefAST.Identifier.Lexme(), VarDefAST.Type, nil)
 	// check if the assigned type was correct
 	if VarDefAST.Assignment != nil {
-		// first infer the type of the variable, and check if it matches the declared type
-		// if it doesn't match, see if we can cast it
-		if t := InferType(VarDefAST.Assignment, checker.SymTable); t != VarDefAST.Type {
-			if !Cast(VarDefAST.Type, VarDefAST.Assignment) {
-				checker.Compiler.Critical(checker.Reporter, ERR_INVALID_TYPE, "types do not match")
-			}
+		VarDefAST.Assignment.Visit(checker)
+		if VarDefAST.Inferred {
+			VarDefAST.Type = InferType(VarDefAST.Assignment, checker.SymTable)
+			sym.Type = VarDefAST.Type
 		}
+		VarDefAST.Assignment = checker.Box(VarDefAST.Type, VarDefAST.Assignment)
+		checker.Assignable(VarDefAST.Type, VarDefAST.Assignment, "types do not match")
+	} else if sym.Kind == SYMBOL_VARIABLE && !VarDefAST.Uninit && !checker.Aggregate(VarDefAST.Type) {
+		checker.Unassigned[sym] = true
 	}
-	return nil
 }
 
-func (checker *Checker) VisitBlockAST(BlockAST *BlockAST) interface{} {
-	checker.SymTable.NewScope("block_body")
-	for _, stmt := range BlockAST.Statements {
-		stmt.Visit(checker)
+// fold a constant the resolver left to the checker, as it gets a member of something e.g. #type_info(T).size
+// or has a #run that calls a function
+func (checker *Checker) Fold(VarDefAST *VarDefAST) {
+	VarDefAST.Assignment.Visit(checker)
+	checker.Reporter.Mark(VarDefAST.Identifier.Span)
+	lit, ok := Fold(VarDefAST.Assignment, checker.SymTable)
+	if !ok {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_CONSTANT, "value of '"+VarDefAST.Identifier.Lexme()+"' must be known at compile time")
+	}
+	VarDefAST.Assignment, VarDefAST.Type = lit, lit.Type
+	VarDefAST.Symbol.Value, VarDefAST.Symbol.Type = lit, lit.Type
+}
+
+// fold the lengths of arrays the resolver left to the checker, as they get a member of something e.g.
+// [#type_info(T).size]u8 or have a #run that calls a function
+func (checker *Checker) Length(t *TavType) {
+	if t.RetType != nil {
+		checker.Length(t.RetType)
+	}
+	for i := range t.Params {
+		checker.Length(&t.Params[i])
+	}
+	for i := range t.Args {
+		checker.Length(&t.Args[i])
+	}
+	if t.Size == nil {
+		return
+	}
+	t.Size.Visit(checker)
+	length, ok := Fold(t.Size, checker.SymTable)
+	if !ok || !length.Type.IsInt() || length.Value.Int <= 0 {
+		checker.At(t.Size)
+		checker.Compiler.Critical(checker.Reporter, ERR_ARRAY_LENGTH, "array length must be a positive constant integer")
+	}
+	t.Length, t.Size = uint64(length.Value.Int), nil
+}
+
+// fold the lengths of the arrays in the signature of a function before any call to it is checked
+func (checker *Checker) Signature(FnAST *FnAST) {
+	if FnAST.Generic != nil {
+		return
+	}
+	checker.Length(&FnAST.RetType)
+	for i := range FnAST.Params {
+		checker.Length(&FnAST.Params[i].Type)
 	}
-	checker.SymTable.PopScope()
+	if FnAST.Symbol != nil {
+		FnAST.Symbol.Type = FnType(FnAST)
+	}
+}
+
+// structs, unions and arrays are assigned a piece at a time, so they always start with their default
+// values and never need to be assigned before they are read. an interface is only ever assigned as a
+// whole, and zeroed it has no vtable to call through
+func (checker *Checker) Aggregate(tavType TavType) bool {
+	return tavType.Length > 0 || (tavType.Type == TYPE_INSTANCE && tavType.Indirection == 0 && checker.Interface(tavType) == nil)
+}
+
+func (checker *Checker) VisitBlockAST(BlockAST *BlockAST) interface{} {
+	checker.Statements(BlockAST.Statements)
 	return nil
 }
 
+func (checker *Checker) VisitFieldsAST(FieldsAST *FieldsAST) interface{} {
+	return FieldsAST.Unrolled.Visit(checker)
+}
+
 func (checker *Checker) VisitExprSmtAST(ExprStmtAST *ExprStmtAST) interface{} {
-	ExprStmtAST.Visit(checker)
+	ExprStmtAST.Expression.Visit(checker)
 	return nil
 }
 
 func (checker *Checker) VisitLiteralAST(LiteralAST *LiteralAST) interface{} {
+	// character literals keep their source characters, they must decode to exactly 1 character
+	if LiteralAST.Type.Type != TYPE_STRING && LiteralAST.Value.String != nil {
+		chars := LiteralAST.Value.String
+		checker.At(LiteralAST)
+		if len(chars) == 0 {
+			checker.Compiler.Critical(checker.Reporter, ERR_INVALID_CHAR, "empty character literal")
+		}
+		if len(chars) > 1 && utf8.RuneCount(chars) != 1 {
+			checker.Compiler.Critical(checker.Reporter, ERR_INVALID_CHAR, "character literal '"+string(chars)+"' has more than 1 character, use \" for strings")
+		}
+	}
 	return nil
 }
 
@@ -184,41 +726,483 @@ func (checker *Checker) VisitListAST(ListAST *ListAST) interface{} {
 }
 
 func (checker *Checker) VisitVariableAST(VariableAST *VariableAST) interface{} {
-	checker.Reporter.Position = VariableAST.Identifier.Position
-	if checker.SymTable.Get(VariableAST.Identifier.Lexme()) == nil {
-		checker.Compiler.Critical(checker.Reporter, ERR_NO_VAR, "variable doesn't exist")
+	checker.Reporter.Mark(VariableAST.Identifier.Span)
+	sym := VariableAST.Symbol
+	if fn, ok := sym.Value.(*FnAST); ok && sym.Kind == SYMBOL_FN && fn.Generic != nil {
+		checker.Compiler.Critical(checker.Reporter, ERR_TYPE_PARAM, "generic function '"+sym.Identifier+"' can only be called",
+			Note{Message: "its type arguments are inferred from the arguments of each call"})
+	}
+	if checker.Unassigned[sym] {
+		checker.Compiler.Critical(checker.Reporter, ERR_UNASSIGNED, "'"+sym.Identifier+"' might be read before it is assigned",
+			Note{Span: sym.Span, Message: "declared here without a value"},
+			Note{Message: "give it a value when it is declared, or use '= ---' if it is always assigned first"})
 	}
 	return nil
 }
 
 func (checker *Checker) VisitUnaryAST(UnaryAST *UnaryAST) interface{} {
+	// taking the address of a variable lets it be assigned through the pointer
+	if variable, ok := UnaryAST.Right.(*VariableAST); ok && UnaryAST.Operator.Type == ADDR {
+		delete(checker.Unassigned, variable.Symbol)
+	}
+	UnaryAST.Right.Visit(checker)
 	return nil
 }
 
 func (checker *Checker) VisitBinaryAST(BinaryAST *BinaryAST) interface{} {
+	BinaryAST.Left.Visit(checker)
+	BinaryAST.Right.Visit(checker)
+	// an untyped constant adopts the type of the other side
+	checker.Reporter.Mark(BinaryAST.Operator.Span)
+	if IsUntyped(BinaryAST.Left) && !IsUntyped(BinaryAST.Right) {
+		checker.Assignable(InferType(BinaryAST.Right, checker.SymTable), BinaryAST.Left, "mismatched types in binary expression")
+	} else if IsUntyped(BinaryAST.Right) && !IsUntyped(BinaryAST.Left) {
+		checker.Assignable(InferType(BinaryAST.Left, checker.SymTable), BinaryAST.Right, "mismatched types in binary expression")
+	}
+	// operands with different number types are converted to the same type
+	left, right := InferType(BinaryAST.Left, checker.SymTable), InferType(BinaryAST.Right, checker.SymTable)
+	// a struct, union or interface can't be an operand, even when a generic function is instanced with one
+	for _, t := range []TavType{left, right} {
+		if (t.Type == TYPE_INSTANCE || t.IsAny()) && t.Indirection == 0 && t.Length == 0 {
+			checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "cannot use '"+TokStrings[BinaryAST.Operator.Type]+"' on "+t.String())
+		}
+	}
+	if !left.Equals(right) && left.IsNumber() && right.IsNumber() {
+		to := JoinInfered(left, right)
+		switch BinaryAST.Operator.Type {
+		case EQUALS, NOT_EQUALS, LESS_THAN, LESS_EQUAL, GREAT_THAN, GREAT_EQUAL:
+			// comparisons don't produce either type, so they compare in the larger one
+			if Narrows(right, left) {
+				to = right
+			}
+		}
+		BinaryAST.Left = checker.Convert(BinaryAST.Left, left, to)
+		BinaryAST.Right = checker.Convert(BinaryAST.Right, right, to)
+	}
 	return nil
 }
 
+// implicitly convert an operand to a type, warning if the conversion loses information
+func (checker *Checker) Convert(operand AST, from TavType, to TavType) AST {
+	if from.Equals(to) {
+		return operand
+	}
+	if Narrows(from, to) {
+		checker.At(operand)
+		checker.Compiler.Lint(checker.Reporter, "narrowing", "implicit narrowing from "+from.String()+" to "+to.String(), Note{Message: "cast with (" + to.String() + ") if this is intended"})
+	}
+	cast := &CastAST{TavType: to, Expr: operand}
+	cast.SetSpan(operand.Span())
+	return cast
+}
+
+// use a value as an any, the value is boxed by a cast that the generator turns into a copy of the value
+// along with its TypeInfo. a struct used as an interface is converted by a cast too, so the escape analysis
+// can tell when the interface outlives the struct
+func (checker *Checker) Box(tavType TavType, expression AST) AST {
+	t := InferType(expression, checker.SymTable)
+	if iface := checker.Interface(tavType); iface != nil && t.Type == TYPE_INSTANCE && t.Indirection == 0 && t.Length == 0 {
+		if sym := checker.SymTable.Get(t.Instance); sym != nil && sym.Type.Type == TYPE_STRUCT {
+			checker.At(expression)
+			checker.Implements(sym, iface)
+			cast := &CastAST{TavType: tavType, Expr: expression}
+			cast.SetSpan(expression.Span())
+			return cast
+		}
+	}
+	if !tavType.IsAny() || t.IsAny() {
+		return expression
+	}
+	checker.At(expression)
+	if (t.Type == TYPE_VOID && t.Indirection == 0) || t.Type == TYPE_NULL {
+		checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "cannot use "+t.String()+" as any")
+	}
+	cast := &CastAST{TavType: tavType, Expr: expression}
+	cast.SetSpan(expression.Span())
+	return cast
+}
+
+// report any errors at a node, underlining it if the parser gave it a span
+func (checker *Checker) At(node AST) {
+	if span := node.Span(); span.Valid() {
+		checker.Reporter.Mark(span)
+	}
+}
+
+// check that an expression can be assigned to a type, untyped constants are cast to the type.
+// constant values are also checked to make sure they fit in the type
+func (checker *Checker) Assignable(tavType TavType, expression AST, msg string) {
+	checker.At(expression)
+	// a function without paramaters named where a function is expected is the value, rather than a call
+	if call, ok := expression.(*CallAST); ok && call.Implicit && tavType.Type == TYPE_FN && tavType.Indirection == 0 {
+		call.Reference = true
+	}
+	// a struct, or a pointer to one, can be used as any interface it implements
+	if iface, t := checker.Interface(tavType), InferType(expression, checker.SymTable); iface != nil && t.Type == TYPE_INSTANCE && t.Indirection <= 1 && t.Length == 0 {
+		if s := checker.SymTable.Get(t.Instance); s != nil && s.Type.Type == TYPE_STRUCT {
+			checker.Implements(s, iface)
+			return
+		}
+	}
+	// an untyped integer is checked against the type before it is cast, while its exact value is known
+	if IsUntyped(expression) && tavType.IsInt() && tavType.IsNumber() {
+		lit, ok := Fold(expression, checker.SymTable)
+		if !ok {
+			checker.Compiler.Critical(checker.Reporter, ERR_OVERFLOW, "constant expression overflows "+tavType.String(),
+				Note{Message: "its value is outside the range of every integer type, or it divides by zero"})
+		}
+		exact := *lit
+		exact.Type = tavType
+		if lit.Type.IsInt() && !Fits(&exact) {
+			checker.Compiler.Critical(checker.Reporter, ERR_OVERFLOW, "constant "+lit.String()+" overflows "+tavType.String())
+		}
+	}
+	if t := InferType(expression, checker.SymTable); !t.Equals(tavType) && !Cast(tavType, expression) {
+		checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, msg, Note{Message: "expected " + tavType.String() + ", found " + t.String()})
+	}
+	if lit, ok := Fold(expression, checker.SymTable); ok && !Fits(lit) {
+		checker.Compiler.Critical(checker.Reporter, ERR_OVERFLOW, "constant "+lit.String()+" overflows "+lit.Type.String())
+	}
+}
+
 func (checker *Checker) VisitConnectiveAST(ConnectiveAST *ConnectiveAST) interface{} {
 	return nil
 }
 
 func (checker *Checker) VisitCallAST(CallAST *CallAST) interface{} {
+	if union, ok := UnionCtor(CallAST, checker.SymTable); ok {
+		return checker.UnionCtor(union, CallAST)
+	}
+	if get, ok := CallAST.Caller.(*StructGetAST); ok {
+		if member, _ := checker.SymTable.Member(InferType(get.Struct, checker.SymTable).Instance, get.Member.Lexme()); member != nil && member.Kind == SYMBOL_FN {
+			return checker.MethodCall(CallAST, get, member)
+		}
+	}
+	for _, arg := range CallAST.Args {
+		arg.Visit(checker)
+	}
+	if caller, ok := CallAST.Caller.(*VariableAST); ok && caller.Symbol.Kind == SYMBOL_FN {
+		if fn, ok := caller.Symbol.Value.(*FnAST); ok && fn.Generic != nil {
+			checker.Generic(CallAST, caller, fn)
+		}
+	}
 	CallAST.Caller.Visit(checker)
+	// functions can be called directly or through a value that holds one
+	t := InferType(CallAST.Caller, checker.SymTable)
+	checker.At(CallAST.Caller)
+	if t.Type != TYPE_FN || t.Indirection != 0 || t.Length != 0 {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_FN, "can only call a function", Note{Message: "found " + t.String()})
+	}
+	name := "function"
+	var fn *FnAST
+	if caller, ok := CallAST.Caller.(*VariableAST); ok {
+		// the builtins don't have a decleration and take anything
+		if caller.Symbol.Kind == SYMBOL_FN && caller.Symbol.Value == nil {
+			return nil
+		}
+		name = "'" + caller.Identifier.Lexme() + "'"
+		fn, _ = caller.Symbol.Value.(*FnAST)
+	}
+	// variadic functions only check their declared paramaters
+	if len(CallAST.Args) < len(t.Params) || (len(CallAST.Args) > len(t.Params) && !t.Variadic) {
+		checker.Compiler.Critical(checker.Reporter, ERR_ARG_COUNT, "wrong number of arguments to "+name,
+			Note{Message: name + " has type " + t.String()})
+	}
+	for i, param := range t.Params {
+		msg := "argument type does not match paramater " + strconv.Itoa(i+1)
+		if fn != nil {
+			msg = "argument type does not match paramater '" + fn.Params[i].Identifier.Lexme() + "'"
+		}
+		CallAST.Args[i] = checker.Box(param, CallAST.Args[i])
+		checker.Assignable(param, CallAST.Args[i], msg)
+		// c only knows how to call a function, not a function value that carries an environment
+		if fn != nil && fn.Proto && param.Type == TYPE_FN && !Named(CallAST.Args[i]) {
+			checker.At(CallAST.Args[i])
+			checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "only a named function can be passed to '"+fn.Identifier.Lexme()+"'",
+				Note{Message: "closures and variables that hold a function can only be called from tav"})
+		}
+	}
+	return nil
+}
+
+// check a call of a generic function, the type arguments are inferred from the arguments and the call
+// is linked to the instance of the function for them
+func (checker *Checker) Generic(CallAST *CallAST, caller *VariableAST, fn *FnAST) {
+	name := "'" + fn.Identifier.Lexme() + "'"
+	if len(CallAST.Args) != len(fn.Params) {
+		checker.At(CallAST)
+		checker.Compiler.Critical(checker.Reporter, ERR_ARG_COUNT, "wrong number of arguments to "+name,
+			Note{Span: fn.Identifier.Span, Message: name + " is declared here"})
+	}
+	args := make(map[string]TavType)
+	// arguments with a type decide first, untyped number literals take the type that gives them
+	for _, untyped := range []bool{false, true} {
+		for i, param := range fn.Params {
+			if IsUntyped(CallAST.Args[i]) == untyped {
+				checker.At(CallAST.Args[i])
+				checker.Infer(param.Type, InferType(CallAST.Args[i], checker.SymTable), args, untyped)
+			}
+		}
+	}
+	var types []TavType
+	for _, param := range fn.Generic.Params {
+		arg, ok := args[param.Name.Lexme()]
+		checker.At(CallAST)
+		if !ok {
+			checker.Compiler.Critical(checker.Reporter, ERR_TYPE_PARAM, "cannot infer '$"+param.Name.Lexme()+"' for "+name,
+				Note{Span: param.Name.Span, Message: "'$" + param.Name.Lexme() + "' isn't used by any paramater"})
+		}
+		Constraint(checker.Compiler, checker.Reporter, checker.SymTable, param, arg)
+		types = append(types, arg)
+	}
+	instance := checker.SymTable.Get(InstanceName(fn.Identifier.Lexme(), types))
+	if instance == nil {
+		instance = checker.Instance(fn.Generic, InstanceName(fn.Identifier.Lexme(), types), args, CallAST.Span())
+	}
+	caller.Symbol = instance
+}
+
+// match the type of a paramater against the type of its argument, binding the type paramaters it uses
+// e.g. *$T given *i32 binds $T to i32. anything that doesn't match is reported when the call is checked
+func (checker *Checker) Infer(param TavType, arg TavType, args map[string]TavType, untyped bool) {
+	switch {
+	case param.Type == TYPE_PARAM:
+		if arg.Type == TYPE_NULL || arg.Indirection < param.Indirection || (param.Length != 0 && param.Length != arg.Length) {
+			return
+		}
+		arg.Indirection -= param.Indirection
+		if param.Length != 0 {
+			arg.Length = 0
+		}
+		bound, ok := args[param.Instance]
+		// an untyped literal takes the type the other arguments decided
+		if ok && untyped {
+			return
+		}
+		if ok && !bound.Equals(arg) {
+			checker.Compiler.Critical(checker.Reporter, ERR_TYPE_PARAM, "conflicting types for '$"+param.Instance+"'",
+				Note{Message: "'$" + param.Instance + "' is " + bound.String() + " from an earlier argument, but " + arg.String() + " here"})
+		}
+		args[param.Instance] = arg
+	case param.Type == TYPE_FN && arg.Type == TYPE_FN && param.RetType != nil && arg.RetType != nil && len(param.Params) == len(arg.Params):
+		checker.Infer(*param.RetType, *arg.RetType, args, untyped)
+		for i := range param.Params {
+			checker.Infer(param.Params[i], arg.Params[i], args, untyped)
+		}
+	// an instance of the same generic struct e.g. Box[$T] given Box[i32]
+	case param.Args != nil && GenericName(param.Instance) == GenericName(arg.Instance) && len(param.Args) == len(arg.Args) && param.Indirection == arg.Indirection:
+		for i := range param.Args {
+			checker.Infer(param.Args[i], arg.Args[i], args, untyped)
+		}
+	}
+}
+
+// parse, resolve and check the instance of a generic function for a set of type arguments, the
+// instance is added to the program so it is generated once however many times it is called
+func (checker *Checker) Instance(generic *Generic, name string, args map[string]TavType, made Span) *Symbol {
+	start := len(checker.Root.Statements)
+	fn := Instantiate(checker.Compiler, generic, name, args).(*FnAST)
+	fn.Made = Made(generic, name, args, made)
+	ResolveInstance(checker.Compiler, checker.Root, fn)
+	// the instance can use instances of generic structs that weren't used before, and their methods
+	for _, statement := range checker.Root.Statements[start:] {
+		if s, ok := statement.(*StructAST); ok {
+			s.Visit(checker)
+		}
+	}
+	for _, statement := range checker.Root.Statements[start:] {
+		if method, ok := statement.(*FnAST); ok && method.Receiver != nil {
+			checker.Nested(method)
+		}
+	}
+	checker.Nested(fn)
+	return fn.Symbol
+}
+
+// check a call of a method e.g. v.len(), the value it is called on is passed as the first paramater.
+// the address of the value is taken or the pointer is dereferenced to match the method
+func (checker *Checker) MethodCall(CallAST *CallAST, get *StructGetAST, method *Symbol) interface{} {
+	get.Struct.Visit(checker)
+	get.Method = method
 	for _, arg := range CallAST.Args {
 		arg.Visit(checker)
 	}
+	fn := method.Value.(*FnAST)
+	name := "'" + get.Member.Lexme() + "'"
+	t := InferType(get.Struct, checker.SymTable)
+	// the methods of an interface are called on the interface, the struct behind it is passed for them
+	self, params := NewTavType(TYPE_INSTANCE, t.Instance, 0, nil), fn.Params
+	if fn.Receiver != nil {
+		self, params = fn.Params[0].Type, fn.Params[1:]
+	}
+	if self.Indirection-t.Indirection > 1 || t.Indirection-self.Indirection > 1 {
+		checker.At(get.Struct)
+		checker.Compiler.Critical(checker.Reporter, ERR_RECEIVER, "cannot call "+name+" on "+t.String(),
+			Note{Message: name + " is called on " + self.String()})
+	}
+	if len(CallAST.Args) != len(params) {
+		checker.At(CallAST)
+		checker.Compiler.Critical(checker.Reporter, ERR_ARG_COUNT, "wrong number of arguments to "+name,
+			Note{Span: method.Span, Message: name + " is declared here"})
+	}
+	for i, param := range params {
+		CallAST.Args[i] = checker.Box(param.Type, CallAST.Args[i])
+		checker.Assignable(param.Type, CallAST.Args[i], "argument type does not match paramater '"+param.Identifier.Lexme()+"'")
+	}
+	return nil
+}
+
+// check if an expression names a function declared with a body or prototype
+func Named(expression AST) bool {
+	return Function(expression) != nil
+}
+
+// get the symbol of the function an expression names, or nil if it isn't the name of a function
+func Function(expression AST) *Symbol {
+	switch e := expression.(type) {
+	case *VariableAST:
+		if _, ok := e.Symbol.Value.(*FnAST); ok && e.Symbol.Kind == SYMBOL_FN {
+			return e.Symbol
+		}
+	case *CallAST:
+		if e.Reference {
+			return Function(e.Caller)
+		}
+	case *GroupAST:
+		return Function(e.Group)
+	}
 	return nil
 }
 
 func (checker *Checker) VisitStructGetAST(StructGet *StructGetAST) interface{} {
+	StructGet.Struct.Visit(checker)
+	checker.Member(StructGet.Struct, StructGet.Member)
 	return InferType(StructGet, checker.SymTable)
 }
 
 func (checker *Checker) VisitStructSetAST(StructSetAST *StructSetAST) interface{} {
+	StructSetAST.Struct.Visit(checker)
+	if v, ok := StructSetAST.Struct.(*VariableAST); ok {
+		checker.Reporter.Mark(v.Identifier.Span)
+		checker.Fixed(v.Symbol)
+	}
+	member := checker.Member(StructSetAST.Struct, StructSetAST.Member)
+	StructSetAST.Value.Visit(checker)
+	checker.Reporter.Mark(StructSetAST.Member.Span)
+	StructSetAST.Value = checker.Box(member.Type, StructSetAST.Value)
+	checker.Assignable(member.Type, StructSetAST.Value, "cannot assign type to member '"+member.Identifier+"'")
+	return nil
+}
+
+func (checker *Checker) VisitStructLitAST(StructLitAST *StructLitAST) interface{} {
+	checker.Reporter.Mark(StructLitAST.Identifier.Span)
+	name := StructLitAST.Identifier.Lexme()
+	if sym := checker.SymTable.Get(name); sym == nil || sym.Type.Type != TYPE_STRUCT {
+		checker.Compiler.Critical(checker.Reporter, ERR_NO_VAR, "struct '"+name+"' doesn't exist")
+	}
+	members := checker.SymTable.Get(name).Fields()
+	if len(StructLitAST.Values) > len(members) {
+		checker.Compiler.Critical(checker.Reporter, ERR_FIELD_COUNT, "too many values in struct literal")
+	}
+	assigned := make(map[string]bool)
+	for i, val := range StructLitAST.Values {
+		val.Visit(checker)
+		// positional values are assigned to the members in the order they were declared
+		member := members[i]
+		if StructLitAST.Fields != nil {
+			field := StructLitAST.Fields[i]
+			checker.Reporter.Mark(field.Span)
+			member, _ = checker.SymTable.Member(name, field.Lexme())
+			if member == nil {
+				checker.Compiler.Critical(checker.Reporter, ERR_NO_MEMBER, "struct '"+name+"' has no member '"+field.Lexme()+"'")
+			}
+			if assigned[member.Identifier] {
+				checker.Compiler.Critical(checker.Reporter, ERR_DUPLICATE_FIELD, "member '"+member.Identifier+"' is assigned more than once")
+			}
+			assigned[member.Identifier] = true
+		}
+		StructLitAST.Values[i] = checker.Box(member.Type, val)
+		checker.Assignable(member.Type, StructLitAST.Values[i], "cannot assign type to member '"+member.Identifier+"'")
+	}
+	return nil
+}
+
+// check that a struct has a member and return it
+func (checker *Checker) Member(Struct AST, Member *Token) *Symbol {
+	checker.Reporter.Mark(Member.Span)
+	instance := InferType(Struct, checker.SymTable).Instance
+	member, _ := checker.SymTable.Member(instance, Member.Lexme())
+	if member == nil {
+		checker.Compiler.Critical(checker.Reporter, ERR_NO_MEMBER, "'"+instance+"' has no member '"+Member.Lexme()+"'")
+	}
+	if member.Kind == SYMBOL_FN {
+		checker.Compiler.Critical(checker.Reporter, ERR_NO_MEMBER, "'"+Member.Lexme()+"' is a method of '"+instance+"', it can only be called")
+	}
+	return member
+}
+
+func (checker *Checker) VisitIndexAST(IndexAST *IndexAST) interface{} {
+	checker.Index(IndexAST.Array, IndexAST.Index)
+	return nil
+}
+
+// check that we are indexing an array or a pointer with an integer, constant indices into an array are bounds checked
+func (checker *Checker) Index(Array AST, Index AST) {
+	Array.Visit(checker)
+	Index.Visit(checker)
+	t := InferType(Array, checker.SymTable)
+	if t.Length == 0 && t.Indirection == 0 {
+		checker.Compiler.Critical(checker.Reporter, ERR_NOT_ARRAY, "can only index an array or a pointer")
+	}
+	if !InferType(Index, checker.SymTable).IsInt() {
+		checker.Compiler.Critical(checker.Reporter, ERR_INDEX_TYPE, "array index must be an integer")
+	}
+	if i, ok := Fold(Index, checker.SymTable); ok && t.Length > 0 && (i.Value.Int < 0 || uint64(i.Value.Int) >= t.Length) {
+		checker.Compiler.Critical(checker.Reporter, ERR_OUT_OF_BOUNDS, "array index out of bounds")
+	}
+}
+
+func (checker *Checker) VisitTypeOfAST(TypeOfAST *TypeOfAST) interface{} {
+	if TypeOfAST.Value == nil {
+		checker.Length(TypeOfAST.Type)
+		return nil
+	}
+	TypeOfAST.Value.Visit(checker)
+	if t := InferType(TypeOfAST.Value, checker.SymTable); t.Type == TYPE_VOID && t.Indirection == 0 {
+		checker.At(TypeOfAST.Value)
+		checker.Compiler.Critical(checker.Reporter, ERR_MISMATCHED_TYPES, "cannot get the type of void")
+	}
+	return nil
+}
+
+// #run is folded if it is constant, otherwise the interpreter evaluates it e.g. when it calls a function
+func (checker *Checker) VisitRunAST(RunAST *RunAST) interface{} {
+	RunAST.Expr.Visit(checker)
+	if lit, ok := Fold(RunAST.Expr, checker.SymTable); ok {
+		RunAST.Value = lit
+		return nil
+	}
+	RunAST.Value = Evaluate(checker.Compiler, checker.SymTable, RunAST)
 	return nil
 }
 
 func (checker *Checker) VisitGroupAST(GroupAST *GroupAST) interface{} {
 	return GroupAST.Group.Visit(checker)
 }
+
+// check the construction of a union variant e.g. Shape.Circle(1.0)
+func (checker *Checker) UnionCtor(union string, CallAST *CallAST) interface{} {
+	member := CallAST.Caller.(*StructGetAST).Member
+	checker.Reporter.Mark(member.Span)
+	variant, _ := checker.SymTable.Member(union, member.Lexme())
+	if variant == nil {
+		checker.Compiler.Critical(checker.Reporter, ERR_NO_VARIANT, "union '"+union+"' has no variant '"+member.Lexme()+"'")
+	}
+	if len(CallAST.Args) != 1 {
+		checker.Compiler.Critical(checker.Reporter, ERR_PAYLOAD_COUNT, "union variant expects exactly 1 payload")
+	}
+	CallAST.Args[0].Visit(checker)
+	CallAST.Args[0] = checker.Box(variant.Type, CallAST.Args[0])
+	checker.Assignable(variant.Type, CallAST.Args[0], "payload type does not match variant '"+variant.Identifier+"'")
+	return nil
+}
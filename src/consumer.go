@@ -1,5 +1,7 @@
 package src
 
+import "unicode/utf8"
+
 type Consumer struct {
 	Compiler *Compiler
 	Reporter *Reporter
@@ -37,13 +39,15 @@ func NewParseConsumer(tokens []*Token, reporter *Reporter, compiler *Compiler) *
 }
 
 func (lexConsumer *LexConsumer) SkipWhitespace() {
-	for lexConsumer.Expect(' ') {
+	for lexConsumer.Expect(' ') || lexConsumer.Expect('\t') {
 		lexConsumer.Advance()
 	}
 }
 
+// decode the utf-8 character at the current position, invalid utf-8 is returned as utf8.RuneError
 func (lexConsumer *LexConsumer) Peek() rune {
-	return rune((*lexConsumer.Source)[lexConsumer.Counter])
+	r, _ := utf8.DecodeRuneInString((*lexConsumer.Source)[lexConsumer.Counter:])
+	return r
 }
 
 func (lexConsumer *LexConsumer) Expect(r rune) bool {
@@ -61,18 +65,29 @@ func (lexConsumer *LexConsumer) Consume(char rune) bool {
 	return false
 }
 
+// consume a utf-8 character, the position is moved to the next line after a \n, \r\n or lone \r
 func (lexConsumer *LexConsumer) Advance() rune {
-	r := (*lexConsumer.Source)[lexConsumer.Counter]
-	lexConsumer.Counter++
-	lexConsumer.Reporter.Position.Indent++
-	return rune(r)
+	r, size := utf8.DecodeRuneInString((*lexConsumer.Source)[lexConsumer.Counter:])
+	lexConsumer.Counter += uint32(size)
+	position := &lexConsumer.Reporter.Position
+	if r == '\n' || (r == '\r' && !lexConsumer.Expect('\n')) {
+		position.Line++
+		position.Indent = 0
+		position.Bytes = 0
+	} else {
+		position.Indent++
+		position.Bytes += uint32(size)
+	}
+	position.Offset = lexConsumer.Counter
+	return r
 }
 
 func (lexConsumer *LexConsumer) AdvanceMul(ammount uint32) rune {
-	r := (*lexConsumer.Source)[lexConsumer.Counter]
-	lexConsumer.Counter += ammount
-	lexConsumer.Reporter.Position.Indent += ammount
-	return rune(r)
+	r := lexConsumer.Advance()
+	for i := uint32(1); i < ammount; i++ {
+		lexConsumer.Advance()
+	}
+	return r
 }
 
 func (lexConsumer *LexConsumer) End() bool {
@@ -126,16 +141,24 @@ func (parseConsumer *ParseConsumer) ConsumeErr(tokenType uint32, errCode uint32,
 func (parseConsumer *ParseConsumer) Advance() *Token {
 	t := parseConsumer.Tokens[parseConsumer.Counter]
 	parseConsumer.Counter++
-	parseConsumer.Reporter.Position = t.Position
+	parseConsumer.Reporter.Mark(t.Span)
 	return t
 }
 
 func (parseConsumer *ParseConsumer) AdvanceMul(ammount uint32) *Token {
 	t := parseConsumer.Tokens[parseConsumer.Counter]
 	parseConsumer.Counter += ammount
-	parseConsumer.Reporter.Position = t.Position
+	parseConsumer.Reporter.Mark(t.Span)
 	return t
 }
+// the last token that was consumed
+func (parseConsumer *ParseConsumer) Previous() *Token {
+	if parseConsumer.Counter == 0 {
+		return nil
+	}
+	return parseConsumer.Tokens[parseConsumer.Counter-1]
+}
+
 func (parseConsumer *ParseConsumer) End() bool {
 	return !(parseConsumer.Counter < uint32(len(parseConsumer.Tokens)))
 }
@@ -0,0 +1,294 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// a label underlines a range of source. the primary label is where the error happened, secondary
+// labels point at related code e.g. where a variable was first declared
+type Label struct {
+	Span    Span
+	Message string
+	Primary bool
+}
+
+// extra information attached to a diagnostic. notes with a span are shown as secondary labels,
+// notes without one are shown as help underneath the snippet
+type Note struct {
+	Span    Span
+	Message string
+}
+
+type Diagnostic struct {
+	Severity uint8
+	Code     uint32
+	Message  string
+	File     string
+	Labels   []Label
+	Help     []string
+}
+
+// create a diagnostic at the current position of the reporter. if the reporter has a span ending at
+// its position the whole span is underlined, otherwise just the character at the position
+func NewDiagnostic(severity uint8, reporter *Reporter, errCode uint32, msg string, notes []Note) *Diagnostic {
+	primary := reporter.Span
+	if !primary.Valid() || primary.End != reporter.Position {
+		// the position is just past the character, so the span starts a character before it
+		start, end := reporter.Position, reporter.Position
+		if start.Indent == 0 {
+			start.Indent, end.Indent = 1, 1
+		}
+		if start.Offset > 0 && start.Bytes > 0 {
+			start.Offset--
+		}
+		primary = Span{Start: start, End: end}
+	}
+	diagnostic := &Diagnostic{
+		Severity: severity,
+		Code:     errCode,
+		Message:  msg,
+		File:     reporter.FileName,
+		Labels:   []Label{{Span: primary, Primary: true}},
+	}
+	for _, note := range notes {
+		if note.Span.Valid() {
+			diagnostic.Labels = append(diagnostic.Labels, Label{Span: note.Span, Message: note.Message})
+		} else {
+			diagnostic.Help = append(diagnostic.Help, note.Message)
+		}
+	}
+	return diagnostic
+}
+
+func (diagnostic *Diagnostic) Primary() Span {
+	return diagnostic.Labels[0].Span
+}
+
+// check if a line should be shown in the snippet, long labels only show their first and last 2 lines
+func (diagnostic *Diagnostic) Shows(line uint32) bool {
+	for _, label := range diagnostic.Labels {
+		start, end := label.Span.Start.Line, label.Span.End.Line
+		if (line >= start && line <= start+1 && line <= end) || (line <= end && line+1 >= end && line >= start) {
+			return true
+		}
+	}
+	return false
+}
+
+// render the diagnostic as a header, a snippet of the source with the labels underlined and any help
+//
+//	error[T0023]: constant 300 overflows u8
+//	 --> main.tv:2:14
+//	  |
+//	2 |     x : u8 = 200 + 100;
+//	  |              ^^^^^^^^^
+func (diagnostic *Diagnostic) Render(lines []string, color bool) string {
+	paint := func(code string, s string) string {
+		if !color || s == "" {
+			return s
+		}
+		return "\x1b[" + code + "m" + s + "\x1b[0m"
+	}
+	severity, severityColor, blue := "error", "1;31", "1;34"
+	if diagnostic.Severity == WARNING {
+		severity, severityColor = "warning", "1;33"
+	}
+	var out strings.Builder
+	out.WriteString(paint(severityColor, severity+"["+CodeString(diagnostic.Code)+"]") + paint("1", ": "+diagnostic.Message) + "\n")
+
+	first, last := diagnostic.Primary().Start.Line, diagnostic.Primary().End.Line
+	for _, label := range diagnostic.Labels {
+		if label.Span.Start.Line < first {
+			first = label.Span.Start.Line
+		}
+		if label.Span.End.Line > last {
+			last = label.Span.End.Line
+		}
+	}
+	width := len(strconv.Itoa(int(last)))
+	gutter := strings.Repeat(" ", width)
+	primary := diagnostic.Primary().Start
+	out.WriteString(gutter + paint(blue, "--> ") + fmt.Sprintf("%s:%d:%d", diagnostic.File, primary.Line, primary.Indent) + "\n")
+	out.WriteString(gutter + paint(blue, " |") + "\n")
+
+	skipped := false
+	for line := first; line <= last; line++ {
+		if !diagnostic.Shows(line) {
+			if !skipped {
+				out.WriteString(paint(blue, "...") + "\n")
+			}
+			skipped = true
+			continue
+		}
+		skipped = false
+		text := ""
+		if line >= 1 && int(line) <= len(lines) {
+			text = lines[line-1]
+		}
+		out.WriteString(paint(blue, fmt.Sprintf("%*d | ", width, line)) + text + "\n")
+		for _, label := range diagnostic.Labels {
+			span := label.Span
+			if line < span.Start.Line || line > span.End.Line {
+				continue
+			}
+			// labels that continue onto other lines are underlined to the start or end of this line
+			start, end := 1+utf8.RuneCountInString(text)-utf8.RuneCountInString(strings.TrimLeft(text, " \t")), utf8.RuneCountInString(text)
+			if line == span.Start.Line {
+				start = int(span.Start.Indent)
+			}
+			if line == span.End.Line {
+				end = int(span.End.Indent)
+			}
+			if end < start {
+				end = start
+			}
+			marker, markerColor := "-", blue
+			if label.Primary {
+				marker, markerColor = "^", severityColor
+			}
+			underline := Padding(text, start-1) + strings.Repeat(marker, end-start+1)
+			if line == span.End.Line && label.Message != "" {
+				underline += " " + label.Message
+			}
+			out.WriteString(paint(blue, gutter+" | ") + paint(markerColor, underline) + "\n")
+		}
+	}
+	for _, help := range diagnostic.Help {
+		out.WriteString(gutter + paint(blue, " = ") + paint("1", "help") + ": " + help + "\n")
+	}
+	return out.String()
+}
+
+// whitespace covering the first n characters of a line, tabs are kept so underlines line up with the source
+func Padding(line string, n int) string {
+	var str strings.Builder
+	for i := 0; i < n; i++ {
+		r, size := utf8.DecodeRuneInString(line)
+		line = line[size:]
+		if r == '\t' {
+			str.WriteByte('\t')
+		} else {
+			str.WriteByte(' ')
+		}
+	}
+	return str.String()
+}
+
+// check if diagnostics should be coloured, by default only when writing to a terminal
+func (compiler *Compiler) Colored() bool {
+	if compiler.Options != nil {
+		switch compiler.Options.Color {
+		case COLOR_ALWAYS:
+			return true
+		case COLOR_NEVER:
+			return false
+		}
+	}
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// write a diagnostic for the file being compiled. human readable diagnostics are logged straight away,
+// json is written to stderr one object per line and sarif is buffered until Flush
+func (compiler *Compiler) Emit(diagnostic *Diagnostic) {
+	format := DIAGNOSTICS_HUMAN
+	if compiler.Options != nil {
+		format = compiler.Options.Diagnostics
+	}
+	if compiler.Lines == nil {
+		compiler.Lines = SplitLines(*compiler.File.Source)
+	}
+	switch format {
+	case DIAGNOSTICS_JSON:
+		out, _ := json.Marshal(diagnostic.JSON(compiler.Lines))
+		fmt.Fprintln(os.Stderr, string(out))
+	case DIAGNOSTICS_SARIF:
+		compiler.Diagnostics = append(compiler.Diagnostics, diagnostic)
+	default:
+		Log(diagnostic.Render(compiler.Lines, compiler.Colored()))
+	}
+}
+
+// write any diagnostics that are buffered until the end of compilation
+func (compiler *Compiler) Flush() {
+	if compiler.Options != nil && compiler.Options.Diagnostics == DIAGNOSTICS_SARIF {
+		out, _ := json.MarshalIndent(Sarif(compiler.Diagnostics), "", "  ")
+		fmt.Fprintln(os.Stderr, string(out))
+		compiler.Diagnostics = nil
+	}
+}
+
+type JSONPosition struct {
+	Line   uint32 `json:"line"`
+	Column uint32 `json:"column"` // in characters
+	Byte   uint32 `json:"byte"`   // the column in bytes
+	Offset uint32 `json:"offset"` // the byte offset into the file
+}
+
+// start is the first character and end is one past the last, so the column, byte and offset of end are all exclusive
+type JSONSpan struct {
+	Start JSONPosition `json:"start"`
+	End   JSONPosition `json:"end"`
+}
+
+type JSONRelated struct {
+	Span    JSONSpan `json:"span"`
+	Message string   `json:"message"`
+}
+
+type JSONDiagnostic struct {
+	Code     string        `json:"code"`
+	Severity string        `json:"severity"`
+	File     string        `json:"file"`
+	Span     JSONSpan      `json:"span"`
+	Message  string        `json:"message"`
+	Related  []JSONRelated `json:"related"`
+	Help     []string      `json:"help"`
+}
+
+// the end of a span is its last character, in json it is moved past it. lines are the lines of the
+// source, used to find how many bytes the last character takes
+func NewJSONSpan(span Span, lines []string) JSONSpan {
+	start := JSONPosition{Line: span.Start.Line, Column: span.Start.Indent, Byte: span.Start.Bytes, Offset: span.Start.Offset}
+	// an empty span e.g. at the end of the file ends where it starts
+	if span.End.Offset <= span.Start.Offset {
+		return JSONSpan{Start: start, End: start}
+	}
+	end := JSONPosition{Line: span.End.Line, Column: span.End.Indent + 1, Byte: span.End.Bytes + 1, Offset: span.End.Offset}
+	if line := int(span.End.Line) - 1; line >= 0 && line < len(lines) && span.End.Bytes >= 1 && int(span.End.Bytes) <= len(lines[line]) {
+		_, size := utf8.DecodeRuneInString(lines[line][span.End.Bytes-1:])
+		end.Byte = span.End.Bytes + uint32(size)
+	}
+	return JSONSpan{Start: start, End: end}
+}
+
+func (diagnostic *Diagnostic) SeverityString() string {
+	if diagnostic.Severity == WARNING {
+		return "warning"
+	}
+	return "error"
+}
+
+func (diagnostic *Diagnostic) JSON(lines []string) *JSONDiagnostic {
+	result := &JSONDiagnostic{
+		Code:     CodeString(diagnostic.Code),
+		Severity: diagnostic.SeverityString(),
+		File:     diagnostic.File,
+		Span:     NewJSONSpan(diagnostic.Primary(), lines),
+		Message:  diagnostic.Message,
+		Related:  []JSONRelated{},
+		Help:     diagnostic.Help,
+	}
+	if result.Help == nil {
+		result.Help = []string{}
+	}
+	for _, label := range diagnostic.Labels[1:] {
+		result.Related = append(result.Related, JSONRelated{Span: NewJSONSpan(label.Span, lines), Message: label.Message})
+	}
+	return result
+}
@@ -29,7 +29,8 @@ func (directives *Directives) Run() []*Token {
 		case IMPORT:
 			directives.Import()
 		case RUN:
-			directives.RunJIT()
+			// #run is an expression, it is left for the parser and evaluated by the checker
+			directives.Consumer.Advance()
 		default:
 			directives.Consumer.Advance()
 			break
@@ -43,7 +44,3 @@ func (directives *Directives) Run() []*Token {
 func (directives *Directives) Import(){
 	Log("import")
 }
-
-func (directives *Directives) RunJIT(){
-	Log("jit compile")
-}
\ No newline at end of file
@@ -0,0 +1,581 @@
+package src
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// every error the compiler can report has a code that is printed as T0001, T0002 etc.
+// codes are never reused or renumbered so they can be searched for, new errors go at the end
+const (
+	ERR_UNEXPECTED_CHAR        uint32 = 1
+	ERR_UNTERMINATED_STRING    uint32 = 2
+	ERR_INVALID_NUMBER_LITERAL uint32 = 3
+	ERR_UNKNOWN_ESCAPE         uint32 = 4
+	ERR_INVALID_ESCAPE         uint32 = 5
+	ERR_INVALID_UTF8           uint32 = 6
+	ERR_UNKNOWN_DIRECTIVE      uint32 = 7
+	ERR_UNEXPECTED_TOKEN       uint32 = 8
+	ERR_ARRAY_LENGTH           uint32 = 9
+	ERR_NOT_CONSTANT           uint32 = 10
+	ERR_REDECLARED             uint32 = 11
+	ERR_MISMATCHED_TYPES       uint32 = 12
+	ERR_NO_VAR                 uint32 = 13
+	ERR_NO_MEMBER              uint32 = 14
+	ERR_DUPLICATE_FIELD        uint32 = 15
+	ERR_FIELD_COUNT            uint32 = 16
+	ERR_NOT_UNION              uint32 = 17
+	ERR_NO_VARIANT             uint32 = 18
+	ERR_NON_EXHAUSTIVE         uint32 = 19
+	ERR_DUPLICATE_CASE         uint32 = 20
+	ERR_PAYLOAD_COUNT          uint32 = 21
+	ERR_INVALID_CHAR           uint32 = 22
+	ERR_OVERFLOW               uint32 = 23
+	ERR_ARG_COUNT              uint32 = 24
+	ERR_NOT_ARRAY              uint32 = 25
+	ERR_INDEX_TYPE             uint32 = 26
+	ERR_OUT_OF_BOUNDS          uint32 = 27
+	ERR_UNKNOWN_LINT           uint32 = 28
+
+	// warnings share the same codes, see lint.go
+	WARN_UNUSED_VARIABLE    uint32 = 29
+	WARN_UNUSED_PARAMETER   uint32 = 30
+	WARN_UNUSED_FUNCTION    uint32 = 31
+	WARN_SHADOWING          uint32 = 32
+	WARN_UNREACHABLE_CODE   uint32 = 33
+	WARN_CONSTANT_CONDITION uint32 = 34
+	WARN_NARROWING          uint32 = 35
+
+	ERR_MISSING_RETURN     uint32 = 36
+	ERR_RETURN_VALUE       uint32 = 37
+	ERR_BREAK_OUTSIDE_LOOP uint32 = 38
+	ERR_UNASSIGNED         uint32 = 39
+	ERR_NOT_FN             uint32 = 40
+	ERR_RECEIVER           uint32 = 41
+	ERR_NOT_IMPLEMENTED    uint32 = 42
+	ERR_TYPE_PARAM         uint32 = 43
+	ERR_NOT_STRUCT         uint32 = 44
+	ERR_RECURSIVE_TYPE     uint32 = 45
+)
+
+// the write-up for an error code, shown by `tavc explain`
+type ErrorInfo struct {
+	Title       string
+	Explanation string
+	Example     string // erroneous code showing how the error happens
+}
+
+var Errors = map[uint32]*ErrorInfo{
+	ERR_UNEXPECTED_CHAR: {
+		Title: "unexpected character",
+		Explanation: `The lexer found a character that cannot start any token. Identifiers may contain
+any unicode letter, but symbols outside of the language's operators are not allowed
+outside of strings and comments.`,
+		Example: `main : fn i32 {
+    x := 1 ^ 2;
+    ret x;
+}`,
+	},
+	ERR_UNTERMINATED_STRING: {
+		Title: "unterminated string",
+		Explanation: `A string, character literal or raw string reached the end of the file before
+its closing quote. Strings can span multiple lines, so the error is usually reported at the
+end of the file rather than where the quote is missing. Character literals must be closed on
+the same line.`,
+		Example: `main : fn i32 {
+    s := "hello;
+    ret 0;
+}`,
+	},
+	ERR_INVALID_NUMBER_LITERAL: {
+		Title: "invalid number literal",
+		Explanation: `A number literal is malformed. Hex, binary and octal literals may only contain
+digits of their base, a number can only have a single '.', an exponent needs digits, the
+suffix must be a number type and the value must fit in the type given by its suffix.`,
+		Example: `main : fn i32 {
+    x := 0b102;
+    y := 300u8;
+    ret 0;
+}`,
+	},
+	ERR_UNKNOWN_ESCAPE: {
+		Title: "unknown escape sequence",
+		Explanation: `A '\' in a string or character literal must be followed by one of n, r, t, 0, \,
+', ", x or u. Use a raw string if the string should contain a '\' as is.`,
+		Example: `main : fn i32 {
+    s := "C:\path";
+    ret 0;
+}`,
+	},
+	ERR_INVALID_ESCAPE: {
+		Title: "invalid escape sequence",
+		Explanation: `A \x escape needs 2 hex digits and a \u escape needs a valid unicode code point
+written in hex between curly braces.`,
+		Example: `main : fn i32 {
+    s := "\u{110000}";
+    ret 0;
+}`,
+	},
+	ERR_INVALID_UTF8: {
+		Title:       "source is not valid utf-8",
+		Explanation: `Tav source files must be encoded as utf-8. Save the file as utf-8 and try again.`,
+	},
+	ERR_UNKNOWN_DIRECTIVE: {
+		Title: "unknown directive",
+		Explanation: `A '#' must be followed by the name of a directive, such as #run, #native or
+#pack.`,
+		Example: `main : fn i32 {
+    x := #compile square(2);
+    ret x;
+}`,
+	},
+	ERR_UNEXPECTED_TOKEN: {
+		Title: "unexpected token",
+		Explanation: `The parser found a token where it expected something else, the message says what
+was expected. This is usually a missing ';', bracket or comma.`,
+		Example: `main : fn i32 {
+    x := 1
+    ret x;
+}`,
+	},
+	ERR_ARRAY_LENGTH: {
+		Title: "invalid array length",
+		Explanation: `The length of an array type must be an integer constant that is greater than
+0, so the size of the array is known at compile time.`,
+		Example: `n : i32 = 4;
+buf : [n]i32;`,
+	},
+	ERR_NOT_CONSTANT: {
+		Title: "value is not constant",
+		Explanation: `The value of a constant, global or struct member default must be known at compile
+time. It may only use literals, other constants, the size, count, packed and name of #type_info(T), the name
+and offset of the field of a #for and operators on them. #run can also call functions, as long as they only
+use numbers, bools, strings and local variables, and don't call native functions. Constants, functions and
+the field of a #for can't be assigned to.`,
+		Example: `get : fn i32 {
+    ret 4;
+}
+N :: get();`,
+	},
+	ERR_REDECLARED: {
+		Title: "redeclared symbol",
+		Explanation: `A name can only be declared once in a scope. Rename one of the declarations, or
+assign to the existing variable with '=' instead of declaring it again.`,
+		Example: `main : fn i32 {
+    x := 1;
+    x := 2;
+    ret x;
+}`,
+	},
+	ERR_MISMATCHED_TYPES: {
+		Title: "mismatched types",
+		Explanation: `A value was used where a different type was expected, e.g. assigned to a variable,
+passed as an argument or returned. Tav never converts between types implicitly, number
+literals without a suffix are the exception and take the type that is expected.`,
+		Example: `main : fn i32 {
+    x : i32 = "hello";
+    ret x;
+}`,
+	},
+	ERR_NO_VAR: {
+		Title: "undeclared name",
+		Explanation: `A variable, function or struct was used that hasn't been declared in this scope or
+any scope containing it.`,
+		Example: `main : fn i32 {
+    ret y;
+}`,
+	},
+	ERR_NO_MEMBER: {
+		Title:       "no such member",
+		Explanation: `A struct member was accessed or assigned that isn't declared in the struct.`,
+		Example: `Vec2 : struct {
+    x : i32;
+    y : i32;
+}
+main : fn i32 {
+    v := Vec2{1, 2};
+    ret v.z;
+}`,
+	},
+	ERR_DUPLICATE_FIELD: {
+		Title:       "member assigned more than once",
+		Explanation: `A struct literal gave a value to the same member more than once.`,
+		Example: `Vec2 : struct {
+    x : i32;
+    y : i32;
+}
+main : fn i32 {
+    v := Vec2{x = 1, x = 2};
+    ret v.x;
+}`,
+	},
+	ERR_FIELD_COUNT: {
+		Title: "too many values in struct literal",
+		Explanation: `A struct literal that lists its values in order has more values than the struct
+has members.`,
+		Example: `Vec2 : struct {
+    x : i32;
+    y : i32;
+}
+main : fn i32 {
+    v := Vec2{1, 2, 3};
+    ret v.x;
+}`,
+	},
+	ERR_NOT_UNION: {
+		Title: "match on a value that isn't a union",
+		Explanation: `A match statement branches on the variant of a tagged union, so the value being
+matched must be a union.`,
+		Example: `main : fn i32 {
+    x := 1;
+    match x {
+        case One(v) ret v;
+    }
+    ret 0;
+}`,
+	},
+	ERR_NO_VARIANT: {
+		Title:       "no such variant",
+		Explanation: `A union variant was constructed or matched that isn't declared in the union.`,
+		Example: `Shape : union { Circle : f32, Rect : Vec2 }
+main : fn i32 {
+    s := Shape.Square(1.0);
+    ret 0;
+}`,
+	},
+	ERR_NON_EXHAUSTIVE: {
+		Title: "non exhaustive match",
+		Explanation: `Every variant of a union must be handled by a match statement so that no value is
+silently ignored. Add a case for each missing variant, or an else case.`,
+		Example: `Shape : union { Circle : f32, Rect : Vec2 }
+area : fn f32 (s : Shape) {
+    match s {
+        case Circle(r) ret r * r * 3.14;
+    }
+}`,
+	},
+	ERR_DUPLICATE_CASE: {
+		Title: "variant matched more than once",
+		Explanation: `Each variant can only have a single case in a match statement, the second case
+would never run.`,
+		Example: `Shape : union { Circle : f32, Rect : Vec2 }
+area : fn f32 (s : Shape) {
+    match s {
+        case Circle(r) ret r * r * 3.14;
+        case Circle(r) ret r;
+        else ret 0.0;
+    }
+}`,
+	},
+	ERR_PAYLOAD_COUNT: {
+		Title: "wrong number of payloads",
+		Explanation: `Constructing a union variant takes exactly 1 value, the payload. Use a struct as
+the payload to store more than 1 value.`,
+		Example: `Shape : union { Circle : f32, Rect : Vec2 }
+main : fn i32 {
+    s := Shape.Circle(1.0, 2.0);
+    ret 0;
+}`,
+	},
+	ERR_INVALID_CHAR: {
+		Title:       "invalid character literal",
+		Explanation: `A character literal must contain exactly 1 character. Use " for strings.`,
+		Example: `main : fn i32 {
+    c := 'ab';
+    ret 0;
+}`,
+	},
+	ERR_OVERFLOW: {
+		Title: "constant overflows type",
+		Explanation: `A constant value doesn't fit in the type it is assigned to. Use a larger type or a
+smaller value. Numbers without a suffix are checked with their exact value once their type is known,
+so a negative number can't be given an unsigned type.`,
+		Example: `main : fn i32 {
+    x : u8 = 200 + 100;
+    ret 0;
+}`,
+	},
+	ERR_ARG_COUNT: {
+		Title: "wrong number of arguments",
+		Explanation: `A function was called with a different number of arguments than it has
+parameters. Variadic #native functions can take more arguments than they declare.`,
+		Example: `add : fn i32 (a : i32, b : i32) {
+    ret a + b;
+}
+main : fn i32 {
+    ret add(1);
+}`,
+	},
+	ERR_NOT_ARRAY: {
+		Title:       "indexed a value that isn't an array",
+		Explanation: `Only arrays and pointers can be indexed with [].`,
+		Example: `main : fn i32 {
+    x := 1;
+    ret x[0];
+}`,
+	},
+	ERR_INDEX_TYPE: {
+		Title:       "array index isn't an integer",
+		Explanation: `An array must be indexed with an integer.`,
+		Example: `main : fn i32 {
+    buf : [4]i32;
+    ret buf[1.5];
+}`,
+	},
+	ERR_OUT_OF_BOUNDS: {
+		Title: "array index out of bounds",
+		Explanation: `A constant index is outside of the array. Arrays are indexed from 0, so the last
+element of a [4]i32 is at index 3.`,
+		Example: `main : fn i32 {
+    buf : [4]i32;
+    ret buf[4];
+}`,
+	},
+	ERR_UNKNOWN_LINT: {
+		Title: "unknown warning",
+		Explanation: `The name given to #allow or a -W flag isn't a warning the compiler knows about.
+The warnings are unused_variable, unused_parameter, unused_function, shadowing,
+unreachable_code, constant_condition and narrowing.`,
+		Example: `#allow(unused)
+main : fn i32 {
+    ret 0;
+}`,
+	},
+	WARN_UNUSED_VARIABLE: {
+		Title: "unused variable",
+		Explanation: `A local variable is declared but its value is never read. Assigning to a variable
+doesn't count as using it. Remove the variable, or start its name with '_' if it is
+unused on purpose. This is the unused_variable warning.`,
+		Example: `main : fn i32 {
+    x := 1;
+    ret 0;
+}`,
+	},
+	WARN_UNUSED_PARAMETER: {
+		Title: "unused parameter",
+		Explanation: `A function parameter is never read. Start its name with '_' if the function must
+take the parameter but doesn't need it. This is the unused_parameter warning.`,
+		Example: `double : fn i32 (x : i32, y : i32) {
+    ret x * 2;
+}`,
+	},
+	WARN_UNUSED_FUNCTION: {
+		Title: "unused function",
+		Explanation: `A function is declared but never called. main and functions without a body are
+never reported. This is the unused_function warning.`,
+		Example: `helper : fn i32 {
+    ret 1;
+}
+main : fn i32 {
+    ret 0;
+}`,
+	},
+	WARN_SHADOWING: {
+		Title: "shadowed variable",
+		Explanation: `A variable is declared with the same name as a variable in an outer scope, so the
+outer variable can't be used until the inner scope ends. This is often a mistake where an
+assignment with '=' was intended. This is the shadowing warning.`,
+		Example: `main : fn i32 {
+    x := 1;
+    if x > 0 {
+        x := 2;
+    }
+    ret x;
+}`,
+	},
+	WARN_UNREACHABLE_CODE: {
+		Title: "unreachable code",
+		Explanation: `A statement follows a ret or break in the same block, so it can never run. This is
+the unreachable_code warning.`,
+		Example: `main : fn i32 {
+    ret 0;
+    puts("done");
+}`,
+	},
+	WARN_CONSTANT_CONDITION: {
+		Title: "condition is always true",
+		Explanation: `The condition of an if, elif or for is made only of literals, so it always has the
+same value. 'for true' is allowed as it is the way to write an infinite loop, and
+conditions that use a named constant are not reported so they can be used as switches.
+This is the constant_condition warning.`,
+		Example: `main : fn i32 {
+    if 1 < 2 {
+        ret 1;
+    }
+    ret 0;
+}`,
+	},
+	WARN_NARROWING: {
+		Title: "implicit narrowing",
+		Explanation: `The operands of a binary expression have different number types, so they are
+converted to the type of the left operand, or to the float type if only one of them is a
+float. Comparisons use the larger of the two types instead. The conversion loses
+information when the operand's type is larger, e.g. an i64 converted to an i32 or an f64
+converted to an f32. Cast the operand explicitly if this is intended. This is the
+narrowing warning.`,
+		Example: `main : fn i32 {
+    a : i32 = 1;
+    b : i64 = 2;
+    ret a + b;
+}`,
+	},
+	ERR_MISSING_RETURN: {
+		Title: "missing return",
+		Explanation: `A function that returns a value can reach the end of its body without a ret. Every
+path through the function must end in a ret, e.g. an if needs an else that returns as
+well, and a match needs every case to return. A for loop with a condition of true and no
+break never reaches the end, so it doesn't need a ret after it.`,
+		Example: `sign : fn i32 (x : i32) {
+    if x < 0 {
+        ret -1;
+    } elif x > 0 {
+        ret 1;
+    }
+}`,
+	},
+	ERR_RETURN_VALUE: {
+		Title: "wrong kind of return",
+		Explanation: `A function without a return type returns nothing, so its rets can't have a value.
+A function with a return type must give every ret a value.`,
+		Example: `log : fn (x : i32) {
+    ret x;
+}`,
+	},
+	ERR_BREAK_OUTSIDE_LOOP: {
+		Title: "break outside of a loop",
+		Explanation: `break leaves the innermost for loop, so it can only be used inside one. Use ret to
+leave a function early.`,
+		Example: `main : fn i32 {
+    break;
+    ret 0;
+}`,
+	},
+	ERR_UNASSIGNED: {
+		Title: "variable might not be assigned",
+		Explanation: `A variable declared without a value is read on a path where it might not have
+been assigned yet. An if without an else, or a for loop whose body might never run, doesn't assign
+the variable for the code after it. Declare the variable with '= ---' to leave it uninitialised
+on purpose, the compiler then trusts that it is assigned before it is read. Structs and arrays
+are always initialised, to their default values or zero.`,
+		Example: `main : fn i32 {
+    x : i32;
+    if 1 > 0 {
+        x = 1;
+    }
+    ret x;
+}`,
+	},
+	ERR_NOT_FN: {
+		Title: "not a function",
+		Explanation: `Only functions can be called. A variable, paramater or struct member can hold a
+function if its type is a function type, e.g. fn i32 (i32, i32), which lists the return type and
+the types of the paramaters.`,
+		Example: `main : fn i32 {
+    x := 1;
+    ret x(2);
+}`,
+	},
+	ERR_RECEIVER: {
+		Title: "invalid receiver",
+		Explanation: `The first paramater of a method is the struct it is called on, either the struct
+itself or a pointer to it. When a method is called, the address of the struct is taken or the pointer
+is dereferenced to match, but a pointer to a pointer is never dereferenced twice. For a generic struct
+it is an instance of it, either one instance e.g. *Box[i32] or every instance e.g. *Box[$T].`,
+		Example: `Vec2 : struct {
+    x : i32;
+    y : i32;
+}
+Vec2.sum : fn i32 (x : i32, y : i32) {
+    ret x + y;
+}`,
+	},
+	ERR_NOT_IMPLEMENTED: {
+		Title: "interface not implemented",
+		Explanation: `A struct was used as an interface, or declared to implement one, but it doesn't have
+every method of the interface. Each method must have the same paramaters and return type as in the
+interface, apart from the first paramater which is the struct itself.`,
+		Example: `Shape : interface {
+    area : fn i32 ();
+}
+Square : struct {
+    side : i32;
+}
+main : fn i32 {
+    s : Shape = Square{2};
+    ret s.area();
+}`,
+	},
+	ERR_TYPE_PARAM: {
+		Title: "invalid type paramater",
+		Explanation: `The type paramaters of a generic function, e.g. $T in max : fn $T (a : $T, b : $T), are
+inferred from the types of the arguments it is called with. Every type paramater must be used by a
+paramater, and all the arguments for the same type paramater must have the same type. Untyped
+number literals take the type the other arguments decide. Generic structs are given their type
+arguments in brackets e.g. Box[i32]. A generic function can only be called, not used as a value.`,
+		Example: `max : fn $T (a : $T, b : $T) {
+    if a > b {
+        ret a;
+    }
+    ret b;
+}
+main : fn i32 {
+    a : i32 = 1;
+    b : i64 = 2;
+    ret max(a, b);
+}`,
+	},
+	ERR_NOT_STRUCT: {
+		Title: "not a struct",
+		Explanation: `#for f : T {...} repeats its body for each field of the struct T at compile time, so T must
+be a struct, not a pointer to one or any other type. Inside the body f is the field's TypeField, which has
+its name, TypeInfo and offset. With #for v.f : T {...}, v.f is also that field of the value v.`,
+		Example: `main : fn i32 {
+    #for f : i32 {
+        printf("%s\n", f.name);
+    }
+    ret 0;
+}`,
+	},
+	ERR_RECURSIVE_TYPE: {
+		Title: "recursive type",
+		Explanation: `A struct or union contains itself by value, either directly or through the members of
+other types, so it would need an infinite amount of space. Refer to it through a pointer instead, e.g.
+next : *Node.`,
+		Example: `Node : struct {
+    value : i32;
+    next : Node;
+}`,
+	},
+}
+
+// the printed form of an error code
+func CodeString(code uint32) string {
+	return fmt.Sprintf("T%04d", code)
+}
+
+// parse an error code as printed (e.g. T0001), the T is optional
+func ParseCode(str string) (uint32, bool) {
+	str = strings.TrimPrefix(strings.ToUpper(str), "T")
+	code, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	_, ok := Errors[uint32(code)]
+	return uint32(code), ok
+}
+
+// the full write-up of an error code
+func Explain(code uint32) string {
+	info := Errors[code]
+	var out strings.Builder
+	out.WriteString(CodeString(code) + ": " + info.Title + "\n\n")
+	out.WriteString(info.Explanation + "\n")
+	if info.Example != "" {
+		out.WriteString("\nerroneous code example:\n\n")
+		for _, line := range strings.Split(info.Example, "\n") {
+			out.WriteString("    " + line + "\n")
+		}
+	}
+	return out.String()
+}
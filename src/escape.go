@@ -0,0 +1,259 @@
+package src
+
+// escape analysis decides which closures can outlive the function that creates them. a closure escapes
+// if it is returned, stored somewhere other than a local variable, or given to a function that might
+// keep it. closures that escape get an environment on the heap, and so do the variables they capture.
+// the boxes made when a value is used as an any are tracked the same way, and so are structs used as an
+// interface, which points at the struct
+type Escaper struct {
+	SymTable *SymTable
+	// the closures, boxes and variables whose value may end up in each variable, if it escapes so do they
+	Sources map[*Symbol][]interface{}
+	// the closures, boxes and variables that escape, each one is either a *ClosureAST, a *CastAST or a *Symbol
+	Escaping map[interface{}]bool
+	Worklist []interface{}
+}
+
+func Escape(RootAST *RootAST) {
+	escaper := Escaper{
+		SymTable: RootAST.SymTable,
+		Sources:  make(map[*Symbol][]interface{}),
+		Escaping: make(map[interface{}]bool),
+	}
+	for _, statement := range RootAST.Statements {
+		// globals can only hold constants
+		if _, ok := statement.(*VarDefAST); !ok && !IsGenericDecl(statement) {
+			escaper.Walk(statement)
+		}
+	}
+	escaper.Propagate()
+}
+
+// the closures and variables an expression's value may come from
+func (escaper *Escaper) Flows(expression AST) []interface{} {
+	switch e := expression.(type) {
+	case *ClosureAST:
+		return []interface{}{e}
+	case *VariableAST:
+		if (e.Symbol.Kind == SYMBOL_VARIABLE || e.Symbol.Kind == SYMBOL_PARAM) && escaper.Tracked(e.Symbol.Type) {
+			return []interface{}{e.Symbol}
+		}
+	case *GroupAST:
+		return escaper.Flows(e.Group)
+	case *CastAST:
+		if escaper.Boxes(e) || escaper.Converts(e) {
+			return []interface{}{e}
+		}
+		// the value taken out of an any is a copy, unless it is a function that carries its environment
+		if e.Checked && e.TavType.Type != TYPE_FN {
+			return nil
+		}
+		return escaper.Flows(e.Expr)
+	}
+	return nil
+}
+
+// the value of the expression is stored in the variable
+func (escaper *Escaper) Assign(sym *Symbol, expression AST) {
+	if sym.Kind != SYMBOL_VARIABLE && sym.Kind != SYMBOL_PARAM {
+		escaper.Leak(expression)
+		return
+	}
+	escaper.Sources[sym] = append(escaper.Sources[sym], escaper.Flows(expression)...)
+}
+
+// the value of the expression outlives the function
+func (escaper *Escaper) Leak(expression AST) {
+	escaper.Worklist = append(escaper.Worklist, escaper.Flows(expression)...)
+}
+
+// mark everything that reaches an escape as escaping
+func (escaper *Escaper) Propagate() {
+	for len(escaper.Worklist) > 0 {
+		node := escaper.Worklist[len(escaper.Worklist)-1]
+		escaper.Worklist = escaper.Worklist[:len(escaper.Worklist)-1]
+		if escaper.Escaping[node] {
+			continue
+		}
+		escaper.Escaping[node] = true
+		switch node := node.(type) {
+		case *Symbol:
+			escaper.Worklist = append(escaper.Worklist, escaper.Sources[node]...)
+		case *ClosureAST:
+			node.Escapes = true
+			// the captured variables live as long as the closure, closures they hold can be called later too
+			for _, capture := range node.Captures {
+				capture.Heap = true
+				if escaper.Tracked(capture.Type) {
+					escaper.Worklist = append(escaper.Worklist, capture)
+				}
+			}
+		case *CastAST:
+			node.Escapes = true
+			// an interface points at the struct, so a variable holding the struct has to live on the heap
+			if variable, ok := node.Expr.(*VariableAST); ok && escaper.Converts(node) && (variable.Symbol.Kind == SYMBOL_VARIABLE || variable.Symbol.Kind == SYMBOL_PARAM) {
+				variable.Symbol.Heap = true
+			}
+			// the box holds a copy of the value, so whatever the value came from escapes with it
+			escaper.Worklist = append(escaper.Worklist, escaper.Flows(node.Expr)...)
+		}
+	}
+}
+
+func (escaper *Escaper) Walk(ast AST) {
+	switch a := ast.(type) {
+	case *FnAST:
+		escaper.Statements(a.Body)
+	case *ClosureAST:
+		escaper.Statements(a.Fn.Body)
+	case *BlockAST:
+		escaper.Statements(a.Statements)
+	case *FieldsAST:
+		escaper.Walk(a.Unrolled)
+	case *ExprStmtAST:
+		escaper.Walk(a.Expression)
+	case *ReturnAST:
+		if a.Value != nil {
+			escaper.Walk(a.Value)
+			escaper.Leak(a.Value)
+		}
+	case *ForAST:
+		escaper.Walk(a.Condition)
+		escaper.Walk(a.Body)
+	case *IfAST:
+		escaper.Walk(a.IfCondition)
+		escaper.Walk(a.IfBody)
+		for i, condition := range a.ElifCondition {
+			escaper.Walk(condition)
+			escaper.Walk(a.ElifBody[i])
+		}
+		if a.ElseBody != nil {
+			escaper.Walk(a.ElseBody)
+		}
+	case *MatchAST:
+		escaper.Walk(a.Value)
+		for _, matchCase := range a.Cases {
+			escaper.Walk(matchCase.Body)
+		}
+		if a.ElseBody != nil {
+			escaper.Walk(a.ElseBody)
+		}
+	case *VarDefAST:
+		if a.Assignment != nil {
+			escaper.Walk(a.Assignment)
+			escaper.Assign(a.Symbol, a.Assignment)
+		}
+	case *VarSetAST:
+		escaper.Walk(a.Value)
+		escaper.Assign(a.Symbol, a.Value)
+	case *StructSetAST:
+		escaper.Walk(a.Struct)
+		escaper.Walk(a.Value)
+		escaper.Leak(a.Value)
+	case *IndexSetAST:
+		escaper.Walk(a.Array)
+		escaper.Walk(a.Index)
+		escaper.Walk(a.Value)
+		escaper.Leak(a.Value)
+	case *StructLitAST:
+		for _, val := range a.Values {
+			escaper.Walk(val)
+			escaper.Leak(val)
+		}
+	case *CallAST:
+		escaper.Walk(a.Caller)
+		for _, arg := range a.Args {
+			escaper.Walk(arg)
+		}
+		escaper.Call(a)
+	case *UnaryAST:
+		escaper.Walk(a.Right)
+		// a pointer to the variable can be stored anywhere
+		if a.Operator.Type == ADDR {
+			escaper.Leak(a.Right)
+		}
+	case *BinaryAST:
+		escaper.Walk(a.Left)
+		escaper.Walk(a.Right)
+	case *ConnectiveAST:
+		escaper.Walk(a.Left)
+		escaper.Walk(a.Right)
+	case *StructGetAST:
+		escaper.Walk(a.Struct)
+	case *IndexAST:
+		escaper.Walk(a.Array)
+		escaper.Walk(a.Index)
+	case *GroupAST:
+		escaper.Walk(a.Group)
+	case *CastAST:
+		escaper.Walk(a.Expr)
+		// a pointer to the value in a box can be stored anywhere
+		if !a.Checked && a.TavType.Indirection > 0 && InferType(a.Expr, escaper.SymTable).IsAny() {
+			escaper.Leak(a.Expr)
+		}
+	case *TypeOfAST:
+		if a.Value != nil {
+			escaper.Walk(a.Value)
+		}
+	case *RunAST:
+		escaper.Walk(a.Expr)
+	}
+}
+
+// returns true if a cast boxes a value to use it as an any
+func (escaper *Escaper) Boxes(CastAST *CastAST) bool {
+	return CastAST.TavType.IsAny() && !InferType(CastAST.Expr, escaper.SymTable).IsAny()
+}
+
+// returns true if a cast uses a struct as an interface
+func (escaper *Escaper) Converts(CastAST *CastAST) bool {
+	return escaper.Interface(CastAST.TavType) && !escaper.Interface(InferType(CastAST.Expr, escaper.SymTable))
+}
+
+// returns true if a type is an interface, which holds a pointer to a struct
+func (escaper *Escaper) Interface(t TavType) bool {
+	if t.Type != TYPE_INSTANCE || t.Indirection != 0 || t.Length != 0 {
+		return false
+	}
+	sym := escaper.SymTable.Get(t.Instance)
+	return sym != nil && sym.Type.Type == TYPE_INTERFACE
+}
+
+// returns true if a variable of the type can hold something that is tracked e.g. a closure
+func (escaper *Escaper) Tracked(t TavType) bool {
+	return t.Type == TYPE_FN || t.IsAny() || escaper.Interface(t)
+}
+
+func (escaper *Escaper) Statements(statements []AST) {
+	for _, statement := range statements {
+		escaper.Walk(statement)
+	}
+}
+
+// the arguments of a call to a function or method with a body flow into its paramaters, any other
+// function (a prototype, a builtin or a function value) might keep them
+func (escaper *Escaper) Call(CallAST *CallAST) {
+	var params []VarDefAST
+	switch caller := CallAST.Caller.(type) {
+	case *VariableAST:
+		if fn, ok := caller.Symbol.Value.(*FnAST); ok && caller.Symbol.Kind == SYMBOL_FN && !fn.Proto {
+			params = fn.Params
+		}
+	case *StructGetAST:
+		// the struct a method is called on is the first paramater, the methods of an interface could be anything
+		if caller.Method != nil && caller.Method.Value.(*FnAST).Receiver != nil {
+			params = caller.Method.Value.(*FnAST).Params[1:]
+		}
+	}
+	if params == nil {
+		for _, arg := range CallAST.Args {
+			escaper.Leak(arg)
+		}
+		return
+	}
+	for i, arg := range CallAST.Args {
+		if i < len(params) {
+			escaper.Assign(params[i].Symbol, arg)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package src
+
+import (
+	"math/big"
+	"strconv"
+
+	"github.com/llir/llvm/ir/types"
+)
+
+// evaluate an expression at compile time, constants are stored in the symbol table with
+// their folded literal as the value. returns false if the expression isn't constant, without
+// a symbol table only literals are folded
+func Fold(expression AST, SymTable *SymTable) (*LiteralAST, bool) {
+	switch e := expression.(type) {
+	case *LiteralAST:
+		return e, true
+	case *GroupAST:
+		return Fold(e.Group, SymTable)
+	case *VariableAST:
+		if SymTable == nil {
+			return nil, false
+		}
+		// names are linked once they have been resolved, a name made after that is looked up
+		sym := e.Symbol
+		if sym == nil {
+			sym = SymTable.Get(e.Identifier.Lexme())
+		}
+		if sym != nil {
+			if lit, ok := sym.Value.(*LiteralAST); ok {
+				// copy the constant so casting the result doesn't retype the constant itself
+				folded := *lit
+				folded.Range = e.Range
+				return &folded, true
+			}
+		}
+	case *CastAST:
+		if val, ok := Fold(e.Expr, SymTable); ok && e.TavType.Indirection == 0 {
+			return WithSpan(e)(FoldCast(val, e.TavType))
+		}
+	case *UnaryAST:
+		if right, ok := Fold(e.Right, SymTable); ok {
+			return WithSpan(e)(FoldUnary(e.Operator.Type, right))
+		}
+	case *BinaryAST:
+		left, ok := Fold(e.Left, SymTable)
+		if !ok {
+			return nil, false
+		}
+		right, ok := Fold(e.Right, SymTable)
+		if !ok {
+			return nil, false
+		}
+		return WithSpan(e)(FoldBinary(e.Operator.Type, left, right))
+	case *RunAST:
+		if e.Value != nil {
+			return e.Value, true
+		}
+		return Fold(e.Expr, SymTable)
+	case *StructGetAST:
+		if SymTable != nil {
+			return WithSpan(e)(FoldInfo(e, SymTable))
+		}
+	}
+	return nil, false
+}
+
+// fold a member of a TypeInfo that is known at compile time e.g. #type_info(T).size, or of the TypeField
+// of a #for e.g. f.offset. the layout is worked out from the declerations, the same as the generator does
+func FoldInfo(get *StructGetAST, SymTable *SymTable) (*LiteralAST, bool) {
+	i64, str := NewTavType(TYPE_I64, "", 0, nil), NewTavType(TYPE_STRING, "", 0, nil)
+	if typeOf, ok := get.Struct.(*TypeOfAST); ok && typeOf.Type != nil {
+		t := *typeOf.Type
+		layout, ok := LayoutType(t, SymTable)
+		if !ok {
+			return nil, false
+		}
+		var decl *StructAST
+		if t.Type == TYPE_INSTANCE && t.Indirection == 0 && t.Length == 0 {
+			decl, _ = SymTable.Get(t.Instance).Value.(*StructAST)
+		}
+		switch get.Member.Lexme() {
+		case "size":
+			return &LiteralAST{Type: i64, Value: TavValue{Int: int64(SizeOf(layout))}}, true
+		case "name":
+			return &LiteralAST{Type: str, Value: TavValue{String: []byte(t.String())}}, true
+		case "count":
+			count := int64(t.Length)
+			if decl != nil {
+				count = int64(len(decl.Fields))
+			}
+			return &LiteralAST{Type: i64, Value: TavValue{Int: count}}, true
+		case "packed":
+			return &LiteralAST{Type: NewTavType(TYPE_BOOL, "", 0, nil), Value: TavValue{Bool: decl != nil && decl.Packed}}, true
+		}
+		return nil, false
+	}
+	t, i, ok := Field(get.Struct, SymTable)
+	if !ok {
+		return nil, false
+	}
+	layout, ok := LayoutType(t, SymTable)
+	if !ok {
+		return nil, false
+	}
+	switch get.Member.Lexme() {
+	case "name":
+		decl := SymTable.Get(t.Instance).Value.(*StructAST)
+		return &LiteralAST{Type: str, Value: TavValue{String: []byte(decl.Fields[i].Identifier.Lexme())}}, true
+	case "offset":
+		return &LiteralAST{Type: i64, Value: TavValue{Int: int64(OffsetOf(layout.(*types.StructType), i))}}, true
+	}
+	return nil, false
+}
+
+// find the struct and the index of the field a TypeField is for, if it is known at compile time e.g.
+// #type_info(T).fields[1] or the TypeField of a #for, whose symbol holds the expression it was given
+func Field(expression AST, SymTable *SymTable) (TavType, int, bool) {
+	index, ok := expression.(*IndexAST)
+	if v, isVar := expression.(*VariableAST); isVar && v.Symbol != nil {
+		index, ok = v.Symbol.Value.(*IndexAST)
+	}
+	if !ok {
+		return TavType{}, 0, false
+	}
+	fields, ok := index.Array.(*StructGetAST)
+	if !ok || fields.Member.Lexme() != "fields" {
+		return TavType{}, 0, false
+	}
+	typeOf, ok := fields.Struct.(*TypeOfAST)
+	if !ok || typeOf.Type == nil || typeOf.Type.Type != TYPE_INSTANCE || typeOf.Type.Indirection != 0 || typeOf.Type.Length != 0 {
+		return TavType{}, 0, false
+	}
+	sym := SymTable.Get(typeOf.Type.Instance)
+	if sym == nil {
+		return TavType{}, 0, false
+	}
+	decl, ok := sym.Value.(*StructAST)
+	i, folded := Fold(index.Index, SymTable)
+	if !ok || !folded || !i.Type.IsInt() || i.Value.Int < 0 || i.Value.Int >= int64(len(decl.Fields)) {
+		return TavType{}, 0, false
+	}
+	return *typeOf.Type, int(i.Value.Int), true
+}
+
+// give a folded literal the span of the expression it replaces
+func WithSpan(expression AST) func(*LiteralAST, bool) (*LiteralAST, bool) {
+	return func(lit *LiteralAST, ok bool) (*LiteralAST, bool) {
+		if ok {
+			lit.Range = expression.Span()
+		}
+		return lit, ok
+	}
+}
+
+func FoldCast(val *LiteralAST, to TavType) (*LiteralAST, bool) {
+	result := &LiteralAST{Type: to}
+	switch {
+	case val.Type.IsInt() && to.IsInt():
+		result.Value.Int = val.Value.Int
+	case val.Type.IsInt() && to.IsFloat():
+		result.Value.Float = float64(val.Value.Int)
+	case val.Type.IsFloat() && to.IsFloat():
+		result.Value.Float = val.Value.Float
+	case val.Type.IsFloat() && to.IsInt():
+		result.Value.Int = int64(val.Value.Float)
+	default:
+		return nil, false
+	}
+	return result, true
+}
+
+func FoldUnary(operator uint32, right *LiteralAST) (*LiteralAST, bool) {
+	if right.Untyped && right.Type.IsInt() {
+		switch operator {
+		case WIGGLE:
+			return Untyped(right.Type, new(big.Int).Not(right.Exact()))
+		case MINUS:
+			return Untyped(right.Type, new(big.Int).Neg(right.Exact()))
+		}
+	}
+	switch {
+	case operator == BANG && right.Type.Type == TYPE_BOOL:
+		return &LiteralAST{Type: right.Type, Value: TavValue{Bool: !right.Value.Bool}}, true
+	case operator == WIGGLE && right.Type.IsInt():
+		return &LiteralAST{Type: right.Type, Value: TavValue{Int: ^right.Value.Int}, Untyped: right.Untyped}, true
+	case operator == MINUS && right.Type.IsInt():
+		return &LiteralAST{Type: right.Type, Value: TavValue{Int: -right.Value.Int}, Untyped: right.Untyped}, true
+	case operator == MINUS && right.Type.IsFloat():
+		return &LiteralAST{Type: right.Type, Value: TavValue{Float: -right.Value.Float}, Untyped: right.Untyped}, true
+	}
+	return nil, false
+}
+
+func FoldBinary(operator uint32, left, right *LiteralAST) (*LiteralAST, bool) {
+	boolean := NewTavType(TYPE_BOOL, "", 0, nil)
+	// an untyped constant adopts the type of the other side
+	joined, untyped := left.Type, left.Untyped && right.Untyped
+	if left.Untyped && !right.Untyped {
+		joined = right.Type
+	}
+	switch {
+	case untyped && left.Type.IsInt() && right.Type.IsInt():
+		return FoldUntyped(operator, left, right)
+	case left.Type.IsInt() && right.Type.IsInt():
+		l, r := left.Value.Int, right.Value.Int
+		result := &LiteralAST{Type: joined, Untyped: untyped}
+		switch operator {
+		case PLUS:
+			result.Value.Int = l + r
+		case MINUS:
+			result.Value.Int = l - r
+		case STAR:
+			result.Value.Int = l * r
+		case DIV:
+			if r == 0 {
+				return nil, false
+			}
+			if joined.IsUnsigned() {
+				result.Value.Int = int64(uint64(l) / uint64(r))
+			} else {
+				result.Value.Int = l / r
+			}
+		case BIN_AND:
+			result.Value.Int = l & r
+		case BIN_OR:
+			result.Value.Int = l | r
+		case SLEFT:
+			result.Value.Int = l << uint64(r)
+		case SRIGHT:
+			if joined.IsUnsigned() {
+				result.Value.Int = int64(uint64(l) >> uint64(r))
+			} else {
+				result.Value.Int = l >> uint64(r)
+			}
+		case EQUALS:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l == r}}, true
+		case NOT_EQUALS:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l != r}}, true
+		case LESS_THAN:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l < r}}, true
+		case LESS_EQUAL:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l <= r}}, true
+		case GREAT_THAN:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l > r}}, true
+		case GREAT_EQUAL:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l >= r}}, true
+		default:
+			return nil, false
+		}
+		return result, true
+	case left.Type.IsFloat() && right.Type.IsFloat():
+		l, r := left.Value.Float, right.Value.Float
+		result := &LiteralAST{Type: joined, Untyped: untyped}
+		switch operator {
+		case PLUS:
+			result.Value.Float = l + r
+		case MINUS:
+			result.Value.Float = l - r
+		case STAR:
+			result.Value.Float = l * r
+		case DIV:
+			result.Value.Float = l / r
+		case EQUALS:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l == r}}, true
+		case NOT_EQUALS:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l != r}}, true
+		case LESS_THAN:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l < r}}, true
+		case LESS_EQUAL:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l <= r}}, true
+		case GREAT_THAN:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l > r}}, true
+		case GREAT_EQUAL:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l >= r}}, true
+		default:
+			return nil, false
+		}
+		return result, true
+	case left.Type.Type == TYPE_BOOL && right.Type.Type == TYPE_BOOL:
+		l, r := left.Value.Bool, right.Value.Bool
+		switch operator {
+		case AND:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l && r}}, true
+		case OR:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l || r}}, true
+		case EQUALS:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l == r}}, true
+		case NOT_EQUALS:
+			return &LiteralAST{Type: boolean, Value: TavValue{Bool: l != r}}, true
+		}
+	}
+	return nil, false
+}
+
+// fold a binary expression of 2 untyped integers, the result is exact rather than wrapping around
+func FoldUntyped(operator uint32, left, right *LiteralAST) (*LiteralAST, bool) {
+	boolean := NewTavType(TYPE_BOOL, "", 0, nil)
+	l, r := left.Exact(), right.Exact()
+	result := new(big.Int)
+	switch operator {
+	case PLUS:
+		result.Add(l, r)
+	case MINUS:
+		result.Sub(l, r)
+	case STAR:
+		result.Mul(l, r)
+	case DIV:
+		if r.Sign() == 0 {
+			return nil, false
+		}
+		result.Quo(l, r)
+	case BIN_AND:
+		result.And(l, r)
+	case BIN_OR:
+		result.Or(l, r)
+	case SLEFT, SRIGHT:
+		// nothing can be shifted further than the width of a u64
+		if r.Sign() < 0 || r.Cmp(big.NewInt(64)) > 0 {
+			return nil, false
+		}
+		if operator == SLEFT {
+			result.Lsh(l, uint(r.Uint64()))
+		} else {
+			result.Rsh(l, uint(r.Uint64()))
+		}
+	case EQUALS:
+		return &LiteralAST{Type: boolean, Value: TavValue{Bool: l.Cmp(r) == 0}}, true
+	case NOT_EQUALS:
+		return &LiteralAST{Type: boolean, Value: TavValue{Bool: l.Cmp(r) != 0}}, true
+	case LESS_THAN:
+		return &LiteralAST{Type: boolean, Value: TavValue{Bool: l.Cmp(r) < 0}}, true
+	case LESS_EQUAL:
+		return &LiteralAST{Type: boolean, Value: TavValue{Bool: l.Cmp(r) <= 0}}, true
+	case GREAT_THAN:
+		return &LiteralAST{Type: boolean, Value: TavValue{Bool: l.Cmp(r) > 0}}, true
+	case GREAT_EQUAL:
+		return &LiteralAST{Type: boolean, Value: TavValue{Bool: l.Cmp(r) >= 0}}, true
+	default:
+		return nil, false
+	}
+	return Untyped(left.Type, result)
+}
+
+// make an untyped integer with an exact value, returns false if no integer type could hold the value
+func Untyped(tavType TavType, value *big.Int) (*LiteralAST, bool) {
+	if !value.IsUint64() && !new(big.Int).Neg(value).IsUint64() {
+		return nil, false
+	}
+	lit := &LiteralAST{Type: tavType, Untyped: true, Negative: value.Sign() < 0}
+	lit.Magnitude = new(big.Int).Abs(value).Uint64()
+	lit.Value.Int = int64(lit.Magnitude)
+	if lit.Negative {
+		lit.Value.Int = -lit.Value.Int
+	}
+	return lit, true
+}
+
+// the exact value of an untyped integer
+func (LiteralAST *LiteralAST) Exact() *big.Int {
+	value := new(big.Int).SetUint64(LiteralAST.Magnitude)
+	if LiteralAST.Negative {
+		value.Neg(value)
+	}
+	return value
+}
+
+// get the value of a constant as it would be written in source
+func (LiteralAST *LiteralAST) String() string {
+	switch {
+	case LiteralAST.Untyped && LiteralAST.Type.IsInt():
+		return LiteralAST.Exact().String()
+	case LiteralAST.Type.Type == TYPE_U64:
+		return strconv.FormatUint(uint64(LiteralAST.Value.Int), 10)
+	case LiteralAST.Type.IsInt():
+		return strconv.FormatInt(LiteralAST.Value.Int, 10)
+	case LiteralAST.Type.IsFloat():
+		return strconv.FormatFloat(LiteralAST.Value.Float, 'g', -1, 64)
+	case LiteralAST.Type.Type == TYPE_BOOL:
+		return strconv.FormatBool(LiteralAST.Value.Bool)
+	}
+	return strconv.Quote(string(LiteralAST.Value.String))
+}
@@ -17,21 +17,39 @@ type Generator struct {
 	// block to branch to if we need to break out of a block
 	BreakBlock	 *ir.Block
 	CurrentFn    *ir.Func
-	// the generator symbol table contains only value.Value
+	// the global scope built by the resolver, used to look up types
 	SymTable *SymTable
 	Compiler *Compiler
 	FnBlockCount uint32
+	// what was emitted for each symbol (e.g. an alloca, a global or a function), by the symbol's id
+	Values map[uint32]value.Value
+	// the llvm type of each struct and union, by the symbol's id
+	Types map[uint32]types.Type
+	// string literals are interned as private globals, so each distinct string is only emitted once
+	Strings map[string]*ir.Global
+	// the wrapper of each named function that lets it be called like a closure
+	Thunks map[*ir.Func]*ir.Func
+	// the wrapper of each method that lets it be called through an interface
+	Dispatchers map[*ir.Func]*ir.Func
+	// the vtable of each struct for each interface it is used as, by the name of the vtable
+	VTables map[string]*ir.Global
+	// the number of closures emitted so far, used to name them
+	Closures int
+	// the TypeInfo of each type used as an any or with type_of, by the name of the global
+	TypeInfos map[string]*ir.Global
 }
 
 func (Generator *Generator) PrintfProto() *ir.Func {
-	f := Generator.Module.NewFunc("printf", types.I32, ir.NewParam("formatter", types.I8Ptr), ir.NewParam("value", types.I32))
-	Generator.SymTable.Add("printf", NewTavType(TYPE_FN, "", 0, nil), f)
+	// the values to format can be of any type
+	f := Generator.Module.NewFunc("printf", types.I32, ir.NewParam("formatter", types.I8Ptr))
+	f.Sig.Variadic = true
+	Generator.Values[Generator.SymTable.Get("printf").Id] = f
 	return f
 }
 
 func (Generator *Generator) PutsProto() *ir.Func {
 	f := Generator.Module.NewFunc("puts", types.I32, ir.NewParam("string", types.I8Ptr))
-	Generator.SymTable.Add("puts", NewTavType(TYPE_FN, "", 0, nil), f)
+	Generator.Values[Generator.SymTable.Get("puts").Id] = f
 	return f
 }
 
@@ -45,68 +63,377 @@ func ValueFromType(tavType TavType, TavValue TavValue) value.Value {
 			val = 0
 		}
 		return constant.NewInt(types.I1, val)
-	case TYPE_I8:
+	case TYPE_I8, TYPE_U8:
 		return constant.NewInt(types.I8, TavValue.Int)
-	case TYPE_I16:
+	case TYPE_I16, TYPE_U16:
 		return constant.NewInt(types.I16, TavValue.Int)
-	case TYPE_I32:
+	case TYPE_I32, TYPE_U32, TYPE_RUNE:
 		return constant.NewInt(types.I32, TavValue.Int)
-	case TYPE_I64:
+	case TYPE_I64, TYPE_U64:
 		return constant.NewInt(types.I64, TavValue.Int)
 	case TYPE_F32:
 		return constant.NewFloat(types.Float, TavValue.Float)
 	case TYPE_F64:
 		return constant.NewFloat(types.Double, TavValue.Float)
 	case TYPE_STRING:
-		//return constant.NewBitCast(constant.NewPtrToInt(constant.NewCharArray(TavValue.String), types.I8Ptr), types.I8Ptr)
-		return constant.NewCharArray(TavValue.String)
+		// strings are stored as a null terminated character array
+		return constant.NewCharArrayFromString(string(TavValue.String) + "\000")
 	}
 	return nil
 }
 
+// lower a tav type to its llvm type
+func (generator *Generator) ConvertType(tavType TavType) types.Type {
+	if tavType.Length > 0 {
+		return types.NewArray(tavType.Length, generator.ConvertType(ElemType(tavType)))
+	}
+	if tavType.Indirection > 0 {
+		tavType.Indirection--
+		return types.NewPointer(generator.ConvertType(tavType))
+	}
+	switch tavType.Type {
+	case TYPE_BOOL:
+		return types.I1
+	case TYPE_I8, TYPE_U8:
+		return types.I8
+	case TYPE_I16, TYPE_U16:
+		return types.I16
+	case TYPE_I32, TYPE_U32, TYPE_RUNE:
+		return types.I32
+	case TYPE_I64, TYPE_U64:
+		return types.I64
+	case TYPE_F32:
+		return types.Float
+	case TYPE_F64:
+		return types.Double
+	case TYPE_STRING:
+		return types.I8Ptr
+	case TYPE_FN:
+		// a function used as a value is a pointer to its code along with the environment it was
+		// created in, the code takes the environment as its first paramater
+		return types.NewStruct(types.NewPointer(generator.Signature(tavType, true)), types.I8Ptr)
+	case TYPE_INSTANCE:
+		return generator.Types[generator.SymTable.Get(tavType.Instance).Id]
+	case TYPE_ANY:
+		// an any is the TypeInfo of the value it holds and a pointer to a copy of the value
+		return types.NewStruct(types.NewPointer(generator.Types[generator.SymTable.Get("TypeInfo").Id]), types.I8Ptr)
+	}
+	return types.Void
+}
+
+// get the llvm signature of a function type, closures take their environment as the first paramater
+func (generator *Generator) Signature(tavType TavType, env bool) *types.FuncType {
+	retType := types.Type(types.Void)
+	if tavType.RetType != nil {
+		retType = generator.ConvertType(*tavType.RetType)
+	}
+	var params []types.Type
+	if env {
+		params = append(params, types.I8Ptr)
+	}
+	for _, param := range tavType.Params {
+		params = append(params, generator.ConvertType(param))
+	}
+	sig := types.NewFunc(retType, params...)
+	sig.Variadic = tavType.Variadic
+	return sig
+}
+
 func (generator *Generator) VisitRootAST(RootAST *RootAST) interface{} {
 	generator.PrintfProto()
 	generator.PutsProto()
+	// generic declerations are only generated through their instances
+	var statements []AST
 	for _, statement := range RootAST.Statements {
-		statement.Visit(generator)
+		if !IsGenericDecl(statement) {
+			statements = append(statements, statement)
+		}
+	}
+	// every type and function is declared before any body is emitted, so the order of top level
+	// declerations doesn't matter
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *StructAST:
+			generator.TypeDef(statement.Identifier, statement.Symbol)
+		case *UnionAST:
+			generator.TypeDef(statement.Identifier, statement.Symbol)
+		case *InterfaceAST:
+			generator.TypeDef(statement.Identifier, statement.Symbol)
+		}
+	}
+	// unions are defined after every struct and interface, since their size depends on the size of their variants
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *StructAST, *InterfaceAST:
+			statement.Visit(generator)
+		}
+	}
+	for _, statement := range statements {
+		if u, ok := statement.(*UnionAST); ok {
+			u.Visit(generator)
+		}
+	}
+	// functions are declared before globals, so a global can start as any of them
+	for _, statement := range statements {
+		if f, ok := statement.(*FnAST); ok {
+			generator.Prototype(f)
+		}
+	}
+	for _, statement := range statements {
+		if def, ok := statement.(*VarDefAST); ok {
+			generator.Global(def)
+		}
+	}
+	for _, statement := range statements {
+		if f, ok := statement.(*FnAST); ok {
+			f.Visit(generator)
+		}
 	}
 	return nil
 }
 
+// emit a global variable, the checker has already folded the initialiser into a constant
+func (generator *Generator) Global(VarDefAST *VarDefAST) {
+	if VarDefAST.Constant {
+		VarDefAST.Visit(generator)
+		return
+	}
+	identifier := VarDefAST.Identifier.Lexme()
+	t := generator.ConvertType(VarDefAST.Type)
+	var init constant.Constant = constant.NewZeroInitializer(t)
+	switch assignment := VarDefAST.Assignment.(type) {
+	case *LiteralAST:
+		init = generator.Const(assignment)
+	case *StructLitAST:
+		init, _ = generator.ConstStruct(t.(*types.StructType), generator.StructLitValues(assignment.Identifier.Lexme(), assignment))
+	case *VariableAST, *CallAST:
+		// a named function, its value is a constant
+		init = assignment.Visit(generator).(constant.Constant)
+	case nil:
+		if generator.IsStruct(VarDefAST.Type) {
+			init = generator.DefaultStruct(VarDefAST.Type)
+		} else if VarDefAST.Type.Length > 0 && generator.IsStruct(ElemType(VarDefAST.Type)) {
+			// every element of an array of structs starts with the struct's default values
+			elems := make([]constant.Constant, VarDefAST.Type.Length)
+			for i := range elems {
+				elems[i] = generator.DefaultStruct(ElemType(VarDefAST.Type))
+			}
+			init = constant.NewArray(t.(*types.ArrayType), elems...)
+		}
+	}
+	generator.Values[VarDefAST.Symbol.Id] = generator.Module.NewGlobalDef(identifier, init)
+}
+
+// get the constant value of a literal, strings are a pointer to the first character of their interned global
+func (generator *Generator) Const(LiteralAST *LiteralAST) constant.Constant {
+	if LiteralAST.Type.Type == TYPE_STRING {
+		global := generator.String(LiteralAST)
+		return constant.NewGetElementPtr(global.ContentType, global, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0))
+	}
+	return ValueFromType(LiteralAST.Type, LiteralAST.Value).(constant.Constant)
+}
+
+// intern a string literal as a private constant global, identical strings share the same global
+func (generator *Generator) String(LiteralAST *LiteralAST) *ir.Global {
+	str := string(LiteralAST.Value.String)
+	if global, ok := generator.Strings[str]; ok {
+		return global
+	}
+	global := generator.Module.NewGlobalDef(fmt.Sprintf(".str.%d", len(generator.Strings)), ValueFromType(LiteralAST.Type, LiteralAST.Value).(constant.Constant))
+	global.Linkage = enum.LinkagePrivate
+	global.UnnamedAddr = enum.UnnamedAddrUnnamedAddr
+	global.Immutable = true
+	generator.Strings[str] = global
+	return global
+}
+
 // TODO read this https://mapping-high-level-constructs-to-llvm-ir.readthedocs.io/en/latest/basic-constructs/casts.html
 func (generator *Generator) VisitCastAST(CastAST *CastAST) interface{} {
+	val := CastAST.Expr.Visit(generator).(value.Value)
 	b := generator.Block()
+	to := generator.ConvertType(CastAST.TavType)
+	from := InferType(CastAST.Expr, generator.SymTable)
+	switch {
+	case CastAST.Checked:
+		return generator.Unbox(val, CastAST.TavType)
+	case CastAST.TavType.IsAny() && !from.IsAny():
+		return generator.Box(val, from, CastAST.Escapes)
+	case from.IsAny() && !CastAST.TavType.IsAny():
+		// the checker only allows pointers, which point at the value without checking its type
+		return b.NewBitCast(b.NewExtractValue(val, 1), to)
+	case generator.Interface(to) != nil:
+		// a variable the interface outlives was put on the heap by the escape analysis, any other struct is copied there
+		if _, ok := CastAST.Expr.(*VariableAST); CastAST.Escapes && !ok {
+			t := generator.ConvertType(from)
+			heap := generator.Alloc(t, true)
+			b.NewStore(generator.Coerce(val, t), heap)
+			val = heap
+		}
+		return generator.Implementation(val, to.(*types.StructType), generator.Interface(to))
+	}
 	// if the type is a pointer, we perform a bitcast (this doesn't modify the bits in the value)
-	if CastAST.TavType.Indirection > 0{
-		return b.NewBitCast(CastAST.Expr.Visit(generator).(value.Value), ConvertType(CastAST.TavType, generator.SymTable))
+	if CastAST.TavType.Indirection > 0 {
+		return b.NewBitCast(val, to)
 	}
 
 	// check which cast type we require by analysing the conversion pattern
-	from := CastAST.TavType
-	to   := InferType(CastAST.Expr, generator.SymTable)
+	switch {
+	case (from.IsInt() || from.Type == TYPE_BOOL) && CastAST.TavType.IsInt():
+		fromSize, toSize := val.Type().(*types.IntType).BitSize, to.(*types.IntType).BitSize
+		if toSize < fromSize {
+			return b.NewTrunc(val, to)
+		} else if toSize > fromSize && (from.IsUnsigned() || from.Type == TYPE_BOOL) {
+			return b.NewZExt(val, to)
+		} else if toSize > fromSize {
+			return b.NewSExt(val, to)
+		}
+	case from.IsInt() && CastAST.TavType.IsFloat():
+		if from.IsUnsigned() {
+			return b.NewUIToFP(val, to)
+		}
+		return b.NewSIToFP(val, to)
+	case from.IsFloat() && CastAST.TavType.IsInt():
+		if CastAST.TavType.IsUnsigned() {
+			return b.NewFPToUI(val, to)
+		}
+		return b.NewFPToSI(val, to)
+	case from.IsFloat() && CastAST.TavType.IsFloat():
+		if from.Type == TYPE_F32 && CastAST.TavType.Type == TYPE_F64 {
+			return b.NewFPExt(val, to)
+		} else if from.Type == TYPE_F64 && CastAST.TavType.Type == TYPE_F32 {
+			return b.NewFPTrunc(val, to)
+		}
+	}
+	return val
+}
 
-	if (from.Type == TYPE_I8 ||from.Type == TYPE_I16 || from.Type == TYPE_I32 || from.Type == TYPE_I32) &&
-		(to.Type == TYPE_F32 || to.Type == TYPE_F64){
-		return b.NewSIToFP(CastAST.Expr.Visit(generator).(value.Value), ConvertType(CastAST.TavType, generator.SymTable))
+// box a value to use it as an any, the any points at a copy of the value on the stack, or on the heap
+// if the box can outlive the function
+func (generator *Generator) Box(val value.Value, from TavType, heap bool) value.Value {
+	t := generator.ConvertType(from)
+	val = generator.Coerce(val, t)
+	data := generator.Alloc(t, heap)
+	b := generator.Block()
+	b.NewStore(val, data)
+	box := b.NewInsertValue(constant.NewUndef(generator.ConvertType(NewTavType(TYPE_ANY, "", 0, nil))), generator.TypeInfo(from), 0)
+	return b.NewInsertValue(box, b.NewBitCast(data, types.I8Ptr), 1)
+}
+
+// get the value an any holds e.g. x.(i32), the program exits if it holds a value of another type
+func (generator *Generator) Unbox(val value.Value, to TavType) value.Value {
+	b := generator.Block()
+	info := b.NewExtractValue(val, 0)
+	ok := generator.NewBlock(fmt.Sprintf("unbox_ok_%d", generator.FnBlockCount))
+	fail := generator.NewBlock(fmt.Sprintf("unbox_fail_%d", generator.FnBlockCount))
+	b.NewCondBr(b.NewICmp(enum.IPredEQ, info, generator.TypeInfo(to)), ok, fail)
+
+	infoType := generator.Types[generator.SymTable.Get("TypeInfo").Id]
+	name := fail.NewLoad(types.I8Ptr, fail.NewGetElementPtr(infoType, info, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 2)))
+	msg := generator.Const(&LiteralAST{Type: NewTavType(TYPE_STRING, "", 0, nil), Value: TavValue{String: []byte("any holds %s, not " + to.String() + "\n")}})
+	fail.NewCall(generator.Extern("printf", types.I32, ir.NewParam("formatter", types.I8Ptr)), msg, name)
+	fail.NewCall(generator.Extern("exit", types.Void, ir.NewParam("status", types.I32)), constant.NewInt(types.I32, 1))
+	fail.NewUnreachable()
+
+	generator.PushBlock(ok)
+	data := ok.NewBitCast(ok.NewExtractValue(val, 1), types.NewPointer(generator.ConvertType(to)))
+	// like variables, structs and arrays are used through a pointer to them
+	if to.Length > 0 || (to.Type == TYPE_INSTANCE && to.Indirection == 0) {
+		return data
 	}
+	return ok.NewLoad(generator.ConvertType(to), data)
+}
 
-	switch CastAST.TavType.Type{
-	case TYPE_I8:
-		return b.NewTrunc(CastAST.Expr.Visit(generator).(value.Value), ConvertType(CastAST.TavType, generator.SymTable))
-	case TYPE_F64:
-		return b.NewFPExt(CastAST.Expr.Visit(generator).(value.Value), ConvertType(CastAST.TavType, generator.SymTable))
+// the TypeInfo of a type, emitted the first time the type is used as an any or with type_of. each type
+// has one TypeInfo, so an any holds a value of a type if it points at the type's TypeInfo
+func (generator *Generator) TypeInfo(t TavType) *ir.Global {
+	name := "typeinfo." + t.String()
+	if info, ok := generator.TypeInfos[name]; ok {
+		return info
 	}
-	return nil
+	infoType := generator.Types[generator.SymTable.Get("TypeInfo").Id].(*types.StructType)
+	fieldType := generator.Types[generator.SymTable.Get("TypeField").Id].(*types.StructType)
+	// the global is added before it is filled in, so a type can refer to itself e.g. next : *Node
+	info := generator.Module.NewGlobal(name, infoType)
+	info.Immutable = true
+	generator.TypeInfos[name] = info
+
+	var elem constant.Constant = constant.NewNull(types.NewPointer(infoType))
+	var fields constant.Constant = constant.NewNull(types.NewPointer(fieldType))
+	var count int64
+	packed := false
+	if t.Length > 0 || t.Indirection > 0 {
+		elem, count = generator.TypeInfo(ElemType(t)), int64(t.Length)
+	} else if generator.IsStruct(t) {
+		structType := generator.ConvertType(t).(*types.StructType)
+		var values []constant.Constant
+		for i, field := range generator.SymTable.Get(t.Instance).Fields() {
+			values = append(values, constant.NewStruct(fieldType, generator.Const(&LiteralAST{Type: NewTavType(TYPE_STRING, "", 0, nil), Value: TavValue{String: []byte(field.Identifier)}}),
+				generator.TypeInfo(field.Type), constant.NewInt(types.I64, int64(OffsetOf(structType, i)))))
+		}
+		if len(values) > 0 {
+			array := generator.Module.NewGlobalDef(name+".fields", constant.NewArray(types.NewArray(uint64(len(values)), fieldType), values...))
+			array.Immutable = true
+			fields = constant.NewGetElementPtr(array.ContentType, array, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0))
+		}
+		count, packed = int64(len(values)), structType.Packed
+	}
+	str := generator.Const(&LiteralAST{Type: NewTavType(TYPE_STRING, "", 0, nil), Value: TavValue{String: []byte(t.String())}})
+	info.Init = constant.NewStruct(infoType, constant.NewInt(types.I32, generator.Kind(t)), constant.NewInt(types.I64, int64(SizeOf(generator.ConvertType(t)))),
+		str, elem, constant.NewInt(types.I64, count), fields, constant.NewBool(packed))
+	return info
+}
+
+// the kind of a type stored in its TypeInfo, one of the KIND_ constants
+func (generator *Generator) Kind(t TavType) int64 {
+	switch {
+	case t.Length > 0:
+		return KIND_ARRAY
+	case t.Indirection > 0:
+		return KIND_POINTER
+	case t.Type == TYPE_RUNE:
+		return KIND_RUNE
+	case t.IsUnsigned():
+		return KIND_UINT
+	case t.IsInt():
+		return KIND_INT
+	case t.IsFloat():
+		return KIND_FLOAT
+	}
+	switch t.Type {
+	case TYPE_BOOL:
+		return KIND_BOOL
+	case TYPE_STRING:
+		return KIND_STRING
+	case TYPE_FN:
+		return KIND_FN
+	case TYPE_ANY:
+		return KIND_ANY
+	case TYPE_INSTANCE:
+		switch generator.SymTable.Get(t.Instance).Type.Type {
+		case TYPE_STRUCT:
+			return KIND_STRUCT
+		case TYPE_UNION:
+			return KIND_UNION
+		case TYPE_INTERFACE:
+			return KIND_INTERFACE
+		}
+	}
+	return KIND_VOID
 }
 
 func (generator *Generator) VisitVarSetAST(VarSetAST *VarSetAST) interface{} {
-	variable := generator.SymTable.Get(VarSetAST.Identifier.Lexme()).Value
-	val := generator.Block().NewStore(VarSetAST.Value.Visit(generator).(value.Value), variable.(value.Value))
-	return val
+	variable := generator.Values[VarSetAST.Symbol.Id]
+	val := generator.Coerce(VarSetAST.Value.Visit(generator).(value.Value), generator.ConvertType(VarSetAST.Symbol.Type))
+	return generator.Block().NewStore(val, variable)
 }
 
 func (generator *Generator) VisitReturnAST(ReturnAST *ReturnAST) interface{} {
-	generator.Block().NewRet(ReturnAST.Value.Visit(generator).(value.Value))
+	if ReturnAST.Value == nil {
+		generator.Block().NewRet(nil)
+		return nil
+	}
+	val := generator.Coerce(ReturnAST.Value.Visit(generator).(value.Value), generator.CurrentFn.Sig.RetType)
+	generator.Block().NewRet(val)
 	return nil
 }
 
@@ -120,34 +447,50 @@ func (generator *Generator) VisitForAST(ForAST *ForAST) interface{} {
 	forCond:=generator.NewBlock(fmt.Sprintf("for_cond_%d",generator.FnBlockCount));
 	forBody:=generator.NewBlock(fmt.Sprintf("for_body_%d",generator.FnBlockCount));
 	forEnd:=generator.NewBlock(fmt.Sprintf("for_end_%d",generator.FnBlockCount));
-	generator.PushBlock(forCond)
-	// TODO gcc doesn't seem to like this
-	forCond.NewCondBr(ForAST.Condition.Visit(generator).(value.Value), forBody, forEnd)
-	generator.ExitBlock()
+	// branch to the for condition
+	generator.Block().NewBr(forCond)
+	depth := len(generator.CurrentBlock)
 
+	generator.PushBlock(forCond)
+	// the condition can end in another block e.g. after checking the type an any holds
+	cond := ForAST.Condition.Visit(generator).(value.Value)
+	generator.Block().NewCondBr(cond, forBody, forEnd)
+	generator.CurrentBlock = generator.CurrentBlock[:depth]
 
+	// nested loops have their own break block, so restore ours afterwards
+	breakBlock := generator.BreakBlock
 	generator.BreakBlock = forEnd
-
 	generator.PushBlock(forBody)
-	generator.SymTable.NewScope(fmt.Sprintf("for_body_%d",generator.FnBlockCount))
 	ForAST.Body.Visit(generator)
-	forBody.NewBr(forCond)
-	generator.SymTable.PopScope()
-	generator.ExitBlock()
+	generator.Terminate(forCond)
+	generator.CurrentBlock = generator.CurrentBlock[:depth]
+	generator.BreakBlock = breakBlock
 
-	// branch to the for condition
-	generator.Block().NewBr(forCond)
 	// now we have finished the for
 	generator.PushBlock(forEnd)
+	return nil
+}
 
+// branch to a block at the end of a body, unless the body already ended in a ret or break
+func (generator *Generator) Terminate(target *ir.Block) {
+	if generator.Block().Term == nil {
+		generator.Block().NewBr(target)
+	}
+}
 
-	return nil
+// emit a list of statements, once the block has been terminated (e.g. by a ret) the rest are unreachable
+func (generator *Generator) Statements(statements []AST) {
+	for _, stmt := range statements {
+		if generator.Block().Term != nil {
+			return
+		}
+		stmt.Visit(generator)
+	}
 }
 
 func (generator *Generator) VisitIfAST(IfAST *IfAST) interface{} {
 
 	// first create the relevant blocks
-	ifCond:=generator.Block()
 	ifBody:=generator.NewBlock(fmt.Sprintf("if_body_%d",generator.FnBlockCount));
 
 	var elifConditions []*ir.Block
@@ -164,45 +507,50 @@ func (generator *Generator) VisitIfAST(IfAST *IfAST) interface{} {
 	}
 
 	end:=generator.NewBlock(fmt.Sprintf("if_end_%d", generator.FnBlockCount))
+	// if none of the conditions are true we go to the else, or skip the if when there isn't one
+	next := end
+	if elseBody != nil {
+		next = elseBody
+	}
+	// the bodies may leave more blocks on the stack (e.g. a nested if), so restore the depth after each one
+	depth := len(generator.CurrentBlock)
 
+	// the condition can end in another block e.g. after checking the type an any holds
+	cond := IfAST.IfCondition.Visit(generator).(value.Value)
 	if len(elifConditions) > 0 {
-		ifCond.NewCondBr(IfAST.IfCondition.Visit(generator).(value.Value), ifBody, elifConditions[0])
+		generator.Block().NewCondBr(cond, ifBody, elifConditions[0])
 	}else{
-		ifCond.NewCondBr(IfAST.IfCondition.Visit(generator).(value.Value), ifBody, end)
+		generator.Block().NewCondBr(cond, ifBody, next)
 	}
+	generator.CurrentBlock = generator.CurrentBlock[:depth]
 	// process if body
 	generator.PushBlock(ifBody)
-	generator.SymTable.NewScope(fmt.Sprintf("if_body_%d",generator.FnBlockCount))
 	IfAST.IfBody.Visit(generator)
-	ifBody.NewBr(end)
-	generator.SymTable.PopScope()
-	generator.ExitBlock()
+	generator.Terminate(end)
+	generator.CurrentBlock = generator.CurrentBlock[:depth]
 
 	// process elif
 	for i:=0; i<len(IfAST.ElifCondition);i++{
 		generator.PushBlock(elifConditions[i])
+		cond := IfAST.ElifCondition[i].Visit(generator).(value.Value)
 		if i == len(IfAST.ElifCondition)-1{
-			elifConditions[i].NewCondBr(IfAST.ElifCondition[i].Visit(generator).(value.Value), elifBodies[i], end)
+			generator.Block().NewCondBr(cond, elifBodies[i], next)
 		}else{
-			elifConditions[i].NewCondBr(IfAST.ElifCondition[i].Visit(generator).(value.Value), elifBodies[i], elifConditions[i+1])
+			generator.Block().NewCondBr(cond, elifBodies[i], elifConditions[i+1])
 		}
-		generator.ExitBlock()
-		generator.SymTable.NewScope(fmt.Sprintf("elif_body_%d_%d", i, generator.FnBlockCount))
+		generator.CurrentBlock = generator.CurrentBlock[:depth]
 		generator.PushBlock(elifBodies[i])
 		IfAST.ElifBody[i].Visit(generator)
-		elifBodies[i].NewBr(end)
-		generator.SymTable.PopScope()
-		generator.ExitBlock()
+		generator.Terminate(end)
+		generator.CurrentBlock = generator.CurrentBlock[:depth]
 	}
 
 	// process else
 	if elseBody != nil {
-		generator.SymTable.NewScope(fmt.Sprintf("else_body_%d",generator.FnBlockCount))
 		generator.PushBlock(elseBody)
 		IfAST.ElseBody.Visit(generator)
-		elseBody.NewBr(end)
-		generator.ExitBlock()
-		generator.SymTable.PopScope()
+		generator.Terminate(end)
+		generator.CurrentBlock = generator.CurrentBlock[:depth]
 	}
 
 	// enter the if condition
@@ -211,243 +559,875 @@ func (generator *Generator) VisitIfAST(IfAST *IfAST) interface{} {
 	return nil
 }
 
-func (generator *Generator) VisitStructAST(StructAST *StructAST) interface{} {
-
-	// create a new symbol table for the struct members
-	generator.SymTable.NewScope(StructAST.Identifier.Lexme() + "_members")
-	// create a new symbol table containing the children
-	for _, member := range StructAST.Fields {
-		generator.SymTable.Add(member.Identifier.Lexme(), member.Type, nil)
+// get the llvm type of a struct or union, creating an empty named type if it hasn't been defined yet
+// so that types can refer to each other in any order
+func (generator *Generator) TypeDef(identifier *Token, symbol *Symbol) *types.StructType {
+	if t, ok := generator.Types[symbol.Id]; ok {
+		return t.(*types.StructType)
 	}
-	generator.SymTable.PopScope()
+	t := types.NewStruct()
+	generator.Types[symbol.Id] = t
+	generator.Module.NewTypeDef(identifier.Lexme(), t)
+	return t
+}
 
-	// add the struct to the symbol table
-	s := types.NewStruct()
-	generator.SymTable.Add(StructAST.Identifier.Lexme(), NewTavType(TYPE_STRUCT, "", 0, nil), s)
+func (generator *Generator) VisitStructAST(StructAST *StructAST) interface{} {
+	s := generator.TypeDef(StructAST.Identifier, StructAST.Symbol)
 	s.Packed = StructAST.Packed
 	for _, field := range StructAST.Fields {
-		s.Fields = append(s.Fields, ConvertType(field.Type, generator.SymTable))
+		s.Fields = append(s.Fields, generator.ConvertType(field.Type))
 	}
-	generator.Module.NewTypeDef(StructAST.Identifier.Lexme(), s)
 	return nil
 }
 
-func (generator *Generator) VisitFnAST(FnAST *FnAST) interface{} {
+func (generator *Generator) VisitUnionAST(UnionAST *UnionAST) interface{} {
+	u := generator.TypeDef(UnionAST.Identifier, UnionAST.Symbol)
+	// a union may already have been defined because another union contains it
+	if len(u.Fields) > 0 {
+		return nil
+	}
+	// the variants are stored in the members scope in declaration order, so the index is the tag
+	var payloadSize uint64
+	for _, variant := range UnionAST.Variants {
+		generator.Complete(variant.Type)
+		if size := SizeOf(generator.ConvertType(variant.Type)); size > payloadSize {
+			payloadSize = size
+		}
+	}
 
-	identifier := FnAST.Identifier.Lexme()
+	// a union is lowered to its tag followed by enough 8 byte words to hold the largest payload
+	u.Fields = []types.Type{types.I32, types.NewArray(AlignTo(payloadSize, 8)/8, types.I64)}
+	return nil
+}
 
-	// add each function paramater to the function body scope
-	generator.SymTable.NewScope(identifier + "_body")
-	var params []*ir.Param
-	for _, param := range FnAST.Params {
-		p := ir.NewParam(param.Identifier.Lexme(), ConvertType(param.Type, generator.SymTable))
+// an interface is lowered to a pointer to the struct behind it and a pointer to the struct's vtable,
+// which holds a function for each method in the order they are declared
+func (generator *Generator) VisitInterfaceAST(InterfaceAST *InterfaceAST) interface{} {
+	i := generator.TypeDef(InterfaceAST.Identifier, InterfaceAST.Symbol)
+	vtable := types.NewStruct()
+	for _, method := range InterfaceAST.Methods {
+		vtable.Fields = append(vtable.Fields, types.NewPointer(generator.Signature(method.Symbol.Type, true)))
+	}
+	generator.Module.NewTypeDef(InterfaceAST.Identifier.Lexme()+".vtable", vtable)
+	i.Fields = []types.Type{types.I8Ptr, types.NewPointer(vtable)}
+	return nil
+}
+
+// use a struct as an interface, the interface points at the struct rather than holding a copy
+func (generator *Generator) Implementation(val value.Value, ifaceType *types.StructType, iface *Symbol) value.Value {
+	if !types.IsPointer(val.Type()) {
+		val = generator.Addressable(val, val.Type())
+	}
+	s := generator.SymTable.Get(val.Type().(*types.PointerType).ElemType.Name())
+	b := generator.Block()
+	i := b.NewInsertValue(constant.NewUndef(ifaceType), b.NewBitCast(val, types.I8Ptr), 0)
+	return b.NewInsertValue(i, generator.VTable(s, iface), 1)
+}
+
+// the vtable of a struct for an interface, it is emitted the first time the struct is used as the interface
+func (generator *Generator) VTable(s *Symbol, iface *Symbol) *ir.Global {
+	name := s.Identifier + "." + iface.Identifier + ".vtable"
+	if vtable, ok := generator.VTables[name]; ok {
+		return vtable
+	}
+	vtableType := generator.Types[iface.Id].(*types.StructType).Fields[1].(*types.PointerType).ElemType.(*types.StructType)
+	var methods []constant.Constant
+	for i, method := range iface.Members.Symbols {
+		f := generator.Values[s.Members.Names[method.Identifier].Id].(*ir.Func)
+		methods = append(methods, constant.NewBitCast(generator.Dispatcher(f), vtableType.Fields[i]))
+	}
+	vtable := generator.Module.NewGlobalDef(name, constant.NewStruct(vtableType, methods...))
+	vtable.Immutable = true
+	generator.VTables[name] = vtable
+	return vtable
+}
+
+// wrap a method so that it takes an untyped pointer to its struct, which is all an interface has
+func (generator *Generator) Dispatcher(f *ir.Func) *ir.Func {
+	if dispatcher, ok := generator.Dispatchers[f]; ok {
+		return dispatcher
+	}
+	params := []*ir.Param{ir.NewParam("data", types.I8Ptr)}
+	var args []value.Value
+	for _, param := range f.Params[1:] {
+		p := ir.NewParam(param.Name(), param.Type())
 		params = append(params, p)
-		generator.SymTable.Add(param.Identifier.Lexme(), param.Type, p)
+		args = append(args, p)
+	}
+	dispatcher := generator.Module.NewFunc(f.Name()+".dispatch", f.Sig.RetType, params...)
+	b := dispatcher.NewBlock("dispatch_body")
+	// methods that take the struct by value are given a copy
+	self := f.Params[0].Type()
+	var recv value.Value
+	if types.IsPointer(self) {
+		recv = b.NewBitCast(params[0], self)
+	} else {
+		recv = b.NewLoad(self, b.NewBitCast(params[0], types.NewPointer(self)))
+	}
+	call := b.NewCall(f, append([]value.Value{recv}, args...)...)
+	if types.Equal(f.Sig.RetType, types.Void) {
+		b.NewRet(nil)
+	} else {
+		b.NewRet(call)
+	}
+	generator.Dispatchers[f] = dispatcher
+	return dispatcher
+}
+
+// look up a method in the vtable of an interface, returns the function and the struct to call it with
+func (generator *Generator) Dispatch(get *StructGetAST) (value.Value, value.Value) {
+	iface := generator.SymTable.Get(InferType(get.Struct, generator.SymTable).Instance)
+	ifaceType := generator.Types[iface.Id].(*types.StructType)
+	vtableType := ifaceType.Fields[1].(*types.PointerType).ElemType
+	val := generator.Coerce(get.Struct.Visit(generator).(value.Value), ifaceType)
+	b := generator.Block()
+	index := 0
+	for i, method := range iface.Members.Symbols {
+		if method == get.Method {
+			index = i
+		}
+	}
+	vtable := b.NewExtractValue(val, 1)
+	method := b.NewGetElementPtr(vtableType, vtable, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(index)))
+	return b.NewLoad(vtableType.(*types.StructType).Fields[index], method), b.NewExtractValue(val, 0)
+}
+
+// define any unions a type holds by value, so that its size is known
+func (generator *Generator) Complete(tavType TavType) {
+	if tavType.Type != TYPE_INSTANCE || tavType.Indirection > 0 {
+		return
 	}
+	switch decl := generator.SymTable.Get(tavType.Instance).Value.(type) {
+	case *UnionAST:
+		decl.Visit(generator)
+	case *StructAST:
+		for _, field := range decl.Fields {
+			generator.Complete(field.Type)
+		}
+	}
+}
+
+func (generator *Generator) VisitMatchAST(MatchAST *MatchAST) interface{} {
+	t := InferType(MatchAST.Value, generator.SymTable)
+	unionType := generator.ConvertType(t)
+	u := generator.Addressable(MatchAST.Value.Visit(generator).(value.Value), unionType)
+	b := generator.Block()
+	tag := b.NewLoad(types.I32, b.NewGetElementPtr(unionType, u, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0)))
 
-	// create the function, the function body and visit the function block
-	f := generator.Module.NewFunc(identifier, ConvertType(FnAST.RetType, generator.SymTable), params...)
+	// first create the relevant blocks
+	var caseBodies []*ir.Block
+	var cases []*ir.Case
+	for i, matchCase := range MatchAST.Cases {
+		_, index := generator.SymTable.Member(t.Instance, matchCase.Variant.Lexme())
+		caseBodies = append(caseBodies, generator.NewBlock(fmt.Sprintf("match_case_%d_%d", i, generator.FnBlockCount)))
+		cases = append(cases, ir.NewCase(constant.NewInt(types.I32, int64(index)), caseBodies[i]))
+	}
+	elseBody := generator.NewBlock(fmt.Sprintf("match_else_%d", generator.FnBlockCount))
+	end := generator.NewBlock(fmt.Sprintf("match_end_%d", generator.FnBlockCount))
+	b.NewSwitch(tag, elseBody, cases...)
+
+	// the body of a case may leave more blocks on the stack (e.g. a nested if), so restore the depth after each one
+	depth := len(generator.CurrentBlock)
+	for i, matchCase := range MatchAST.Cases {
+		generator.PushBlock(caseBodies[i])
+		if matchCase.Binding != nil {
+			// the binding refers directly to the payload, cast to the type of the variant
+			generator.Values[matchCase.Symbol.Id] = generator.UnionPayload(u, unionType, matchCase.Symbol.Type)
+		}
+		matchCase.Body.Visit(generator)
+		generator.Terminate(end)
+		generator.CurrentBlock = generator.CurrentBlock[:depth]
+	}
+
+	// the checker has made sure an exhaustive match can never reach the else block
+	generator.PushBlock(elseBody)
+	if MatchAST.ElseBody != nil {
+		MatchAST.ElseBody.Visit(generator)
+		generator.Terminate(end)
+	} else {
+		elseBody.NewUnreachable()
+	}
+	generator.CurrentBlock = generator.CurrentBlock[:depth]
+
+	// when every case returns nothing branches to the end, but the block still needs a terminator
+	if !Reached(end) {
+		end.NewUnreachable()
+	}
+	generator.PushBlock(end)
+	return nil
+}
+
+// check if any block in the function branches to a block
+func Reached(block *ir.Block) bool {
+	for _, b := range block.Parent.Blocks {
+		if b.Term == nil {
+			continue
+		}
+		for _, succ := range b.Term.Succs() {
+			if succ == block {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// get a pointer to the payload of a union, cast to the type of the variant
+func (generator *Generator) UnionPayload(u value.Value, unionType types.Type, variant TavType) value.Value {
+	b := generator.Block()
+	payload := b.NewGetElementPtr(unionType, u, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 1))
+	return b.NewBitCast(payload, types.NewPointer(generator.ConvertType(variant)))
+}
+
+// construct a union variant on the stack e.g. Shape.Circle(1.0), its space is reused each time the
+// constructor is evaluated
+func (generator *Generator) UnionCtor(union string, CallAST *CallAST) value.Value {
+	unionType := generator.ConvertType(NewTavType(TYPE_INSTANCE, union, 0, nil))
+	variant, tag := generator.SymTable.Member(union, CallAST.Caller.(*StructGetAST).Member.Lexme())
+	payload := generator.Coerce(CallAST.Args[0].Visit(generator).(value.Value), generator.ConvertType(variant.Type))
+
+	u := generator.Temp(unionType)
+	b := generator.Block()
+	b.NewStore(constant.NewInt(types.I32, int64(tag)), b.NewGetElementPtr(unionType, u, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0)))
+	b.NewStore(payload, generator.UnionPayload(u, unionType, variant.Type))
+	return u
+}
+
+func (generator *Generator) VisitFnAST(FnAST *FnAST) interface{} {
+	identifier := FnAST.Identifier.Lexme()
+	f := generator.Prototype(FnAST)
 	generator.CurrentFn = f
-	b := f.NewBlock(identifier + "_body")
-	generator.CurrentBlock = append(generator.CurrentBlock, b) // push the block to the stack
-	for _, stmt := range FnAST.Body {
-		stmt.Visit(generator)
+	// prototypes are only declared, the definition is linked in
+	if !FnAST.Proto {
+		depth := len(generator.CurrentBlock)
+		b := f.NewBlock(identifier + "_body")
+		generator.CurrentBlock = append(generator.CurrentBlock, b) // push the block to the stack
+		generator.Body(FnAST)
+		generator.CurrentBlock = generator.CurrentBlock[:depth] // pop the blocks from the stack
+	}
+	return f
+}
+
+// emit the statements of a function into the current block
+func (generator *Generator) Body(FnAST *FnAST) {
+	// paramaters are moved to storage in the entry block, so their address can be taken anywhere in the body.
+	// one captured by a closure that can outlive the function is stored on the heap
+	for _, param := range FnAST.Params {
+		val := generator.Alloc(generator.ConvertType(param.Type), param.Symbol.Heap)
+		generator.Block().NewStore(generator.Values[param.Symbol.Id], val)
+		generator.Values[param.Symbol.Id] = val
 	}
-	if FnAST.RetType.Type == TYPE_VOID{
+	generator.Statements(FnAST.Body)
+	// the checker has made sure a function that returns a value can't reach the end
+	if generator.Block().Term == nil && FnAST.RetType.Type == TYPE_VOID && FnAST.RetType.Indirection == 0 {
 		generator.Block().NewRet(nil)
+	} else if generator.Block().Term == nil {
+		generator.Block().NewUnreachable()
 	}
-	generator.CurrentBlock = generator.CurrentBlock[:len(generator.CurrentBlock)-1] // pop the block from the stack
+}
+
+func (generator *Generator) VisitClosureAST(ClosureAST *ClosureAST) interface{} {
+	// the environment holds a pointer to each captured variable, so the closure sees any changes to them
+	var fields []types.Type
+	for _, capture := range ClosureAST.Captures {
+		fields = append(fields, types.NewPointer(generator.ConvertType(capture.Type)))
+	}
+	envType := types.NewStruct(fields...)
+	f := generator.Lift(ClosureAST, envType)
+
+	b := generator.Block()
+	var env value.Value = constant.NewNull(types.I8Ptr)
+	if len(ClosureAST.Captures) > 0 {
+		// the checker has decided if the closure can outlive this function
+		ptr := generator.Alloc(envType, ClosureAST.Escapes)
+		for i, capture := range ClosureAST.Captures {
+			field := b.NewGetElementPtr(envType, ptr, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(i)))
+			// paramaters were given storage at the start of the function, like any other variable
+			b.NewStore(generator.Values[capture.Id], field)
+		}
+		env = b.NewBitCast(ptr, types.I8Ptr)
+	}
+	closure := b.NewInsertValue(constant.NewUndef(generator.ConvertType(FnType(ClosureAST.Fn))), f, 0)
+	return b.NewInsertValue(closure, env, 1)
+}
+
+// emit the body of a closure as a function that takes its environment as the first paramater
+func (generator *Generator) Lift(ClosureAST *ClosureAST, envType *types.StructType) *ir.Func {
+	name := fmt.Sprintf("%s.closure.%d", generator.CurrentFn.Name(), generator.Closures)
+	generator.Closures++
+	params := []*ir.Param{ir.NewParam("env", types.I8Ptr)}
+	for _, param := range ClosureAST.Fn.Params {
+		p := ir.NewParam(param.Identifier.Lexme(), generator.ConvertType(param.Type))
+		params = append(params, p)
+		generator.Values[param.Symbol.Id] = p
+	}
+	f := generator.Module.NewFunc(name, generator.ConvertType(ClosureAST.Fn.RetType), params...)
+
+	// the closure is emitted in the middle of the function that creates it
+	fn, blocks, breakBlock := generator.CurrentFn, generator.CurrentBlock, generator.BreakBlock
+	generator.CurrentFn, generator.CurrentBlock = f, []*ir.Block{f.NewBlock("closure_body")}
+	// inside the closure the captured variables are reached through the environment
+	b := generator.Block()
+	env := b.NewBitCast(f.Params[0], types.NewPointer(envType))
+	outer := make([]value.Value, len(ClosureAST.Captures))
+	for i, capture := range ClosureAST.Captures {
+		outer[i] = generator.Values[capture.Id]
+		field := b.NewGetElementPtr(envType, env, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(i)))
+		generator.Values[capture.Id] = b.NewLoad(envType.Fields[i], field)
+	}
+	generator.Body(ClosureAST.Fn)
+	for i, capture := range ClosureAST.Captures {
+		generator.Values[capture.Id] = outer[i]
+	}
+	generator.CurrentFn, generator.CurrentBlock, generator.BreakBlock = fn, blocks, breakBlock
+	return f
+}
+
+// allocate space for a value, on the heap if it has to outlive the function
+func (generator *Generator) Alloc(t types.Type, heap bool) value.Value {
+	if !heap {
+		return generator.Temp(t)
+	}
+	b := generator.Block()
+	mem := b.NewCall(generator.Malloc(), constant.NewInt(types.I64, int64(SizeOf(t))))
+	return b.NewBitCast(mem, types.NewPointer(t))
+}
+
+// get malloc, declaring it unless the program already has
+func (generator *Generator) Malloc() *ir.Func {
+	return generator.Extern("malloc", types.I8Ptr, ir.NewParam("size", types.I64))
+}
+
+// get a function from libc, declaring it unless the program already has
+func (generator *Generator) Extern(name string, retType types.Type, params ...*ir.Param) *ir.Func {
+	for _, f := range generator.Module.Funcs {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return generator.Module.NewFunc(name, retType, params...)
+}
+
+// named functions used as a value are wrapped in a function that takes an environment and ignores it,
+// so they can be called just like a closure
+func (generator *Generator) Thunk(f *ir.Func) *ir.Func {
+	if thunk, ok := generator.Thunks[f]; ok {
+		return thunk
+	}
+	params := []*ir.Param{ir.NewParam("env", types.I8Ptr)}
+	var args []value.Value
+	for _, param := range f.Params {
+		p := ir.NewParam(param.Name(), param.Type())
+		params = append(params, p)
+		args = append(args, p)
+	}
+	thunk := generator.Module.NewFunc(f.Name()+".thunk", f.Sig.RetType, params...)
+	b := thunk.NewBlock("thunk_body")
+	call := b.NewCall(f, args...)
+	if types.Equal(f.Sig.RetType, types.Void) {
+		b.NewRet(nil)
+	} else {
+		b.NewRet(call)
+	}
+	generator.Thunks[f] = thunk
+	return thunk
+}
+
+// the name of a function in the module, methods are named after their struct e.g. Vec2.len
+func Mangle(FnAST *FnAST) string {
+	if FnAST.Receiver != nil {
+		return FnAST.Receiver.Lexme() + "." + FnAST.Identifier.Lexme()
+	}
+	return FnAST.Identifier.Lexme()
+}
 
-	generator.SymTable.PopScope()
-	// finally add the function to the symbol table
-	generator.SymTable.Add(identifier, NewTavType(TYPE_FN, "", 0, &FnAST.RetType), f)
+// declare a function and its paramaters, the function is added before any body is emitted so it
+// can be called from anywhere
+func (generator *Generator) Prototype(FnAST *FnAST) *ir.Func {
+	if f, ok := generator.Values[FnAST.Symbol.Id]; ok {
+		return f.(*ir.Func)
+	}
+	var params []*ir.Param
+	for _, param := range FnAST.Params {
+		t := generator.ConvertType(param.Type)
+		// c functions take a plain pointer to the code of a function
+		if FnAST.Proto && param.Type.Type == TYPE_FN && param.Type.Indirection == 0 {
+			t = types.NewPointer(generator.Signature(param.Type, false))
+		}
+		p := ir.NewParam(param.Identifier.Lexme(), t)
+		params = append(params, p)
+		generator.Values[param.Symbol.Id] = p
+	}
+	f := generator.Module.NewFunc(Mangle(FnAST), generator.ConvertType(FnAST.RetType), params...)
+	f.Sig.Variadic = FnAST.Variadic
+	generator.Values[FnAST.Symbol.Id] = f
 	return f
 }
 
 func (generator *Generator) VisitVarDefAST(VarDefAST *VarDefAST) interface{} {
+	// constants don't need any storage, the folded value is used directly
+	if VarDefAST.Constant {
+		generator.Values[VarDefAST.Symbol.Id] = generator.Const(VarDefAST.Assignment.(*LiteralAST))
+		return nil
+	}
 	b := generator.Block()
-	// allocate memory on the stack & then store the assignment
-	v := b.NewAlloca(ConvertType(VarDefAST.Type, generator.SymTable))
+	// allocate memory on the stack (or the heap if a closure that captures it can outlive the function) & then store the assignment
+	v := generator.Alloc(generator.ConvertType(VarDefAST.Type), VarDefAST.Symbol.Heap)
 	// if the variable assignment isn't nil, visit it and create an instruction to initialise the value
 	if VarDefAST.Assignment != nil {
 		assignment := VarDefAST.Assignment.Visit(generator)
-		storeType := assignment.(value.Value)
-		// if the type is a pointer or a struct, we have to use a load instruction before the store
-		if VarDefAST.Type.Indirection != 0 || VarDefAST.Type.Type == TYPE_STRUCT {
-			storeType = b.NewLoad(ConvertType(VarDefAST.Type, generator.SymTable), assignment.(value.Value))
-		}
-		b.NewStore(storeType, v)
+		// if we were given a pointer to the value (e.g. a struct or union), we have to load it before the store
+		storeType := generator.Coerce(assignment.(value.Value), generator.ConvertType(VarDefAST.Type))
+		// the assignment can end in another block e.g. after checking the type an any holds
+		generator.Block().NewStore(storeType, v)
+	} else if generator.IsStruct(VarDefAST.Type) && !VarDefAST.Uninit {
+		// a struct without an assignment still gets its default values
+		b.NewStore(generator.DefaultStruct(VarDefAST.Type), v)
+	} else if VarDefAST.Type.Length > 0 && generator.IsStruct(ElemType(VarDefAST.Type)) && !VarDefAST.Uninit {
+		// and so does each element of an array of structs
+		generator.FillArray(v, VarDefAST.Type)
+	} else if !VarDefAST.Uninit {
+		// everything else starts as zero, unless it was declared with '---'
+		b.NewStore(constant.NewZeroInitializer(generator.ConvertType(VarDefAST.Type)), v)
 	}
-	// store the actual variable allocation in the symbol table
+	// store the actual variable allocation by the symbol's id
 	// this will be retrieved any time we visit the variable
-	generator.SymTable.Add(VarDefAST.Identifier.Lexme(), VarDefAST.Type, v)
+	generator.Values[VarDefAST.Symbol.Id] = v
 	return nil
 }
 
+// a statement block only introduces a scope, which the resolver has dealt with, so the statements are
+// emitted into the current llvm block
 func (generator *Generator) VisitBlockAST(BlockAST *BlockAST) interface{} {
-	b:=generator.NewBlock(fmt.Sprintf("block_%d",generator.FnBlockCount))
-	generator.PushBlock(b)
-	generator.SymTable.NewScope("block_body")
-	for _, stmt := range BlockAST.Statements {
-		stmt.Visit(generator)
-	}
-	generator.SymTable.PopScope()
-	generator.ExitBlock()
-	b.NewBr(generator.Block())
+	generator.Statements(BlockAST.Statements)
 	return nil
 }
 
+func (generator *Generator) VisitFieldsAST(FieldsAST *FieldsAST) interface{} {
+	return FieldsAST.Unrolled.Visit(generator)
+}
+
 func (generator *Generator) VisitExprSmtAST(ExprStmtAST *ExprStmtAST) interface{} {
 	return ExprStmtAST.Expression.Visit(generator)
 }
 
 func (generator *Generator) VisitLiteralAST(LiteralAST *LiteralAST) interface{} {
-	val := ValueFromType(LiteralAST.Type, LiteralAST.Value)
-	switch val.(type){
-	case *constant.CharArray:
-		// https://stackoverflow.com/questions/37901866/get-pointer-to-first-element-of-array-in-llvm-ir
-		//strPtr := generator.Block().NewAlloca(types.I8Ptr)
-		strArr := generator.Block().NewAlloca(types.NewArray(uint64(len(LiteralAST.Value.String)), types.I8))
-		// store the string constant in the string on the stack
-		generator.Block().NewStore(val, strArr)
-		bitcast := generator.Block().NewBitCast(strArr, types.I8Ptr)
-		//generator.Block().NewStore(bitcast, strPtr)
-		return bitcast
-	}
-	return val
+	return generator.Const(LiteralAST)
 }
 
 func (generator *Generator) VisitListAST(ListAST *ListAST) interface{} {
 	return nil
 }
 
-// return the value of a variable in the symbol table
+// return the value emitted for the variable's symbol
 // TODO This means functions are not first class variables as you cannot cast them to value.Value
 func (generator *Generator) VisitVariableAST(VariableAST *VariableAST) interface{} {
-	variable := generator.SymTable.Get(VariableAST.Identifier.Lexme())
+	variable := VariableAST.Symbol
+	val := generator.Values[variable.Id]
 	// when returning variables, we have to check the value
 	// if the value is a function, we don't want to return a variable load instruction
-	// instead we want to directly return the function to call
+	// instead we want to directly return the function to call, variables that hold a function are loaded
 	// if the value is a paramater, we return the value directly
-	switch variable.Type.Type {
-	case TYPE_INSTANCE:
-		return variable.Value
-	case TYPE_FN:
-		return variable.Value
+	if variable.Type.Type == TYPE_INSTANCE && variable.Type.Indirection == 0 {
+		return val
+	}
+	if variable.Kind == SYMBOL_FN {
+		// the function has no environment, so the value is the function wrapped to ignore one
+		fnType := generator.ConvertType(variable.Type).(*types.StructType)
+		thunk := constant.NewBitCast(generator.Thunk(val.(*ir.Func)), fnType.Fields[0])
+		return constant.NewStruct(fnType, thunk, constant.NewNull(types.I8Ptr))
 	}
-	switch variable.Value.(type) {
+	// like structs, arrays are used through a pointer to their storage
+	if variable.Type.Length > 0 {
+		return val
+	}
+	switch val.(type) {
 	case *ir.Param:
-		return variable.Value
-	default:
-		val := generator.Block().NewLoad(ConvertType(variable.Type, generator.SymTable), variable.Value.(value.Value))
 		return val
+	case *ir.Global:
+		return generator.Block().NewLoad(generator.ConvertType(variable.Type), val)
+	case constant.Constant:
+		// constants are folded straight into the expression
+		return val
+	default:
+		return generator.Block().NewLoad(generator.ConvertType(variable.Type), val)
 	}
 }
 
 func (generator *Generator) VisitUnaryAST(UnaryAST *UnaryAST) interface{} {
-	b := generator.Block()
+	if UnaryAST.Operator.Type == ADDR {
+		return generator.Address(UnaryAST.Right)
+	}
 	right := UnaryAST.Right.Visit(generator) // if this is a variable, it is a load instruction
+	b := generator.Block()
 	// we have to invert the pointers (e.g. from *i32 -> i32 and vice versa)
 	// the reason being the LLVM bindings want to see the target variable type
 	// TODO multiple levels of indirection
 	switch UnaryAST.Operator.Type {
-	case ADDR:
-		inverted := ConvertType(InvertPtrType(InferType(UnaryAST.Right, generator.SymTable), 1), generator.SymTable)
-		//return	b.NewIntToPtr(right.(value.Value), inverted)
-		return b.NewIntToPtr(right.(value.Value), inverted)
 	case STAR:
-		inverted := ConvertType(InvertPtrType(InferType(UnaryAST.Right, generator.SymTable), -1), generator.SymTable)
-		return b.NewPtrToInt(right.(value.Value), inverted)
+		// like variables, structs and arrays are used through the pointer to them
+		t := InvertPtrType(InferType(UnaryAST.Right, generator.SymTable), -1)
+		if t.Indirection == 0 && (t.Type == TYPE_INSTANCE || t.Length > 0) {
+			return right
+		}
+		return b.NewLoad(generator.ConvertType(t), right.(value.Value))
+	case MINUS:
+		val := right.(value.Value)
+		if types.IsFloat(val.Type()) {
+			return b.NewFNeg(val)
+		}
+		return b.NewSub(constant.NewInt(val.Type().(*types.IntType), 0), val)
+	case BANG:
+		return b.NewXor(right.(value.Value), constant.NewBool(true))
+	case WIGGLE:
+		val := right.(value.Value)
+		return b.NewXor(val, constant.NewInt(val.Type().(*types.IntType), -1))
 	}
 	return nil
 }
 
+// get a pointer to where the value of an expression is stored e.g. for @x
+func (generator *Generator) Address(expression AST) value.Value {
+	switch e := expression.(type) {
+	case *VariableAST:
+		return generator.Values[e.Symbol.Id]
+	case *IndexAST:
+		return generator.ElementPtr(e.Array, e.Index)
+	case *StructGetAST:
+		return generator.MemberPtr(e.Struct, e.Member)
+	case *GroupAST:
+		return generator.Address(e.Group)
+	}
+	// anything else is a temporary
+	t := generator.ConvertType(InferType(expression, generator.SymTable))
+	return generator.Addressable(generator.Coerce(expression.Visit(generator).(value.Value), t), t)
+}
+
 func (generator *Generator) VisitBinaryAST(BinaryAST *BinaryAST) interface{} {
-	b := generator.Block()
 	left := BinaryAST.Left.Visit(generator).(value.Value)
 	right := BinaryAST.Right.Visit(generator).(value.Value)
+	b := generator.Block()
+	float := types.IsFloat(left.Type())
+	unsigned := InferType(BinaryAST.Left, generator.SymTable).IsUnsigned()
 	switch BinaryAST.Operator.Type {
 	case PLUS:
-		if left.Type() == types.Float {
+		if float {
 			return b.NewFAdd(left, right)
 		}
 		return b.NewAdd(left, right)
 	case MINUS:
-		if left.Type() == types.Float {
+		if float {
 			return b.NewFSub(left, right)
 		}
 		return b.NewSub(left, right)
 	case STAR:
-		if left.Type() == types.Float {
+		if float {
 			return b.NewFMul(left, right)
 		}
 		return b.NewMul(left, right)
 	case DIV:
-		return b.NewFDiv(left, right)
-	case EQUALS:
-		return b.NewICmp(enum.IPredEQ, left, right)
-	case NOT_EQUALS:
-		return b.NewICmp(enum.IPredNE, left, right)
-	case LESS_THAN:
-		return b.NewICmp(enum.IPredSLT, left, right)
-	case LESS_EQUAL:
-		return b.NewICmp(enum.IPredSLE, left, right)
-	case GREAT_THAN:
-		return b.NewICmp(enum.IPredSGT, left, right)
-	case GREAT_EQUAL:
-		return b.NewICmp(enum.IPredSGE, left, right)
+		if float {
+			return b.NewFDiv(left, right)
+		} else if unsigned {
+			return b.NewUDiv(left, right)
+		}
+		return b.NewSDiv(left, right)
+	case BIN_AND, AND:
+		return b.NewAnd(left, right)
+	case BIN_OR, OR:
+		return b.NewOr(left, right)
+	case SLEFT:
+		return b.NewShl(left, right)
+	case SRIGHT:
+		if unsigned {
+			return b.NewLShr(left, right)
+		}
+		return b.NewAShr(left, right)
+	case EQUALS, NOT_EQUALS, LESS_THAN, LESS_EQUAL, GREAT_THAN, GREAT_EQUAL:
+		if float {
+			return b.NewFCmp(FloatPreds[BinaryAST.Operator.Type], left, right)
+		} else if unsigned {
+			return b.NewICmp(UnsignedPreds[BinaryAST.Operator.Type], left, right)
+		}
+		return b.NewICmp(SignedPreds[BinaryAST.Operator.Type], left, right)
 	}
 	return nil
 }
 
+// the comparison predicate for each operator
+var (
+	SignedPreds = map[uint32]enum.IPred{
+		EQUALS: enum.IPredEQ, NOT_EQUALS: enum.IPredNE, LESS_THAN: enum.IPredSLT,
+		LESS_EQUAL: enum.IPredSLE, GREAT_THAN: enum.IPredSGT, GREAT_EQUAL: enum.IPredSGE,
+	}
+	UnsignedPreds = map[uint32]enum.IPred{
+		EQUALS: enum.IPredEQ, NOT_EQUALS: enum.IPredNE, LESS_THAN: enum.IPredULT,
+		LESS_EQUAL: enum.IPredULE, GREAT_THAN: enum.IPredUGT, GREAT_EQUAL: enum.IPredUGE,
+	}
+	FloatPreds = map[uint32]enum.FPred{
+		EQUALS: enum.FPredOEQ, NOT_EQUALS: enum.FPredONE, LESS_THAN: enum.FPredOLT,
+		LESS_EQUAL: enum.FPredOLE, GREAT_THAN: enum.FPredOGT, GREAT_EQUAL: enum.FPredOGE,
+	}
+)
+
 func (generator *Generator) VisitConnectiveAST(ConnectiveAST *ConnectiveAST) interface{} {
 	return nil
 }
 
 func (generator *Generator) VisitCallAST(CallAST *CallAST) interface{} {
-	callee := CallAST.Caller.Visit(generator)
+	if union, ok := UnionCtor(CallAST, generator.SymTable); ok {
+		return generator.UnionCtor(union, CallAST)
+	}
+	if CallAST.Reference {
+		return CallAST.Caller.Visit(generator)
+	}
+	// named functions are called directly, anything else is a function value that is called with its environment
+	var callee value.Value
 	var args []value.Value
-	for _, arg := range CallAST.Args {
-		args = append(args, arg.Visit(generator).(value.Value))
+	if caller, ok := CallAST.Caller.(*VariableAST); ok && caller.Symbol.Kind == SYMBOL_FN {
+		callee = generator.Values[caller.Symbol.Id]
+	} else if get, ok := CallAST.Caller.(*StructGetAST); ok && get.Method != nil && get.Method.Value.(*FnAST).Receiver == nil {
+		var data value.Value
+		callee, data = generator.Dispatch(get)
+		args = append(args, data)
+	} else if get, ok := CallAST.Caller.(*StructGetAST); ok && get.Method != nil {
+		f := generator.Values[get.Method.Id].(*ir.Func)
+		callee = f
+		args = append(args, generator.Coerce(generator.Receiver(get), f.Sig.Params[0]))
+	} else {
+		closure := CallAST.Caller.Visit(generator).(value.Value)
+		callee = generator.Block().NewExtractValue(closure, 0)
+		args = append(args, generator.Block().NewExtractValue(closure, 1))
 	}
-	return generator.Block().NewCall(callee.(value.Value), args...)
+	params := callee.Type().(*types.PointerType).ElemType.(*types.FuncType).Params[len(args):]
+	for i, arg := range CallAST.Args {
+		// c functions take a plain pointer to the code of a function, the checker has made sure it is named
+		if i < len(params) && types.IsPointer(params[i]) && types.IsFunc(params[i].(*types.PointerType).ElemType) {
+			args = append(args, generator.Values[Function(arg).Id])
+			continue
+		}
+		val := arg.Visit(generator).(value.Value)
+		// variadic arguments don't have a paramater to coerce to, they are promoted like in c instead
+		if i < len(params) {
+			val = generator.Coerce(val, params[i])
+		} else {
+			val = generator.Promote(val, InferType(arg, generator.SymTable))
+		}
+		args = append(args, val)
+	}
+	return generator.Block().NewCall(callee, args...)
 }
 
-func (generator *Generator) VisitStructGetAST(StructGet *StructGetAST) interface{} {
+// apply c's default argument promotions to a variadic argument, floats are passed as doubles and
+// integers narrower than an int are widened to one
+func (generator *Generator) Promote(val value.Value, t TavType) value.Value {
 	b := generator.Block()
-	s := StructGet.Struct.Visit(generator)
-	typeOfStruct := ConvertType(InferType(StructGet.Struct, generator.SymTable), generator.SymTable)
-	member := b.NewGetElementPtr(typeOfStruct, s.(value.Value), constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0))
-	if !StructGet.Deref {
-		// if we just return the member now, its a pointer! so we want to dereference it
-		return b.NewPtrToInt(member, types.I32)
+	switch v := val.Type().(type) {
+	case *types.FloatType:
+		if v.Kind == types.FloatKindFloat {
+			return b.NewFPExt(val, types.Double)
+		}
+	case *types.IntType:
+		if v.BitSize >= 32 {
+			return val
+		}
+		if t.IsUnsigned() || t.Type == TYPE_BOOL {
+			return b.NewZExt(val, types.I32)
+		}
+		return b.NewSExt(val, types.I32)
 	}
-	return member
+	return val
+}
+
+// the struct a method is called on, its address is taken if the method takes a pointer to it
+func (generator *Generator) Receiver(get *StructGetAST) value.Value {
+	self := get.Method.Value.(*FnAST).Params[0].Type
+	if self.Indirection > InferType(get.Struct, generator.SymTable).Indirection {
+		return generator.Address(get.Struct)
+	}
+	return get.Struct.Visit(generator).(value.Value)
+}
+
+func (generator *Generator) VisitStructGetAST(StructGet *StructGetAST) interface{} {
+	member := generator.MemberPtr(StructGet.Struct, StructGet.Member)
+	t := InferType(StructGet, generator.SymTable)
+	// nested structs and arrays are returned as a pointer, just like variables
+	if (t.Type == TYPE_INSTANCE && t.Indirection == 0) || t.Length > 0 {
+		return member
+	}
+	return generator.Block().NewLoad(generator.ConvertType(t), member)
 }
 
 func (generator *Generator) VisitStructSetAST(StructSetAST *StructSetAST) interface{} {
+	member := generator.MemberPtr(StructSetAST.Struct, StructSetAST.Member)
+	fieldType := member.Type().(*types.PointerType).ElemType
+	val := generator.Coerce(StructSetAST.Value.Visit(generator).(value.Value), fieldType)
+	generator.Block().NewStore(val, member)
+	return member
+}
+
+func (generator *Generator) VisitStructLitAST(StructLitAST *StructLitAST) interface{} {
+	name := StructLitAST.Identifier.Lexme()
+	structType := generator.ConvertType(NewTavType(TYPE_INSTANCE, name, 0, nil)).(*types.StructType)
+	values := generator.StructLitValues(name, StructLitAST)
+
+	s := generator.Temp(structType)
 	b := generator.Block()
-	s := StructSetAST.Struct.Visit(generator)
-	typeOfStruct := ConvertType(InferType(StructSetAST.Struct, generator.SymTable), generator.SymTable)
+	// if every value is known at compile time, we can store the whole struct as a constant
+	if init, ok := generator.ConstStruct(structType, values); ok {
+		b.NewStore(init, s)
+		return s
+	}
+	b.NewStore(constant.NewZeroInitializer(structType), s)
+	for i, val := range values {
+		if val == nil {
+			continue
+		}
+		field := generator.Coerce(val.Visit(generator).(value.Value), structType.Fields[i])
+		b = generator.Block()
+		b.NewStore(field, b.NewGetElementPtr(structType, s, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(i))))
+	}
+	return s
+}
+
+// order the values of a struct literal by member, members that aren't given take their default
+// value, or nil if they should be zero initialised
+func (generator *Generator) StructLitValues(name string, StructLitAST *StructLitAST) []AST {
+	members := generator.SymTable.Get(name).Fields()
+	values := make([]AST, len(members))
+	for i, member := range members {
+		if member.Value != nil {
+			values[i] = member.Value.(AST)
+		}
+	}
+	if StructLitAST == nil {
+		return values
+	}
+	for i, val := range StructLitAST.Values {
+		if StructLitAST.Fields != nil {
+			values[generator.CalcStructOffset(name, StructLitAST.Fields[i].Lexme())] = val
+		} else {
+			values[i] = val
+		}
+	}
+	return values
+}
 
-	//offsett := CalcStructOffset(StructSetAST.Member.Lexme())
+// fold the values of a struct into a constant, returns false if any of the values aren't constant
+func (generator *Generator) ConstStruct(structType *types.StructType, values []AST) (constant.Constant, bool) {
+	var fields []constant.Constant
+	for i, val := range values {
+		if val == nil {
+			fields = append(fields, constant.NewZeroInitializer(structType.Fields[i]))
+			continue
+		}
+		lit, ok := val.(*LiteralAST)
+		if !ok {
+			return nil, false
+		}
+		fields = append(fields, generator.Const(lit))
+	}
+	return constant.NewStruct(structType, fields...), true
+}
 
-	member := b.NewGetElementPtr(typeOfStruct, s.(value.Value), constant.NewInt(types.I32, 0), constant.NewInt(types.I32, 0))
-	val := StructSetAST.Value.Visit(generator).(value.Value)
-	b.NewStore(val, member)
-	return member
+// the constant a struct starts as when it isn't given a value, its members take their default values
+func (generator *Generator) DefaultStruct(tavType TavType) constant.Constant {
+	init, _ := generator.ConstStruct(generator.ConvertType(tavType).(*types.StructType), generator.StructLitValues(tavType.Instance, nil))
+	return init
+}
+
+// store the default value of a struct into each element of an array of them, in a loop so the code
+// doesn't grow with the length of the array
+func (generator *Generator) FillArray(array value.Value, tavType TavType) {
+	arrayType := generator.ConvertType(tavType)
+	init := generator.DefaultStruct(ElemType(tavType))
+	cond := generator.NewBlock(fmt.Sprintf("fill_cond_%d", generator.FnBlockCount))
+	body := generator.NewBlock(fmt.Sprintf("fill_body_%d", generator.FnBlockCount))
+	end := generator.NewBlock(fmt.Sprintf("fill_end_%d", generator.FnBlockCount))
+	entry := generator.Block()
+	entry.NewBr(cond)
+
+	index := cond.NewPhi(ir.NewIncoming(constant.NewInt(types.I64, 0), entry))
+	cond.NewCondBr(cond.NewICmp(enum.IPredULT, index, constant.NewInt(types.I64, int64(tavType.Length))), body, end)
+	body.NewStore(init, body.NewGetElementPtr(arrayType, array, constant.NewInt(types.I64, 0), index))
+	index.Incs = append(index.Incs, ir.NewIncoming(body.NewAdd(index, constant.NewInt(types.I64, 1)), body))
+	body.NewBr(cond)
+	generator.PushBlock(end)
+}
+
+// get a pointer to a member of a struct
+func (generator *Generator) MemberPtr(Struct AST, Member *Token) value.Value {
+	instance := InferType(Struct, generator.SymTable).Instance
+	structType := generator.ConvertType(NewTavType(TYPE_INSTANCE, instance, 0, nil))
+	s := generator.Addressable(Struct.Visit(generator).(value.Value), structType)
+	// dereference until we have a pointer to the struct itself (e.g. when using ->)
+	for ptr, ok := s.Type().(*types.PointerType); ok && types.IsPointer(ptr.ElemType); ptr, ok = s.Type().(*types.PointerType) {
+		s = generator.Block().NewLoad(ptr.ElemType, s)
+	}
+	offset := generator.CalcStructOffset(instance, Member.Lexme())
+	return generator.Block().NewGetElementPtr(structType, s, constant.NewInt(types.I32, 0), constant.NewInt(types.I32, int64(offset)))
 }
 
 // calculate the memory offset of a particular struct member
 func (generator *Generator) CalcStructOffset(name, member string) int {
-	// first find the struct in the symbol table
-	t := generator.SymTable.Get(name).Value.(*Scope)
-	for i, sym := range t.Symbols {
-		if sym.Identifier == member {
-			return i
-		}
+	_, offset := generator.SymTable.Member(name, member)
+	return offset
+}
+
+// check if a type is an instance of a struct (rather than a union)
+func (generator *Generator) IsStruct(tavType TavType) bool {
+	if tavType.Type != TYPE_INSTANCE || tavType.Indirection != 0 || tavType.Length != 0 {
+		return false
 	}
-	return 0
+	sym := generator.SymTable.Get(tavType.Instance)
+	return sym != nil && sym.Type.Type == TYPE_STRUCT
+}
+
+func (generator *Generator) VisitIndexAST(IndexAST *IndexAST) interface{} {
+	element := generator.ElementPtr(IndexAST.Array, IndexAST.Index)
+	t := InferType(IndexAST, generator.SymTable)
+	if t.Type == TYPE_INSTANCE && t.Indirection == 0 {
+		return element
+	}
+	return generator.Block().NewLoad(generator.ConvertType(t), element)
+}
+
+func (generator *Generator) VisitIndexSetAST(IndexSetAST *IndexSetAST) interface{} {
+	element := generator.ElementPtr(IndexSetAST.Array, IndexSetAST.Index)
+	elemType := element.Type().(*types.PointerType).ElemType
+	val := generator.Coerce(IndexSetAST.Value.Visit(generator).(value.Value), elemType)
+	generator.Block().NewStore(val, element)
+	return element
+}
+
+// get a pointer to an element of an array, or of the elements a pointer points to
+func (generator *Generator) ElementPtr(Array AST, Index AST) value.Value {
+	t := InferType(Array, generator.SymTable)
+	if t.Length == 0 {
+		ptr := generator.Coerce(Array.Visit(generator).(value.Value), generator.ConvertType(t))
+		index := Index.Visit(generator).(value.Value)
+		return generator.Block().NewGetElementPtr(generator.ConvertType(ElemType(t)), ptr, index)
+	}
+	arrayType := generator.ConvertType(t)
+	array := generator.Addressable(Array.Visit(generator).(value.Value), arrayType)
+	index := Index.Visit(generator).(value.Value)
+	return generator.Block().NewGetElementPtr(arrayType, array, constant.NewInt(types.I32, 0), index)
+}
+
+// the TypeInfo of a type, or of the value of an expression. an any holds the TypeInfo of its value
+func (generator *Generator) VisitTypeOfAST(TypeOfAST *TypeOfAST) interface{} {
+	if TypeOfAST.Type != nil {
+		return generator.TypeInfo(*TypeOfAST.Type)
+	}
+	val := TypeOfAST.Value.Visit(generator).(value.Value)
+	if t := InferType(TypeOfAST.Value, generator.SymTable); !t.IsAny() {
+		return generator.TypeInfo(t)
+	}
+	return generator.Block().NewExtractValue(val, 0)
+}
+
+func (generator *Generator) VisitRunAST(RunAST *RunAST) interface{} {
+	return RunAST.Value.Visit(generator)
 }
 
 func (generator *Generator) VisitGroupAST(GroupAST *GroupAST) interface{} {
@@ -460,8 +1440,16 @@ func Generate(compiler *Compiler, RootAST *RootAST) *ir.Module {
 	generator := &Generator{
 		Root:     RootAST,
 		Module:   module,
-		SymTable: NewSymTable(),
+		SymTable: RootAST.SymTable,
 		Compiler: compiler,
+		Values:   make(map[uint32]value.Value),
+		Types:    make(map[uint32]types.Type),
+		Strings:  make(map[string]*ir.Global),
+		Thunks:   make(map[*ir.Func]*ir.Func),
+
+		Dispatchers: make(map[*ir.Func]*ir.Func),
+		VTables:     make(map[string]*ir.Global),
+		TypeInfos:   make(map[string]*ir.Global),
 	}
 	result := generator.Run()
 	return result
@@ -488,6 +1476,47 @@ func (generator *Generator) ExitBlock(){
 	generator.CurrentBlock = generator.CurrentBlock[:len(generator.CurrentBlock)-1] // pop the block from the stack
 }
 
+// aggregates such as structs and unions are passed around as pointers to their stack allocation,
+// if we were given a pointer to the type we want then load it
+func (generator *Generator) Coerce(val value.Value, want types.Type) value.Value {
+	if iface := generator.Interface(want); iface != nil && !types.Equal(val.Type(), want) && !types.Equal(val.Type(), types.NewPointer(want)) {
+		return generator.Implementation(val, want.(*types.StructType), iface)
+	}
+	if ptr, ok := val.Type().(*types.PointerType); ok && !types.Equal(ptr, want) && types.Equal(ptr.ElemType, want) {
+		return generator.Block().NewLoad(want, val)
+	}
+	return val
+}
+
+// the symbol of the interface a type is the llvm type of, or nil if it isn't an interface
+func (generator *Generator) Interface(t types.Type) *Symbol {
+	if s, ok := t.(*types.StructType); ok && s.Name() != "" {
+		if sym := generator.SymTable.Get(s.Name()); sym != nil && sym.Type.Type == TYPE_INTERFACE {
+			return sym
+		}
+	}
+	return nil
+}
+
+// the inverse of Coerce, if we were given an aggregate value directly (e.g. a paramater) spill it to the stack
+func (generator *Generator) Addressable(val value.Value, t types.Type) value.Value {
+	if types.Equal(val.Type(), t) {
+		ptr := generator.Temp(t)
+		generator.Block().NewStore(val, ptr)
+		return ptr
+	}
+	return val
+}
+
+// allocate stack space in the function's entry block, so a temporary made inside a loop reuses the same
+// space each iteration rather than growing the stack
+func (generator *Generator) Temp(t types.Type) value.Value {
+	entry := generator.CurrentFn.Blocks[0]
+	alloca := ir.NewAlloca(t)
+	entry.Insts = append([]ir.Instruction{alloca}, entry.Insts...)
+	return alloca
+}
+
 func (generator *Generator) Block() *ir.Block{
 	return generator.CurrentBlock[len(generator.CurrentBlock)-1]
 }
@@ -1,11 +1,261 @@
 package src
 
+import "strconv"
+
+// the interpreter evaluates #run at compile time by walking the AST. it only runs what can be worked out
+// without the rest of the program: numbers, bools, strings, local variables and calls to functions that
+// only use them. each value is kept as a literal, so the folding functions do the arithmetic
 type Interpreter struct {
 	Compiler *Compiler
 	Reporter *Reporter
 	Root     *RootAST
+	SymTable *SymTable
+	Run      *RunAST                 // the #run being evaluated
+	Frame    map[*Symbol]*LiteralAST // the values of the variables of the function being run
+	Depth    int                     // how many calls deep the interpreter is
+	Steps    int                     // the number of statements run so far
 }
 
+const (
+	// past these a #run is assumed to never finish
+	MAX_RUN_DEPTH = 1000
+	MAX_RUN_STEPS = 10000000
+
+	// what happens after a statement is run
+	FLOW_NEXT  uint8 = 0x0
+	FLOW_BREAK uint8 = 0x1
+	FLOW_RET   uint8 = 0x2
+)
+
 func Interpret(Compiler *Compiler, RootAST *RootAST) interface{} {
 	return nil
 }
+
+// evaluate the expression of a #run, the result has the type of the expression
+func Evaluate(compiler *Compiler, SymTable *SymTable, RunAST *RunAST) *LiteralAST {
+	interpreter := &Interpreter{
+		Compiler: compiler,
+		Reporter: NewReporter(compiler.File.Filename, compiler.File.Source),
+		SymTable: SymTable,
+		Run:      RunAST,
+		Frame:    make(map[*Symbol]*LiteralAST),
+	}
+	val := interpreter.Expr(RunAST.Expr)
+	if val == nil {
+		interpreter.Unsupported(RunAST.Expr, "#run needs a value, this doesn't return one")
+	}
+	result := *Assign(InferType(RunAST.Expr, SymTable), val)
+	result.Range = RunAST.Span()
+	return &result
+}
+
+// report something #run can't evaluate, pointing at it and at the #run that tried to
+func (interpreter *Interpreter) Unsupported(node AST, msg string) {
+	if span := node.Span(); span.Valid() {
+		interpreter.Reporter.Mark(span)
+	}
+	notes := []Note{{Message: "#run can call functions that only use numbers, bools, strings and local variables"}}
+	if interpreter.Run.Span().Valid() && interpreter.Depth > 0 {
+		notes = append(notes, Note{Span: interpreter.Run.Span(), Message: "while evaluating this #run"})
+	}
+	interpreter.Compiler.Critical(interpreter.Reporter, ERR_NOT_CONSTANT, msg, notes...)
+}
+
+// give a value the type of the variable, paramater or return it is assigned to
+func Assign(tavType TavType, val *LiteralAST) *LiteralAST {
+	if val == nil || !tavType.IsNumber() || !(val.Type.IsInt() || val.Type.IsFloat()) || (!val.Untyped && val.Type.Equals(tavType)) {
+		return val
+	}
+	if cast, ok := FoldCast(val, tavType); ok {
+		return Wrap(cast)
+	}
+	return val
+}
+
+// wrap an integer around to the number of bits in its type, as it would be when the program runs
+func Wrap(lit *LiteralAST) *LiteralAST {
+	if lit.Untyped || !lit.Type.IsInt() || lit.Type.Bits() == 64 {
+		return lit
+	}
+	shift := 64 - lit.Type.Bits()
+	if lit.Type.IsUnsigned() {
+		lit.Value.Int = int64(uint64(lit.Value.Int) << shift >> shift)
+	} else {
+		lit.Value.Int = lit.Value.Int << shift >> shift
+	}
+	return lit
+}
+
+// evaluate an expression, a call of a function that doesn't return a value gives nil
+func (interpreter *Interpreter) Expr(expression AST) *LiteralAST {
+	switch e := expression.(type) {
+	case *GroupAST:
+		return interpreter.Expr(e.Group)
+	case *VariableAST:
+		if val, ok := interpreter.Frame[e.Symbol]; ok {
+			return val
+		}
+	case *UnaryAST:
+		if e.Operator.Type == MINUS || e.Operator.Type == WIGGLE || e.Operator.Type == BANG {
+			if lit, ok := FoldUnary(e.Operator.Type, interpreter.Value(e.Right)); ok {
+				return Wrap(lit)
+			}
+		}
+	case *BinaryAST:
+		left := interpreter.Value(e.Left)
+		// and/or only evaluate their right side if they need to
+		if left.Type.Type == TYPE_BOOL && ((e.Operator.Type == AND && !left.Value.Bool) || (e.Operator.Type == OR && left.Value.Bool)) {
+			return left
+		}
+		right := interpreter.Value(e.Right)
+		if lit, ok := FoldBinary(e.Operator.Type, left, right); ok {
+			return Wrap(lit)
+		}
+		if e.Operator.Type == DIV && right.Type.IsInt() && right.Value.Int == 0 {
+			interpreter.Unsupported(e, "division by zero in #run")
+		}
+	case *CastAST:
+		if e.TavType.Indirection == 0 && e.TavType.Length == 0 {
+			if lit, ok := FoldCast(interpreter.Value(e.Expr), e.TavType); ok {
+				return Wrap(lit)
+			}
+		}
+	case *CallAST:
+		if caller, ok := e.Caller.(*VariableAST); ok && caller.Symbol != nil && !e.Reference {
+			if fn, ok := caller.Symbol.Value.(*FnAST); ok && !fn.Proto && fn.Generic == nil && fn.Receiver == nil && len(e.Args) == len(fn.Params) {
+				return interpreter.Call(e, fn)
+			} else if ok && fn.Proto {
+				interpreter.Unsupported(e, "'"+caller.Identifier.Lexme()+"' is a native function, #run can't call it")
+			}
+		}
+	case *RunAST:
+		if e.Value != nil {
+			return e.Value
+		}
+		return interpreter.Expr(e.Expr)
+	}
+	// literals, constants and the members of #type_info(T) are folded
+	if lit, ok := Fold(expression, interpreter.SymTable); ok {
+		return lit
+	}
+	interpreter.Unsupported(expression, "cannot be evaluated by #run at compile time")
+	return nil
+}
+
+// evaluate an expression that must have a value
+func (interpreter *Interpreter) Value(expression AST) *LiteralAST {
+	val := interpreter.Expr(expression)
+	if val == nil {
+		interpreter.Unsupported(expression, "this doesn't return a value")
+	}
+	return val
+}
+
+// call a function with the values of the arguments, each call has its own variables
+func (interpreter *Interpreter) Call(CallAST *CallAST, FnAST *FnAST) *LiteralAST {
+	if interpreter.Depth >= MAX_RUN_DEPTH {
+		interpreter.Unsupported(CallAST, "#run recursed more than "+strconv.Itoa(MAX_RUN_DEPTH)+" calls deep")
+	}
+	frame := make(map[*Symbol]*LiteralAST)
+	for i, param := range FnAST.Params {
+		frame[param.Symbol] = Assign(param.Type, interpreter.Value(CallAST.Args[i]))
+	}
+	caller := interpreter.Frame
+	interpreter.Frame = frame
+	interpreter.Depth++
+	_, val := interpreter.Statements(FnAST.Body)
+	interpreter.Depth--
+	interpreter.Frame = caller
+	return Assign(FnAST.RetType, val)
+}
+
+// evaluate the condition of an if or a for
+func (interpreter *Interpreter) Cond(expression AST) bool {
+	val := interpreter.Value(expression)
+	if val.Type.Type != TYPE_BOOL {
+		interpreter.Unsupported(expression, "condition isn't a bool")
+	}
+	return val.Value.Bool
+}
+
+func (interpreter *Interpreter) Statements(statements []AST) (uint8, *LiteralAST) {
+	for _, statement := range statements {
+		if flow, val := interpreter.Statement(statement); flow != FLOW_NEXT {
+			return flow, val
+		}
+	}
+	return FLOW_NEXT, nil
+}
+
+// run a statement, returns whether to carry on, break out of a loop or return along with the value returned
+func (interpreter *Interpreter) Statement(statement AST) (uint8, *LiteralAST) {
+	interpreter.Step(statement)
+	switch s := statement.(type) {
+	case *VarDefAST:
+		// constants were folded by the checker
+		if s.Constant {
+			return FLOW_NEXT, nil
+		}
+		// a variable without a value starts as zero
+		if s.Assignment == nil || s.Uninit {
+			if !s.Type.IsNumber() && !(s.Type.Type == TYPE_BOOL && s.Type.Indirection == 0 && s.Type.Length == 0) {
+				interpreter.Unsupported(s, "#run can't make a variable of type "+s.Type.String())
+			}
+			interpreter.Frame[s.Symbol] = &LiteralAST{Type: s.Type}
+			return FLOW_NEXT, nil
+		}
+		interpreter.Frame[s.Symbol] = Assign(s.Type, interpreter.Value(s.Assignment))
+	case *VarSetAST:
+		// a global is only known when the program runs
+		if _, ok := interpreter.Frame[s.Symbol]; !ok {
+			interpreter.Unsupported(s, "#run can only assign local variables")
+		}
+		interpreter.Frame[s.Symbol] = Assign(s.Symbol.Type, interpreter.Value(s.Value))
+	case *ExprStmtAST:
+		interpreter.Expr(s.Expression)
+	case *CallAST:
+		interpreter.Expr(s)
+	case *ReturnAST:
+		if s.Value == nil {
+			return FLOW_RET, nil
+		}
+		return FLOW_RET, interpreter.Value(s.Value)
+	case *BreakAST:
+		return FLOW_BREAK, nil
+	case *BlockAST:
+		return interpreter.Statements(s.Statements)
+	case *IfAST:
+		if interpreter.Cond(s.IfCondition) {
+			return interpreter.Statement(s.IfBody)
+		}
+		for i, condition := range s.ElifCondition {
+			if interpreter.Cond(condition) {
+				return interpreter.Statement(s.ElifBody[i])
+			}
+		}
+		if s.ElseBody != nil {
+			return interpreter.Statement(s.ElseBody)
+		}
+	case *ForAST:
+		for interpreter.Cond(s.Condition) {
+			flow, val := interpreter.Statement(s.Body)
+			if flow == FLOW_BREAK {
+				break
+			} else if flow == FLOW_RET {
+				return flow, val
+			}
+			interpreter.Step(s)
+		}
+	default:
+		interpreter.Unsupported(statement, "cannot be run by #run at compile time")
+	}
+	return FLOW_NEXT, nil
+}
+
+// count a statement being run, a #run that runs too many is reported rather than left to hang the compiler
+func (interpreter *Interpreter) Step(statement AST) {
+	interpreter.Steps++
+	if interpreter.Steps > MAX_RUN_STEPS {
+		interpreter.Unsupported(statement, "#run ran more than "+strconv.Itoa(MAX_RUN_STEPS)+" statements, it may never finish")
+	}
+}
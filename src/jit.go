@@ -6,15 +6,18 @@ import (
 
 // JIT compile by walking the AST
 // Return the value as a go value (will need to be casted if doing compile time JIT)
-func JITCompile(File *File) interface{} {
+func JITCompile(File *File, Options *Options) interface{} {
 	start := time.Now()
-	compiler := &Compiler{File: File}
+	compiler := &Compiler{File: File, Options: Options}
 	tokens := Lex(compiler)
 	tokens = ProcessDirectives(compiler, tokens)
 	ast := Parse(compiler, tokens)
+	ast = Resolve(compiler, ast)
 	ast = Check(compiler, ast)
+	compiler.StopOnErrors()
 	optimized := Optimize(compiler, ast)
 	result := Interpret(compiler, optimized)
+	compiler.Flush()
 	end := time.Since(start)
 	Log("compilation took ", end.Seconds(), "seconds")
 	return result
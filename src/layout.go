@@ -0,0 +1,162 @@
+package src
+
+import (
+	"github.com/llir/llvm/ir/types"
+)
+
+// the size of a pointer on the targets we emit for
+const PTR_SIZE uint64 = 8
+
+// round a size up to the next multiple of align
+func AlignTo(size, align uint64) uint64 {
+	if align == 0 {
+		return size
+	}
+	return (size + align - 1) / align * align
+}
+
+// get the size in bytes of an llvm type, using the same natural alignment rules as llc
+func SizeOf(t types.Type) uint64 {
+	switch t := t.(type) {
+	case *types.IntType:
+		return AlignTo((t.BitSize+7)/8, AlignOf(t))
+	case *types.FloatType:
+		if t.Kind == types.FloatKindFloat {
+			return 4
+		}
+		return 8
+	case *types.PointerType:
+		return PTR_SIZE
+	case *types.ArrayType:
+		return t.Len * SizeOf(t.ElemType)
+	case *types.StructType:
+		var size uint64
+		for _, field := range t.Fields {
+			if !t.Packed {
+				size = AlignTo(size, AlignOf(field))
+			}
+			size += SizeOf(field)
+		}
+		if !t.Packed {
+			size = AlignTo(size, AlignOf(t))
+		}
+		return size
+	}
+	return 0
+}
+
+// get the offset in bytes of a field of a struct, following the same rules as SizeOf
+func OffsetOf(t *types.StructType, field int) uint64 {
+	var offset uint64
+	for i, f := range t.Fields {
+		if !t.Packed {
+			offset = AlignTo(offset, AlignOf(f))
+		}
+		if i == field {
+			break
+		}
+		offset += SizeOf(f)
+	}
+	return offset
+}
+
+// get the alignment in bytes of an llvm type
+func AlignOf(t types.Type) uint64 {
+	switch t := t.(type) {
+	case *types.IntType:
+		// round up to the next power of 2 (i1 is stored as a byte)
+		var align uint64 = 1
+		for align*8 < t.BitSize && align < 8 {
+			align *= 2
+		}
+		return align
+	case *types.FloatType, *types.PointerType:
+		return SizeOf(t)
+	case *types.ArrayType:
+		return AlignOf(t.ElemType)
+	case *types.StructType:
+		if t.Packed {
+			return 1
+		}
+		var align uint64 = 1
+		for _, field := range t.Fields {
+			if a := AlignOf(field); a > align {
+				align = a
+			}
+		}
+		return align
+	}
+	return 1
+}
+
+// get an llvm type with the same layout as a type from its decleration, so sizes and offsets are known before
+// anything is generated e.g. for #type_info(T).size in a constant. every pointer is an i8* as only its size
+// matters. returns false if the type or one it contains isn't declared
+func LayoutType(t TavType, SymTable *SymTable) (types.Type, bool) {
+	if t.Length > 0 {
+		elem, ok := LayoutType(ElemType(t), SymTable)
+		return types.NewArray(t.Length, elem), ok
+	}
+	if t.Indirection > 0 {
+		return types.I8Ptr, true
+	}
+	switch t.Type {
+	case TYPE_BOOL:
+		return types.I1, true
+	case TYPE_I8, TYPE_U8:
+		return types.I8, true
+	case TYPE_I16, TYPE_U16:
+		return types.I16, true
+	case TYPE_I32, TYPE_U32, TYPE_RUNE:
+		return types.I32, true
+	case TYPE_I64, TYPE_U64:
+		return types.I64, true
+	case TYPE_F32:
+		return types.Float, true
+	case TYPE_F64:
+		return types.Double, true
+	case TYPE_STRING:
+		return types.I8Ptr, true
+	case TYPE_FN, TYPE_ANY:
+		return types.NewStruct(types.I8Ptr, types.I8Ptr), true
+	case TYPE_VOID:
+		return types.Void, true
+	case TYPE_INSTANCE:
+		sym := SymTable.Get(t.Instance)
+		if sym == nil {
+			return nil, false
+		}
+		switch decl := sym.Value.(type) {
+		case *StructAST:
+			if decl.Generic != nil {
+				return nil, false
+			}
+			s := types.NewStruct()
+			s.Packed = decl.Packed
+			for _, field := range decl.Fields {
+				f, ok := LayoutType(field.Type, SymTable)
+				if !ok {
+					return nil, false
+				}
+				s.Fields = append(s.Fields, f)
+			}
+			return s, true
+		case *UnionAST:
+			// the same as the generator, a tag followed by enough 8 byte words to hold the largest payload
+			var payloadSize uint64
+			for _, variant := range decl.Variants {
+				v, ok := LayoutType(variant.Type, SymTable)
+				if !ok {
+					return nil, false
+				}
+				if size := SizeOf(v); size > payloadSize {
+					payloadSize = size
+				}
+			}
+			return types.NewStruct(types.I32, types.NewArray(AlignTo(payloadSize, 8)/8, types.I64)), true
+		case *InterfaceAST:
+			return types.NewStruct(types.I8Ptr, types.I8Ptr), true
+		}
+	}
+	return nil, false
+}
@@ -2,18 +2,14 @@ package src
 
 import (
 	"strings"
-)
-
-const (
-	ERR_UNEXPECTED_CHAR        = 0x0
-	ERR_STRING_ESCAPED         = 0x1
-	ERR_INVALID_NUMBER_LITERAL = 0x2
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	Compiler *Compiler
 	Consumer *LexConsumer
 	Tokens   []*Token
+	Start    Position // the position of the first character of the token being lexed
 }
 
 func Lex(compiler *Compiler) []*Token {
@@ -31,16 +27,19 @@ func Lex(compiler *Compiler) []*Token {
 }
 
 func (lexer *Lexer) Run() []*Token {
+	if !utf8.ValidString(*lexer.Consumer.Source) {
+		lexer.Consumer.Reporter.Mark(InvalidUTF8(*lexer.Consumer.Source))
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_UTF8, "source is not valid utf-8")
+	}
 	for !lexer.Consumer.End() {
 		lexer.Consumer.SkipWhitespace()
+		lexer.Start = lexer.Consumer.Reporter.Position
+		lexer.Start.Indent++
+		lexer.Start.Bytes++
 		r := lexer.Consumer.Advance()
 		switch r {
-		case '\n': // newline
-			lexer.Newline()
-		case '\r': // carrige return
-			lexer.Consumer.Reporter.Position.Indent = 1
-			// issue here is that the lexer then doesn't know there is a line here
-			break
+		case '\n', '\r':
+			// the consumer moves to the next line
 		case '/':
 			if lexer.Consumer.Consume('/') {
 				lexer.LineComment()
@@ -82,6 +81,8 @@ func (lexer *Lexer) Run() []*Token {
 		case ':':
 			if lexer.Consumer.Consume('=') {
 				lexer.Tok(QUICK_ASSIGN, nil)
+			} else if lexer.Consumer.Consume(':') {
+				lexer.Tok(CONST_ASSIGN, nil)
 			} else {
 				lexer.Tok(COLON, nil)
 			}
@@ -124,6 +125,9 @@ func (lexer *Lexer) Run() []*Token {
 		case '-':
 			if lexer.Consumer.Consume('>') {
 				lexer.Tok(DEREF, nil)
+			} else if strings.HasPrefix((*lexer.Consumer.Source)[lexer.Consumer.Counter:], "--") {
+				lexer.Consumer.AdvanceMul(2)
+				lexer.Tok(UNINIT, nil)
 			} else {
 				lexer.Tok(MINUS, nil)
 			}
@@ -136,31 +140,17 @@ func (lexer *Lexer) Run() []*Token {
 		case '@':
 			lexer.Tok(ADDR, nil)
 		case '\'':
-			fallthrough
+			lexer.CharLiteral()
 		case '"':
 			lexer.StringLiteral(r)
+		case '`':
+			lexer.RawStringLiteral()
 		case '#':
-			if !lexer.CheckKeyword("def", DEF, nil) {
-				if !lexer.CheckKeyword("run", RUN, nil) {
-					if !lexer.CheckKeyword("ifdef", IFDEF, nil) {
-						if !lexer.CheckKeyword("endif", ENDIF, nil) {
-							if !lexer.CheckKeyword("hide", HIDE, nil) {
-								if !lexer.CheckKeyword("pack", PACK, nil) {
-									if !lexer.CheckKeyword("expose", EXPOSE, nil) {
-										if !lexer.CheckKeyword("import", IMPORT, nil) {
-											if !lexer.CheckKeyword("native", NATIVE, nil) {
-												lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNEXPECTED_CHAR, "unexpected character")
-											}
-										}
-									}
-								}
-							}
-						}
-					}
-				}
-			}
+			lexer.Directive()
+		case '$':
+			lexer.TypeParam()
 		default:
-			if IsChar(r) {
+			if IsIdentStart(r) {
 				lexer.Identifier(r)
 			} else if IsNum(r) {
 				lexer.NumberLiteral(r)
@@ -172,11 +162,6 @@ func (lexer *Lexer) Run() []*Token {
 	return lexer.Tokens
 }
 
-func (lexer *Lexer) Newline() {
-	lexer.Consumer.Reporter.Position.Line++
-	lexer.Consumer.Reporter.Position.Indent = 0
-}
-
 func (lexer *Lexer) LineComment() {
 	for !lexer.Consumer.End() && !lexer.Consumer.Expect('\n') && !lexer.Consumer.Expect('\r') {
 		lexer.Consumer.Advance()
@@ -195,25 +180,142 @@ func (lexer *Lexer) BlockComment() {
 }
 
 func (lexer *Lexer) Tok(tok uint32, val interface{}) {
-	t := &Token{lexer.Consumer.Reporter.Position, tok, val}
+	t := &Token{lexer.Consumer.Reporter.Position, tok, val, Span{Start: lexer.Start, End: lexer.Consumer.Reporter.Position}}
 	lexer.Tokens = append(lexer.Tokens, t)
 }
 
 func (lexer *Lexer) StringLiteral(r rune) {
 	s := strings.Builder{}
 	for !lexer.Consumer.End() && lexer.Consumer.Peek() != r {
-		s.WriteRune(lexer.Consumer.Advance())
-		if lexer.Consumer.End() {
-			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_STRING_ESCAPED, "string must be closed with ' or \"")
+		c := lexer.Consumer.Advance()
+		switch c {
+		case '\\':
+			lexer.Escape(&s)
+		default:
+			// strings can span multiple lines
+			s.WriteRune(c)
 		}
 	}
-	lexer.Consumer.Consume(r)
+	if !lexer.Consumer.Consume(r) {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNTERMINATED_STRING, "string must be closed with \"")
+	}
 	lexer.Tok(SLITERAL, s.String())
 }
 
+// a character literal e.g. 'a' or '\n', the checker makes sure there is exactly 1 character
+func (lexer *Lexer) CharLiteral() {
+	s := strings.Builder{}
+	for !lexer.Consumer.End() && !lexer.Consumer.Expect('\'') && !lexer.Consumer.Expect('\n') {
+		c := lexer.Consumer.Advance()
+		if c == '\\' {
+			lexer.Escape(&s)
+		} else {
+			s.WriteRune(c)
+		}
+	}
+	if !lexer.Consumer.Consume('\'') {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNTERMINATED_STRING, "character literal must be closed with '")
+	}
+	lexer.Tok(CLITERAL, s.String())
+}
+
+// a raw string is delimited by backticks, the characters are copied verbatim without any escaping
+func (lexer *Lexer) RawStringLiteral() {
+	s := strings.Builder{}
+	for !lexer.Consumer.End() && !lexer.Consumer.Expect('`') {
+		s.WriteRune(lexer.Consumer.Advance())
+	}
+	if !lexer.Consumer.Consume('`') {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNTERMINATED_STRING, "raw string must be closed with `")
+	}
+	lexer.Tok(SLITERAL, s.String())
+}
+
+// process an escape sequence, the '\' has already been consumed
+func (lexer *Lexer) Escape(s *strings.Builder) {
+	if lexer.Consumer.End() {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNTERMINATED_STRING, "escape sequence must be closed")
+	}
+	r := lexer.Consumer.Advance()
+	switch r {
+	case 'n':
+		s.WriteByte('\n')
+	case 'r':
+		s.WriteByte('\r')
+	case 't':
+		s.WriteByte('\t')
+	case '0':
+		s.WriteByte(0)
+	case '\\', '"', '\'':
+		s.WriteByte(byte(r))
+	case 'x':
+		// \xNN is a single byte
+		s.WriteByte(byte(lexer.HexDigits(2, 2)))
+	case 'u':
+		// \u{NNNN} is a unicode code point, encoded as utf-8
+		if !lexer.Consumer.Consume('{') {
+			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_ESCAPE, "expected '{' after \\u")
+		}
+		code := lexer.HexDigits(1, 6)
+		if !lexer.Consumer.Consume('}') {
+			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_ESCAPE, "expected closing '}' in \\u escape")
+		}
+		if !utf8.ValidRune(rune(code)) {
+			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_ESCAPE, "\\u escape is not a valid unicode code point")
+		}
+		s.WriteRune(rune(code))
+	default:
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNKNOWN_ESCAPE, "unknown escape sequence '\\"+string(r)+"'")
+	}
+}
+
+// read between min and max hex digits and return their value
+func (lexer *Lexer) HexDigits(min, max int) uint32 {
+	var value uint32
+	n := 0
+	for ; n < max && !lexer.Consumer.End() && IsHex(lexer.Consumer.Peek()); n++ {
+		value = value*16 + HexValue(lexer.Consumer.Advance())
+	}
+	if n < min {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_ESCAPE, "expected hex digit in escape sequence")
+	}
+	return value
+}
+
+// type suffixes that can follow a number literal e.g. 10u8 or 3.0f64
+var NumberSuffixes = map[string]uint32{
+	"i8": TYPE_I8, "i16": TYPE_I16, "i32": TYPE_I32, "i64": TYPE_I64,
+	"u8": TYPE_U8, "u16": TYPE_U16, "u32": TYPE_U32, "u64": TYPE_U64,
+	"f32": TYPE_F32, "f64": TYPE_F64,
+}
+
 func (lexer *Lexer) NumberLiteral(r rune) bool {
-	hadPeriod := false
 	s := strings.Builder{}
+	// 0x, 0b and 0o prefix a hex, binary or octal literal
+	if r == '0' && (lexer.Consumer.Expect('x') || lexer.Consumer.Expect('b') || lexer.Consumer.Expect('o')) {
+		base := lexer.Consumer.Advance()
+		s.WriteRune(r)
+		s.WriteRune(base)
+		digits := 0
+		for !lexer.Consumer.End() && (IsHex(lexer.Consumer.Peek()) || lexer.Consumer.Expect('_')) {
+			n := lexer.Consumer.Advance()
+			if n == '_' {
+				continue
+			}
+			if (base == 'b' && n != '0' && n != '1') || (base == 'o' && (n < '0' || n > '7')) {
+				lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "invalid digit '"+string(n)+"' in number literal")
+				return false
+			}
+			s.WriteRune(n)
+			digits++
+		}
+		if digits == 0 {
+			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "expected digits after '0"+string(base)+"'")
+			return false
+		}
+		return lexer.NumberSuffix(&s)
+	}
+	hadPeriod := false
 	if r == '.' {
 		hadPeriod = true
 		s.WriteRune('0')
@@ -233,143 +335,133 @@ func (lexer *Lexer) NumberLiteral(r rune) bool {
 		s.WriteRune(n)
 
 	}
-	lexer.Tok(NLITERAL, s.String())
-	return true
-}
-
-func (lexer *Lexer) Identifier(r rune) bool {
-	switch r {
-	case 'u':
-		if !lexer.CheckKeyword("8", TYPE, TYPE_U8) {
-			if !lexer.CheckKeyword("16", TYPE, TYPE_U16) {
-				if !lexer.CheckKeyword("32", TYPE, TYPE_U32) {
-					if !lexer.CheckKeyword("64", TYPE, TYPE_U64) {
-						break
-					}
-				}
-			}
-		}
-		return true
-	case 'i':
-		if !lexer.CheckKeyword("8", TYPE, TYPE_I8) {
-			if !lexer.CheckKeyword("16", TYPE, TYPE_I16) {
-				if !lexer.CheckKeyword("32", TYPE, TYPE_I32) {
-					if !lexer.CheckKeyword("64", TYPE, TYPE_I64) {
-						if !lexer.CheckKeyword("f", IF, nil) {
-							break
-						}
-					}
-				}
-			}
-		}
-		return true
-	case 'f':
-		if !lexer.CheckKeyword("32", TYPE, TYPE_F32) {
-			if !lexer.CheckKeyword("64", TYPE, TYPE_F64) {
-				if !lexer.CheckKeyword("n", TYPE, TYPE_FN) {
-					if !lexer.CheckKeyword("or", FOR, nil) {
-						if !lexer.CheckKeyword("alse", FALSE, false) {
-							break
-						}
-					}
-				}
-			}
-		}
-		return true
-	case 'b':
-		if !lexer.CheckKeyword("ool", TYPE, TYPE_BOOL) {
-			if !lexer.CheckKeyword("reak", BREAK, nil) {
-				break
-			}
-		}
-		return true
-	case 's':
-		if !lexer.CheckKeyword("truct", TYPE, TYPE_STRUCT) {
-			if !lexer.CheckKeyword("witch", SWITCH, nil) {
-				if !lexer.CheckKeyword("tring", TYPE, TYPE_STRING){
-					break
-				}
-			}
-		}
-		return true
-	case 'a':
-		if !lexer.CheckKeyword("ny", TYPE, TYPE_ANY) {
-			if !lexer.CheckKeyword("nd", AND, nil) {
-				break
-			}
-		}
-		return true
-	case 'n':
-		if !lexer.CheckKeyword("ull", NULL, nil) {
-			break
-		}
-		return true
-	case 'r':
-		if !lexer.CheckKeyword("et", RETURN, nil) {
-			break
+	// exponent e.g. 1e-9
+	if lexer.Consumer.Expect('e') || lexer.Consumer.Expect('E') {
+		s.WriteRune(lexer.Consumer.Advance())
+		if lexer.Consumer.Expect('+') || lexer.Consumer.Expect('-') {
+			s.WriteRune(lexer.Consumer.Advance())
 		}
-		return true
-	case 'e':
-		if !lexer.CheckKeyword("lif", ELIF, nil) {
-			if !lexer.CheckKeyword("lse", ELSE, nil) {
-				break
-			}
+		if lexer.Consumer.End() || !IsNum(lexer.Consumer.Peek()) {
+			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "expected digits in exponent")
+			return false
 		}
-		return true
-	case 'c':
-		if !lexer.CheckKeyword("ase", CASE, nil) {
-			if !lexer.CheckKeyword("ontinue", CONTINUE, nil) {
-				break
+		for !lexer.Consumer.End() && (IsNum(lexer.Consumer.Peek()) || lexer.Consumer.Expect('_')) {
+			if n := lexer.Consumer.Advance(); n != '_' {
+				s.WriteRune(n)
 			}
 		}
-		return true
-	case 'o':
-		if !lexer.CheckKeyword("r", OR, nil) {
-			break
+	}
+	return lexer.NumberSuffix(&s)
+}
+
+// read the optional type suffix of a number literal and emit the literal
+func (lexer *Lexer) NumberSuffix(s *strings.Builder) bool {
+	suffix := strings.Builder{}
+	for !lexer.Consumer.End() && IsIdentContinue(lexer.Consumer.Peek()) {
+		suffix.WriteRune(lexer.Consumer.Advance())
+	}
+	if suffix.Len() > 0 {
+		if _, ok := NumberSuffixes[suffix.String()]; !ok {
+			lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "invalid suffix '"+suffix.String()+"' on number literal")
+			return false
 		}
-		return true
-	case 'p':
-		if !lexer.CheckKeyword("ack", PACK, nil) {
-			break
+		s.WriteString(suffix.String())
+	}
+	lexer.Tok(NLITERAL, s.String())
+	return true
+}
+
+type Keyword struct {
+	Type  uint32
+	Value interface{}
+}
+
+// keywords and built in types, identifiers are scanned in full and then looked up here
+// so an identifier that starts with a keyword (e.g. iffy or format) is still an identifier
+var Keywords = map[string]Keyword{
+	"u8": {TYPE, TYPE_U8}, "u16": {TYPE, TYPE_U16}, "u32": {TYPE, TYPE_U32}, "u64": {TYPE, TYPE_U64},
+	"i8": {TYPE, TYPE_I8}, "i16": {TYPE, TYPE_I16}, "i32": {TYPE, TYPE_I32}, "i64": {TYPE, TYPE_I64},
+	"f32": {TYPE, TYPE_F32}, "f64": {TYPE, TYPE_F64},
+	"bool": {TYPE, TYPE_BOOL}, "string": {TYPE, TYPE_STRING}, "rune": {TYPE, TYPE_RUNE}, "any": {TYPE, TYPE_ANY},
+	"fn": {TYPE, TYPE_FN}, "struct": {TYPE, TYPE_STRUCT}, "union": {TYPE, TYPE_UNION}, "interface": {TYPE, TYPE_INTERFACE},
+	"if": {IF, nil}, "elif": {ELIF, nil}, "else": {ELSE, nil}, "for": {FOR, nil}, "break": {BREAK, nil},
+	"continue": {CONTINUE, nil}, "ret": {RETURN, nil}, "switch": {SWITCH, nil}, "case": {CASE, nil},
+	"match": {MATCH, nil}, "and": {AND, nil}, "or": {OR, nil}, "null": {NULL, nil},
+	"true": {TRUE, true}, "false": {FALSE, false}, "pack": {PACK, nil},
+}
+
+// directives are keywords that follow a '#'
+var DirectiveKeywords = map[string]Keyword{
+	"def": {DEF, nil}, "run": {RUN, nil}, "ifdef": {IFDEF, nil}, "endif": {ENDIF, nil}, "hide": {HIDE, nil},
+	"pack": {PACK, nil}, "expose": {EXPOSE, nil}, "import": {IMPORT, nil}, "native": {NATIVE, nil},
+	"allow": {ALLOW, nil}, "type_info": {TYPE_INFO, nil}, "for": {FIELDS, nil},
+}
+
+// the span of the first byte that isn't valid utf-8, so the error points at it rather than the start of the file
+func InvalidUTF8(source string) Span {
+	position := Position{Line: 1, Indent: 1, Bytes: 1}
+	for i := 0; i < len(source); {
+		r, size := utf8.DecodeRuneInString(source[i:])
+		if r == utf8.RuneError && size <= 1 {
+			position.Offset = uint32(i)
+			end := position
+			end.Offset++
+			return Span{Start: position, End: end}
 		}
-		return true
-	case 't':
-		if !lexer.CheckKeyword("rue", TRUE, false) {
-			break
+		// \r\n and a lone \r both end a line
+		if r == '\n' || (r == '\r' && !strings.HasPrefix(source[i+1:], "\n")) {
+			position.Line++
+			position.Indent, position.Bytes = 1, 1
+		} else if r != '\r' {
+			position.Indent++
+			position.Bytes += uint32(size)
 		}
-		return true
+		i += size
 	}
+	return Span{}
+}
 
+// scan an identifier, starting with the rune that has already been consumed
+func (lexer *Lexer) Word(r rune) string {
 	var identifier strings.Builder
 	identifier.WriteRune(r)
-	p := lexer.Consumer.Peek()
-	for !lexer.Consumer.End() && (IsChar(p) || IsNum(p) || p == '_') {
-		identifier.WriteRune(lexer.Consumer.Peek())
-		lexer.Consumer.Advance()
-		p = lexer.Consumer.Peek()
+	for !lexer.Consumer.End() && IsIdentContinue(lexer.Consumer.Peek()) {
+		identifier.WriteRune(lexer.Consumer.Advance())
+	}
+	return identifier.String()
+}
+
+func (lexer *Lexer) Identifier(r rune) bool {
+	word := lexer.Word(r)
+	if keyword, ok := Keywords[word]; ok {
+		lexer.Tok(keyword.Type, keyword.Value)
+		return true
 	}
-	lexer.Tok(IDENTIFIER, identifier.String())
+	lexer.Tok(IDENTIFIER, word)
 	return true
 }
 
-// TODO fix bug where we find the keyword, e.g. else even though the comparison is elif
-func (lexer *Lexer) CheckKeyword(keyword string, tok uint32, value interface{}) bool {
-	l := len(keyword)
-	// check if the length is greater than the source string
-	if int(lexer.Consumer.Counter)+l > len(*lexer.Consumer.Source) {
+// lex the name of a type paramater e.g. $T, the value is the name without the '$'
+func (lexer *Lexer) TypeParam() bool {
+	if lexer.Consumer.End() || !IsIdentStart(lexer.Consumer.Peek()) {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNEXPECTED_CHAR, "unexpected character")
 		return false
 	}
-	valid := true
-	// compare to see if the runes match in the rest of the string
-	for i := 0; i < l; i++ {
-		if keyword[i] != (*lexer.Consumer.Source)[int(lexer.Consumer.Counter)+i] {
-			valid = false
-		}
+	lexer.Tok(POLY, lexer.Word(lexer.Consumer.Advance()))
+	return true
+}
+
+func (lexer *Lexer) Directive() bool {
+	if lexer.Consumer.End() || !IsIdentStart(lexer.Consumer.Peek()) {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNEXPECTED_CHAR, "unexpected character")
+		return false
 	}
-	// if they match then advance and return true
-	if valid {
-		lexer.Consumer.AdvanceMul(uint32(l))
-		lexer.Tok(tok, value)
+	word := lexer.Word(lexer.Consumer.Advance())
+	directive, ok := DirectiveKeywords[word]
+	if !ok {
+		lexer.Compiler.Critical(lexer.Consumer.Reporter, ERR_UNKNOWN_DIRECTIVE, "unknown directive '#"+word+"'")
+		return false
 	}
-	return valid
+	lexer.Tok(directive.Type, directive.Value)
+	return true
 }
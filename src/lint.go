@@ -0,0 +1,104 @@
+package src
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// what happens when a lint is triggered
+	LINT_ALLOW uint8 = 0x0
+	LINT_WARN  uint8 = 0x1
+	LINT_DENY  uint8 = 0x2
+)
+
+// a lint is a named warning, its level can be changed with -Wname=level or #allow(name)
+type Lint struct {
+	Code  uint32
+	Level uint8 // the level used unless it is changed
+}
+
+var Lints = map[string]*Lint{
+	"unused_variable":    {WARN_UNUSED_VARIABLE, LINT_WARN},
+	"unused_parameter":   {WARN_UNUSED_PARAMETER, LINT_WARN},
+	"unused_function":    {WARN_UNUSED_FUNCTION, LINT_WARN},
+	"shadowing":          {WARN_SHADOWING, LINT_WARN},
+	"unreachable_code":   {WARN_UNREACHABLE_CODE, LINT_WARN},
+	"constant_condition": {WARN_CONSTANT_CONDITION, LINT_WARN},
+	"narrowing":          {WARN_NARROWING, LINT_WARN},
+}
+
+var LintLevels = map[string]uint8{"allow": LINT_ALLOW, "warn": LINT_WARN, "deny": LINT_DENY}
+
+// a range of source where a lint was allowed with #allow(name)
+type Allowed struct {
+	Lint string
+	Span Span
+}
+
+// get the level of a lint at a position in the source, #allow takes priority over the command line
+func (compiler *Compiler) LintLevel(name string, position Position) uint8 {
+	for _, allowed := range compiler.Allowed {
+		if allowed.Lint == name && position.Offset > allowed.Span.Start.Offset && position.Offset <= allowed.Span.End.Offset {
+			return LINT_ALLOW
+		}
+	}
+	level := Lints[name].Level
+	if compiler.Options != nil {
+		if l, ok := compiler.Options.Lints[name]; ok {
+			level = l
+		}
+		if level == LINT_WARN && compiler.Options.Werror {
+			level = LINT_DENY
+		}
+	}
+	return level
+}
+
+// report a lint at the current position of the reporter. denied lints are reported as errors,
+// unlike critical errors the compiler carries on so every denied lint is reported
+func (compiler *Compiler) Lint(reporter *Reporter, name string, msg string, notes ...Note) {
+	level := compiler.LintLevel(name, reporter.Position)
+	key := name + ":" + strconv.FormatUint(uint64(reporter.Position.Offset), 10) + ":" + msg
+	if level == LINT_ALLOW || compiler.Linted[key] {
+		return
+	}
+	if compiler.Linted == nil {
+		compiler.Linted = make(map[string]bool)
+	}
+	compiler.Linted[key] = true
+	notes = append(notes, Note{Message: "this is the " + name + " warning, use #allow(" + name + ") to silence it"})
+	if level == LINT_WARN {
+		compiler.Warning(reporter, Lints[name].Code, msg, notes...)
+		return
+	}
+	compiler.Emit(NewDiagnostic(CRITICAL, reporter, Lints[name].Code, msg, notes))
+	compiler.Errors++
+}
+
+// stop compiling if any errors have been reported
+func (compiler *Compiler) StopOnErrors() {
+	if compiler.Errors > 0 {
+		compiler.Flush()
+		os.Exit(2)
+	}
+}
+
+// parse a -W flag, either -Werror or -Wname=level
+func (options *Options) ParseLint(arg string) bool {
+	if arg == "-Werror" {
+		options.Werror = true
+		return true
+	}
+	name, value := arg[2:], ""
+	if i := strings.IndexByte(name, '='); i >= 0 {
+		name, value = name[:i], name[i+1:]
+	}
+	level, ok := LintLevels[value]
+	if Lints[name] == nil || !ok {
+		return false
+	}
+	options.Lints[name] = level
+	return true
+}
@@ -0,0 +1,79 @@
+package src
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// colour diagnostics when writing to a terminal
+	COLOR_AUTO   uint8 = 0x0
+	COLOR_ALWAYS uint8 = 0x1
+	COLOR_NEVER  uint8 = 0x2
+
+	// how diagnostics are written
+	DIAGNOSTICS_HUMAN uint8 = 0x0
+	DIAGNOSTICS_JSON  uint8 = 0x1
+	DIAGNOSTICS_SARIF uint8 = 0x2
+)
+
+// options passed to the compiler on the command line
+type Options struct {
+	Color       uint8
+	Diagnostics uint8
+	Lints       map[string]uint8 // lint levels set with -Wname=level
+	Werror      bool             // treat warnings as errors
+}
+
+func NewOptions() *Options {
+	return &Options{Color: COLOR_AUTO, Diagnostics: DIAGNOSTICS_HUMAN, Lints: map[string]uint8{}}
+}
+
+// parse the --flags and -W flags out of the command line arguments, returning the options and the remaining arguments
+func ParseOptions(args []string) (*Options, []string, error) {
+	options := NewOptions()
+	var rest []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-W") {
+			if !options.ParseLint(arg) {
+				return nil, nil, errors.New("-W must be -Werror or -Wname=allow|warn|deny with the name of a warning")
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+		name, value := arg[2:], ""
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		switch name {
+		case "color":
+			switch value {
+			case "auto":
+				options.Color = COLOR_AUTO
+			case "always":
+				options.Color = COLOR_ALWAYS
+			case "never":
+				options.Color = COLOR_NEVER
+			default:
+				return nil, nil, errors.New("--color must be auto, always or never")
+			}
+		case "diagnostics":
+			switch value {
+			case "human":
+				options.Diagnostics = DIAGNOSTICS_HUMAN
+			case "json":
+				options.Diagnostics = DIAGNOSTICS_JSON
+			case "sarif":
+				options.Diagnostics = DIAGNOSTICS_SARIF
+			default:
+				return nil, nil, errors.New("--diagnostics must be human, json or sarif")
+			}
+		default:
+			return nil, nil, errors.New("unknown option " + arg)
+		}
+	}
+	return options, rest, nil
+}
@@ -1,13 +1,10 @@
 package src
 
 import (
+	"math"
 	"strconv"
 	"strings"
-)
-
-const (
-	ERR_UNEXPECTED_TOKEN = 0x0
-	ERR_INVALID_TYPE     = 0x1
+	"unicode/utf8"
 )
 
 // buffer the current active directives so we can process the rest of the tokens
@@ -21,6 +18,13 @@ type Parser struct {
 	SymTable     *SymTable
 	Root         *RootAST
 	DirectiveBuf *DirectiveBuf
+	// the type paramaters used by the top level decleration being parsed
+	TypeParams []*TypeParam
+	// the type arguments when parsing an instance of a generic decleration, keyed by the type paramater
+	Subst map[string]TavType
+	// set while parsing the fields of a struct or the statements of a function, where every decleration is a
+	// variable so fn i32 (); is a type rather than a prototype
+	Local bool
 }
 
 func Parse(compiler *Compiler, tokens []*Token) *RootAST {
@@ -32,35 +36,169 @@ func Parse(compiler *Compiler, tokens []*Token) *RootAST {
 		Consumer: consumer,
 		SymTable: NewSymTable(),
 	}
+	parser.Declarations()
 	parser.Root = parser.Run()
 	return parser.Root
 }
 
-func (parser *Parser) Run() *RootAST {
-	Root := &RootAST{}
-	for !parser.Consumer.End() {
-		t := parser.Consumer.Peek()
-		// any top level expression is an identifier
+// find the names of the top level structs, unions and interfaces before parsing, so struct literals and casts are
+// recognised even if the decleration comes later in the file. every other name is declared by the resolver
+func (parser *Parser) Declarations() {
+	tokens := parser.Consumer.Tokens
+	depth := 0
+	for i, t := range tokens {
 		switch t.Type {
+		case LEFT_CURLY:
+			depth++
+		case RIGHT_CURLY:
+			depth--
 		case IDENTIFIER:
-			Root.Statements = append(Root.Statements, parser.Define())
-		default:
-			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "unexpected token")
+			if depth != 0 || i+2 >= len(tokens) || tokens[i+1].Type != COLON || tokens[i+2].Type != TYPE {
+				continue
+			}
+			// methods are only found through their struct e.g. Vec2.len
+			if i > 0 && tokens[i-1].Type == PERIOD {
+				continue
+			}
+			switch kind := tokens[i+2].Value.(uint32); kind {
+			case TYPE_STRUCT, TYPE_UNION, TYPE_INTERFACE:
+				parser.SymTable.Add(t.Lexme(), NewTavType(kind, "", 0, nil), nil)
+			}
 		}
 	}
+}
+
+func (parser *Parser) Run() *RootAST {
+	Root := &RootAST{}
+	start := parser.Consumer.Peek()
+	for !parser.Consumer.End() {
+		Root.Statements = append(Root.Statements, parser.Global())
+	}
+	parser.Mark(Root, start)
 	return Root
 }
 
+// parse a top level decleration
+func (parser *Parser) Global() AST {
+	if parser.Consumer.Consume(ALLOW) != nil {
+		return parser.Allow(parser.Global)
+	}
+	// any top level expression is an identifier
+	if !parser.Consumer.Expect(IDENTIFIER) {
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "unexpected token")
+	}
+	parser.TypeParams = nil
+	start := parser.Consumer.Counter
+	var global AST
+	if parser.Consumer.ExpectAhead(PERIOD, 1) {
+		global = parser.Method()
+	} else if parser.Consumer.ExpectAhead(CONST_ASSIGN, 1) {
+		global = parser.ConstDefine()
+	} else if parser.Consumer.ExpectAhead(QUICK_ASSIGN, 1) {
+		global = parser.QuickAssign()
+	} else {
+		global = parser.Define()
+	}
+	// structs and functions end with their body, global variables end with a ';'
+	if _, ok := global.(*VarDefAST); ok {
+		parser.Consumer.ConsumeErr(SEMICOLON, ERR_UNEXPECTED_TOKEN, "expected ';' after global decleration")
+	}
+	if parser.TypeParams != nil && parser.Subst == nil {
+		parser.Generic(global, parser.Consumer.Tokens[start:parser.Consumer.Counter])
+	}
+	return global
+}
+
+// keep the tokens of a decleration that uses type paramaters, so instances can be parsed from them
+func (parser *Parser) Generic(global AST, tokens []*Token) {
+	generic := &Generic{Params: parser.TypeParams, Tokens: tokens, SymTable: parser.SymTable}
+	switch global := global.(type) {
+	case *FnAST:
+		// the type paramaters of a method are those of its struct, this is checked when it is resolved
+		// type paramaters used only inside the body e.g. in a closure can never be inferred
+		if !FnType(global).IsGeneric() {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_TYPE_PARAM, "'$"+parser.TypeParams[0].Name.Lexme()+"' isn't a type paramater of '"+global.Identifier.Lexme()+"'",
+				Note{Span: parser.TypeParams[0].Name.Span, Message: "a function is generic if its paramaters or return type use a type paramater"})
+		}
+		global.Generic = generic
+	case *StructAST:
+		global.Generic = generic
+	default:
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_TYPE_PARAM, "only functions and structs can have type paramaters")
+	}
+}
+
+// parse an instance of a generic decleration with its type paramaters replaced by the type arguments,
+// the instance is named after them e.g. max[i32]
+func Instantiate(compiler *Compiler, generic *Generic, name string, args map[string]TavType) AST {
+	reporter := NewReporter(compiler.File.Filename, compiler.File.Source)
+	parser := Parser{
+		Compiler: compiler,
+		Consumer: NewParseConsumer(generic.Tokens, reporter, compiler),
+		SymTable: generic.SymTable,
+		Subst:    args,
+	}
+	global := parser.Global()
+	switch global := global.(type) {
+	case *FnAST:
+		identifier := *global.Identifier
+		identifier.Value = name
+		global.Identifier = &identifier
+	case *StructAST:
+		identifier := *global.Identifier
+		identifier.Value = name
+		global.Identifier = &identifier
+	}
+	return global
+}
+
+// a note for the errors inside an instance, saying where it was made and what its type paramaters are
+func Made(generic *Generic, name string, args map[string]TavType, span Span) *Note {
+	var bound []string
+	for _, param := range generic.Params {
+		bound = append(bound, "$"+param.Name.Lexme()+" is "+args[param.Name.Lexme()].String())
+	}
+	return &Note{Span: span, Message: "in '" + name + "', made here where " + strings.Join(bound, ", ")}
+}
+
+// parse #allow(lint, ...) followed by the decleration or statement that the lints are allowed in
+func (parser *Parser) Allow(next func() AST) AST {
+	var lints []*Token
+	parser.Consumer.ConsumeErr(LEFT_PAREN, ERR_UNEXPECTED_TOKEN, "expected '(' after #allow")
+	for {
+		lint := parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected the name of a warning")
+		if Lints[lint.Lexme()] == nil {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNKNOWN_LINT, "unknown warning '"+lint.Lexme()+"'")
+		}
+		lints = append(lints, lint)
+		if parser.Consumer.Consume(COMMA) == nil {
+			break
+		}
+	}
+	parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+	ast := next()
+	for _, lint := range lints {
+		parser.Compiler.Allowed = append(parser.Compiler.Allowed, Allowed{Lint: lint.Lexme(), Span: ast.Span()})
+	}
+	return ast
+}
+
 func (parser *Parser) Prelim() AST {
 	return parser.Statement()
 }
 
 func (parser *Parser) Statement() AST {
 	var ast AST
+	start := parser.Consumer.Peek()
+	if parser.Consumer.Consume(ALLOW) != nil {
+		return parser.Allow(parser.Statement)
+	}
 	if parser.Consumer.Expect(IDENTIFIER) && parser.Consumer.ExpectAhead(COLON,1) {
 		ast = parser.Define()
 	} else if parser.Consumer.Expect(IDENTIFIER) && parser.Consumer.ExpectAhead(QUICK_ASSIGN,1) {
 		ast = parser.QuickAssign()
+	} else if parser.Consumer.Expect(IDENTIFIER) && parser.Consumer.ExpectAhead(CONST_ASSIGN,1) {
+		ast = parser.ConstDefine()
 	} else if parser.Consumer.Expect(IDENTIFIER) {
 		ast = parser.Assignment()
 	} else if parser.Consumer.Consume(RETURN) != nil {
@@ -68,23 +206,33 @@ func (parser *Parser) Statement() AST {
 	} else if parser.Consumer.Consume(BREAK) != nil {
 		ast = parser.Break()
 	} else if parser.Consumer.Consume(FOR) != nil {
-		return parser.For()
+		return parser.Mark(parser.For(), start)
 	} else if parser.Consumer.Consume(IF) != nil {
-		return parser.If()
+		return parser.Mark(parser.If(), start)
+	} else if parser.Consumer.Consume(MATCH) != nil {
+		return parser.Mark(parser.Match(), start)
+	} else if parser.Consumer.Consume(FIELDS) != nil {
+		return parser.Mark(parser.Fields(), start)
 	} else if parser.Consumer.Expect(LEFT_CURLY) {
-		return &BlockAST{Statements: parser.ParseStmtBlock()}
+		return parser.Mark(&BlockAST{Statements: parser.ParseStmtBlock()}, start)
 	} else {
 		ast = parser.ExpressionStmt()
 	}
+	parser.Mark(ast, start)
 	parser.Consumer.ConsumeErr(SEMICOLON, ERR_UNEXPECTED_TOKEN, "expected ';' at end of statement")
 	return ast
 }
 
 func (parser *Parser) ExpressionStmt() AST {
-	return &ExprStmtAST{Expression: parser.Expression()}
+	start := parser.Consumer.Peek()
+	return parser.Mark(&ExprStmtAST{Expression: parser.Expression()}, start)
 }
 
 func (parser *Parser) Return() AST {
+	// functions that return nothing use ret; without a value
+	if parser.Consumer.Expect(SEMICOLON) {
+		return &ReturnAST{}
+	}
 	r := &ReturnAST{Value: parser.Expression()}
 	return r
 }
@@ -102,6 +250,70 @@ func (parser *Parser) For() AST {
 	return f
 }
 
+// parse a loop over the fields of a struct e.g. #for f : Vec2 {...}, the body is kept as tokens to be
+// parsed for each field once the resolver knows them
+func (parser *Parser) Fields() AST {
+	f := &FieldsAST{SymTable: parser.SymTable, Subst: parser.Subst}
+	f.Identifier = parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected a name for each field after #for")
+	// #for v.f : T {...} also names the value whose fields the body uses
+	if parser.Consumer.Consume(PERIOD) != nil {
+		f.Root = f.Identifier
+		f.Identifier = parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected a name for each field after '"+f.Root.Lexme()+".'")
+	}
+	parser.Consumer.ConsumeErr(COLON, ERR_UNEXPECTED_TOKEN, "expected ':' after the name of the field")
+	f.Type = *parser.ParseType()
+	start := parser.Consumer.Counter
+	// the body is parsed once here so any syntax errors are reported even if the struct has no fields
+	parser.Statement()
+	f.Tokens = parser.Consumer.Tokens[start:parser.Consumer.Counter]
+	return f
+}
+
+// parse the body of a loop over the fields of a struct for one of its fields
+func Unroll(compiler *Compiler, loop *FieldsAST, field string) AST {
+	reporter := NewReporter(compiler.File.Filename, compiler.File.Source)
+	tokens := make([]*Token, len(loop.Tokens))
+	// a declaration of v in the body hides the value being looped over, so v.f is left alone from the end of
+	// the declaration to the end of its block. for #for v : T {...} that is the body of the inner loop
+	depth, shadowed, pending, block := 0, -1, -1, false
+	for i, t := range loop.Tokens {
+		tokens[i] = t
+		switch {
+		case t.Type == LEFT_CURLY:
+			depth++
+			if block && pending == depth-1 {
+				shadowed, pending = depth, -1
+			}
+		case t.Type == RIGHT_CURLY:
+			if shadowed == depth {
+				shadowed = -1
+			}
+			depth--
+		case t.Type == SEMICOLON && !block && pending == depth:
+			shadowed, pending = depth, -1
+		case loop.Root != nil && shadowed == -1 && t.Type == IDENTIFIER && t.Lexme() == loop.Root.Lexme() && i+1 < len(loop.Tokens) &&
+			(loop.Tokens[i+1].Type == COLON || loop.Tokens[i+1].Type == QUICK_ASSIGN || loop.Tokens[i+1].Type == CONST_ASSIGN) &&
+			(i == 0 || loop.Tokens[i-1].Type != PERIOD):
+			pending, block = depth, i > 0 && loop.Tokens[i-1].Type == FIELDS
+		}
+		// only v.f is the field, not x.v.f or any other value's f
+		if loop.Root != nil && shadowed == -1 && i > 1 && t.Type == IDENTIFIER && t.Lexme() == loop.Identifier.Lexme() && loop.Tokens[i-1].Type == PERIOD &&
+			loop.Tokens[i-2].Type == IDENTIFIER && loop.Tokens[i-2].Lexme() == loop.Root.Lexme() && (i == 2 || loop.Tokens[i-3].Type != PERIOD) {
+			member := *t
+			member.Value = field
+			tokens[i] = &member
+		}
+	}
+	parser := Parser{
+		Compiler: compiler,
+		Consumer: NewParseConsumer(tokens, reporter, compiler),
+		SymTable: loop.SymTable,
+		Subst:    loop.Subst,
+		Local:    true,
+	}
+	return parser.Statement()
+}
+
 func (parser *Parser) If() AST {
 	ifStmt := &IfAST{
 		IfCondition:   nil,
@@ -122,13 +334,44 @@ func (parser *Parser) If() AST {
 	return ifStmt
 }
 
+// parse a match statement, each arm is either 'case Variant(binding) stmt' or 'else stmt'
+func (parser *Parser) Match() AST {
+	match := &MatchAST{Value: parser.Expression()}
+	parser.Consumer.ConsumeErr(LEFT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '{' after match value")
+	for !parser.Consumer.Expect(RIGHT_CURLY) && !parser.Consumer.End() {
+		if parser.Consumer.Consume(ELSE) != nil {
+			if match.ElseBody != nil {
+				parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "match can only have one 'else'")
+			}
+			match.ElseBody = parser.Statement()
+			continue
+		}
+		parser.Consumer.ConsumeErr(CASE, ERR_UNEXPECTED_TOKEN, "expected 'case' or 'else' in match")
+		matchCase := &MatchCase{
+			Variant: parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected union variant after 'case'"),
+		}
+		// the payload binding is optional
+		if parser.Consumer.Consume(LEFT_PAREN) != nil {
+			matchCase.Binding = parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected payload binding")
+			parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+		}
+		matchCase.Body = parser.Statement()
+		match.Cases = append(match.Cases, matchCase)
+	}
+	parser.Consumer.ConsumeErr(RIGHT_CURLY, ERR_UNEXPECTED_TOKEN, "expected closing '}'")
+	return match
+}
+
 func (parser *Parser) ParseStmtBlock() []AST {
-	parser.SymTable.NewScope("block_body")
+	parser.SymTable.NewScope()
 	parser.Consumer.ConsumeErr(LEFT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '{' at start of statement block")
 	var statements []AST
+	local := parser.Local
+	parser.Local = true
 	for !parser.Consumer.Expect(RIGHT_CURLY) && !parser.Consumer.End() {
 		statements = append(statements, parser.Statement())
 	}
+	parser.Local = local
 	parser.Consumer.ConsumeErr(RIGHT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '}' at end of statement block")
 	parser.SymTable.PopScope()
 	return statements
@@ -137,39 +380,116 @@ func (parser *Parser) ParseStmtBlock() []AST {
 // parse a struct
 func (parser *Parser) Struct(identifier *Token) AST {
 	name := identifier.Lexme()
-	parser.SymTable.NewScope(name + "_members")
-
 	s := &StructAST{Identifier: identifier}
+	// the interfaces it implements are listed in parentheses e.g. Circle : struct (Shape) {...}
+	if parser.Consumer.Consume(LEFT_PAREN) != nil {
+		for !parser.Consumer.Expect(RIGHT_PAREN) {
+			// so are its type paramaters e.g. Box : struct ($T) {...}
+			if t := parser.Consumer.Consume(POLY); t != nil {
+				parser.TypeParam(t, TavType{})
+			} else {
+				s.Implements = append(s.Implements, parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected the name of an interface"))
+			}
+			if parser.Consumer.Consume(COMMA) == nil {
+				break
+			}
+		}
+		parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+	}
+	// the fields of a packed struct have no padding between them e.g. Header : struct #pack {...}
+	s.Packed = parser.Consumer.Consume(PACK) != nil
 	parser.Consumer.ConsumeErr(LEFT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '{' after 'struct'")
 
+	local := parser.Local
+	parser.Local = true
 	for !parser.Consumer.Expect(RIGHT_CURLY) {
-		member := parser.Define().(*VarDefAST)
+		start := parser.Consumer.Peek()
+		member, ok := parser.Define().(*VarDefAST)
+		if !ok {
+			parser.Consumer.Reporter.Mark(start.Span)
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "only fields can be declared in a struct",
+				Note{Message: "methods are declared outside of the struct e.g. " + name + ".len : fn i32 (self : *" + name + ") {...}"})
+		}
 		s.Fields = append(s.Fields, member)
 		parser.Consumer.ConsumeErr(SEMICOLON, ERR_UNEXPECTED_TOKEN, "expected ';' after member decleration")
 	}
+	parser.Local = local
 
 	parser.Consumer.ConsumeErr(RIGHT_CURLY, ERR_UNEXPECTED_TOKEN, "expected closing '}'")
-	parser.SymTable.PopScope()
 
 	// add the identifier to the current symbol table
 	parser.SymTable.Add(name, NewTavType(TYPE_STRUCT, "", 0, nil), nil)
 
-	return s
+	return parser.Mark(s, identifier)
+}
+
+// parse a tagged union, variants are separated by either ',' or ';'
+func (parser *Parser) Union(identifier *Token) AST {
+	name := identifier.Lexme()
+	u := &UnionAST{Identifier: identifier}
+	parser.Consumer.ConsumeErr(LEFT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '{' after 'union'")
+
+	for !parser.Consumer.Expect(RIGHT_CURLY) && !parser.Consumer.End() {
+		variant := parser.Define().(*VarDefAST)
+		u.Variants = append(u.Variants, variant)
+		if parser.Consumer.Consume(COMMA) == nil && parser.Consumer.Consume(SEMICOLON) == nil {
+			break
+		}
+	}
+
+	parser.Consumer.ConsumeErr(RIGHT_CURLY, ERR_UNEXPECTED_TOKEN, "expected closing '}'")
+
+	// add the identifier to the current symbol table
+	parser.SymTable.Add(name, NewTavType(TYPE_UNION, "", 0, nil), nil)
+
+	return parser.Mark(u, identifier)
+}
+
+// parse an interface, each method is declared like a function without a body e.g. area : fn f32 ();
+func (parser *Parser) Interface(identifier *Token) AST {
+	i := &InterfaceAST{Identifier: identifier}
+	parser.Consumer.ConsumeErr(LEFT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '{' after 'interface'")
+
+	for !parser.Consumer.Expect(RIGHT_CURLY) && !parser.Consumer.End() {
+		if !parser.Consumer.Expect(IDENTIFIER) {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "expected the name of a method")
+		}
+		// the methods are only found through a value of the interface
+		parser.SymTable.NewScope()
+		local := parser.Local
+		parser.Local = false
+		method, ok := parser.Define().(*FnAST)
+		parser.Local = local
+		parser.SymTable.PopScope()
+		if !ok || !method.Proto {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "expected the signature of a method e.g. area : fn f32 ();")
+		}
+		i.Methods = append(i.Methods, method)
+	}
+
+	parser.Consumer.ConsumeErr(RIGHT_CURLY, ERR_UNEXPECTED_TOKEN, "expected closing '}'")
+
+	// add the identifier to the current symbol table
+	parser.SymTable.Add(identifier.Lexme(), NewTavType(TYPE_INTERFACE, "", 0, nil), nil)
+
+	return parser.Mark(i, identifier)
 }
 
 // parse a function
 func (parser *Parser) Fn(identifier *Token) AST { // add the identifier to the current symbol table
 
-	name := identifier.Lexme()
 	f := &FnAST{Identifier: identifier, RetType: *parser.ParseType()}
 
-	parser.SymTable.Add(name, NewTavType(TYPE_FN, "", 0, &f.RetType), nil)
-
-	parser.SymTable.NewScope(name + "_body")
+	parser.SymTable.NewScope()
 	if parser.Consumer.Consume(LEFT_PAREN) != nil {
 		var params []VarDefAST
 		// process the arguments
 		for !parser.Consumer.Expect(RIGHT_PAREN) {
+			// prototypes of c functions such as printf can take any number of extra arguments
+			if parser.Consumer.Consume(VARIADIC) != nil {
+				f.Variadic = true
+				break
+			}
 			// each paramater is essentially a variable decleration
 			params = append(params, *parser.Define().(*VarDefAST))
 			if parser.Consumer.Expect(RIGHT_PAREN) {
@@ -184,15 +504,40 @@ func (parser *Parser) Fn(identifier *Token) AST { // add the identifier to the c
 	// parse the function body
 	// this is not a statement block, we need the paramaters and the body in the name scope
 	if parser.Consumer.Consume(LEFT_CURLY)!=nil {
+		local := parser.Local
+		parser.Local = true
 		for parser.Consumer.Consume(RIGHT_CURLY)==nil {
 			statements = append(statements, parser.Statement())
 		}
+		parser.Local = local
 		f.Body = statements
 	} else {
 		parser.Consumer.ConsumeErr(SEMICOLON, ERR_UNEXPECTED_TOKEN, "expected ';' after fn deceleration")
+		f.Proto = true
 	}
+	parser.SymTable.PopScope()
 	f.Body = statements
-	return f
+	return parser.Mark(f, identifier)
+}
+
+// parse a method of a struct e.g. Vec2.len : fn f32 (self : *Vec2) {...}
+func (parser *Parser) Method() AST {
+	receiver := parser.Consumer.Consume(IDENTIFIER)
+	parser.Consumer.Consume(PERIOD)
+	identifier := parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected the name of the method")
+	parser.Consumer.ConsumeErr(COLON, ERR_UNEXPECTED_TOKEN, "expected ':' after the name of the method")
+	if t := parser.ParseType(); t.Type != TYPE_FN || t.RetType != nil {
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "expected a function after '"+receiver.Lexme()+"."+identifier.Lexme()+"'")
+	}
+	// the method is kept out of the global scope, so it doesn't hide a function of the same name
+	parser.SymTable.NewScope()
+	f := parser.Fn(identifier).(*FnAST)
+	parser.SymTable.PopScope()
+	if f.Proto {
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "expected the body of the method")
+	}
+	f.Receiver = receiver
+	return parser.Mark(f, receiver)
 }
 
 // parse a variable definition (this only includes the identifier and type e.g. X : i32;, and assigning to
@@ -212,16 +557,50 @@ func (parser *Parser) Define() AST {
 	switch def.Type.Type {
 	case TYPE_STRUCT:
 		return parser.Struct(identifier)
+	case TYPE_UNION:
+		return parser.Union(identifier)
+	case TYPE_INTERFACE:
+		return parser.Interface(identifier)
 	case TYPE_FN:
-		return parser.Fn(identifier)
+		// a variable that holds a function has its signature parsed as part of the type
+		if def.Type.RetType == nil {
+			return parser.Fn(identifier)
+		}
+		fallthrough
 	default:
 		if parser.Consumer.Consume(ASSIGN) != nil {
-			def.Assignment = parser.Expression()
+			if parser.Consumer.Consume(UNINIT) != nil {
+				def.Uninit = true
+			} else {
+				def.Assignment = parser.Expression()
+			}
 		}
-		// add the identifier to the current symbol table
-		parser.SymTable.Add(def.Identifier.Lexme(), def.Type, nil)
-		return def
+		return parser.Mark(def, identifier)
+	}
+}
+
+// check if a constant expression gets a member of something e.g. #type_info(T).size or f.offset, has a
+// #run that may call a function or names a constant that does. each is folded by the checker, once every
+// type is known
+func Member(expression AST) bool {
+	switch e := expression.(type) {
+	case *StructGetAST:
+		return true
+	case *VariableAST:
+		// constants the resolver could fold already are literals
+		return e.Symbol != nil && e.Symbol.Kind == SYMBOL_CONST
+	case *GroupAST:
+		return Member(e.Group)
+	case *CastAST:
+		return Member(e.Expr)
+	case *UnaryAST:
+		return Member(e.Right)
+	case *BinaryAST:
+		return Member(e.Left) || Member(e.Right)
+	case *RunAST:
+		return true
 	}
+	return false
 }
 
 // FOR NOW, WE DON'T SUPPORT QUICK ASSIGNING STRUCTS OR FUNCTIONS
@@ -229,18 +608,23 @@ func (parser *Parser) Define() AST {
 func (parser *Parser) QuickAssign() AST {
 	identifier := parser.Consumer.Consume(IDENTIFIER)
 	parser.Consumer.Consume(QUICK_ASSIGN)
+	// the type is inferred by the checker, once every name in the expression has been resolved
 	def := &VarDefAST{
 		Identifier: identifier,
 		Type:       TavType{},
-		Assignment: nil,
+		Assignment: parser.Expression(),
+		Inferred:   true,
 	}
-	// get the expression
-	def.Assignment = parser.Expression()
-	// then infer the type of the expression
-	def.Type = InferType(def.Assignment, parser.SymTable)
-	// add the identifier to the current symbol table
-	parser.SymTable.Add(identifier.Lexme(), def.Type, nil)
-	return def
+	return parser.Mark(def, identifier)
+}
+
+// parse a constant definition (e.g. X :: 16), the value is folded straight away so that
+// it can be used anywhere a constant is expected, such as the length of an array
+func (parser *Parser) ConstDefine() AST {
+	identifier := parser.Consumer.Consume(IDENTIFIER)
+	parser.Consumer.Consume(CONST_ASSIGN)
+	// the value is folded by the resolver, once it knows what each name in it refers to
+	return parser.Mark(&VarDefAST{Identifier: identifier, Assignment: parser.Expression(), Constant: true}, identifier)
 }
 
 // lowest precidence expression
@@ -249,250 +633,351 @@ func (parser *Parser) Expression() AST {
 }
 
 func (parser *Parser) Assignment() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.ConnectiveOr()
 	if parser.Consumer.Consume(ASSIGN) != nil {
 		assignValue := parser.ConnectiveOr()
-		// the only 2 types of assignments are to variables, and to struct members e.g. x = 2; or vec.x = 2;
+		// the only assignments are to variables, struct members and array elements e.g. x = 2; vec.x = 2; or arr[0] = 2;
 		switch ast := higherPrecedence.(type) {
 		case *VariableAST:
-			return &VarSetAST{
+			return parser.Mark(&VarSetAST{
 				Identifier: ast.Identifier,
 				Value:      assignValue,
-			}
+			}, start)
 		case *StructGetAST:
-			return &StructSetAST{
+			return parser.Mark(&StructSetAST{
 				Struct: ast.Struct,
 				Member: ast.Member,
 				Value:  assignValue,
 				Deref:  ast.Deref,
-			}
+			}, start)
+		case *IndexAST:
+			return parser.Mark(&IndexSetAST{
+				Array: ast.Array,
+				Index: ast.Index,
+				Value: assignValue,
+			}, start)
 		}
+		parser.Consumer.Reporter.Mark(higherPrecedence.Span())
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "can only assign to a variable, a member or an array element")
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) ConnectiveOr() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.ConnectiveAnd()
 	for parser.Consumer.Expect(OR) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.ConnectiveOr(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) ConnectiveAnd() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.BitwiseOr()
 	for parser.Consumer.Expect(AND) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.ConnectiveAnd(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) BitwiseOr() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.BitwiseAnd()
 	for parser.Consumer.Expect(BIN_OR) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.BitwiseOr(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) BitwiseAnd() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.Equality()
 	for parser.Consumer.Expect(BIN_AND) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.BitwiseAnd(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) Equality() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.Comparison()
 	for parser.Consumer.Expect(EQUALS) || parser.Consumer.Expect(NOT_EQUALS) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.Equality(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) Comparison() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.BitwiseShift()
 	for parser.Consumer.Expect(GREAT_THAN) || parser.Consumer.Expect(GREAT_EQUAL) || parser.Consumer.Expect(LESS_THAN) || parser.Consumer.Expect(LESS_EQUAL) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.Comparison(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) BitwiseShift() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.PlusMinus()
 	for parser.Consumer.Expect(SLEFT) || parser.Consumer.Expect(SRIGHT) {
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.BitwiseShift(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) PlusMinus() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.MulDivModRem()
 	for parser.Consumer.Expect(PLUS) || parser.Consumer.Expect(MINUS) {
 		// TODO check here for compound assignment
 		// if parser.Consumer.Expect(ASSIGN){...}
-		b := &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.PlusMinus(),
-		}
-		return b
+		}, start)
 	}
 	return higherPrecedence
 }
 
 func (parser *Parser) MulDivModRem() AST {
+	start := parser.Consumer.Peek()
 	higherPrecedence := parser.Unary()
 	// TODO implement modulo and no-remainder division
 	for parser.Consumer.Expect(STAR) || parser.Consumer.Expect(DIV) {
 		// TODO check here for compound assignment
 		// if parser.Consumer.Expect(ASSIGN){...}
-		return &BinaryAST{
+		return parser.Mark(&BinaryAST{
 			Left:     higherPrecedence,
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.MulDivModRem(),
-		}
+		}, start)
 	}
 	return higherPrecedence
 }
 
 
 func (parser *Parser) Unary() AST {
+	start := parser.Consumer.Peek()
 	// TODO implement increment and decrement
-	// connective not, bitwise not, increment, decrement
-	for parser.Consumer.Expect(BANG) || parser.Consumer.Expect(WIGGLE) {
-		return &UnaryAST{
+	// connective not, bitwise not, negation, increment, decrement
+	for parser.Consumer.Expect(BANG) || parser.Consumer.Expect(WIGGLE) || parser.Consumer.Expect(MINUS) {
+		return parser.Mark(&UnaryAST{
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.Unary(),
-		}
+		}, start)
 	}
 	return parser.Casting()
 }
 
 func (parser *Parser) Casting() AST{
-	if parser.Consumer.Expect(LEFT_PAREN) && parser.IsType(parser.Consumer.PeekAhead(1)) && parser.Consumer.ExpectAhead(RIGHT_PAREN, 2){
+	if parser.Consumer.Expect(LEFT_PAREN) && (parser.IsType(parser.Consumer.PeekAhead(1)) && parser.Consumer.ExpectAhead(RIGHT_PAREN, 2) || parser.IsPtrCast()){
 		Log("casting!")
-		parser.Consumer.Consume(LEFT_PAREN)
+		start := parser.Consumer.Consume(LEFT_PAREN)
 		t := parser.ParseType()
 		parser.Consumer.Consume(RIGHT_PAREN)
-		return &CastAST{
+		return parser.Mark(&CastAST{
 			TavType: *t,
 			Expr:    parser.Casting(),
-		}
+		}, start)
 	}
 	return parser.Addressing()
 }
 
 func (parser *Parser) Addressing() AST {
+	start := parser.Consumer.Peek()
 	if parser.Consumer.Expect(ADDR) || parser.Consumer.Expect(STAR) {
-		return &UnaryAST{
+		return parser.Mark(&UnaryAST{
 			Operator: parser.Consumer.Advance(),
 			Right:    parser.Addressing(),
-		}
+		}, start)
 	}
 	return parser.Call()
 }
 
+// a function without paramaters named without parentheses e.g. main is also a call, that is decided by the
+// resolver once it knows what the name refers to
 func (parser *Parser) Call() AST {
+	start := parser.Consumer.Peek()
 	callee := parser.SingleVal()
-	// if the calle is a function e.g. 'main' and it doesn't have paramaters, it counts as a call
-	// we need some way of check
-
-	if InferType(callee, parser.SymTable).Type == TYPE_FN || InferType(callee, parser.SymTable).Type == TYPE_FN || parser.Consumer.Expect(LEFT_PAREN) {
-		var args []AST
+	// calls, indexing and member accesses can be chained e.g. r.min.x or Shape.Circle(1.0)
+	for {
 		if parser.Consumer.Consume(LEFT_PAREN) != nil {
-			for !parser.Consumer.Expect(RIGHT_PAREN) {
-				args = append(args, parser.Expression())
-				if parser.Consumer.Expect(RIGHT_PAREN) {
-					break
-				}
-				parser.Consumer.ConsumeErr(COMMA, ERR_UNEXPECTED_TOKEN, "expected ',' between arguments")
+			callee = &CallAST{
+				Caller: callee,
+				Args:   parser.Args(),
+			}
+		} else if parser.Consumer.Consume(LEFT_BRACKET) != nil {
+			callee = &IndexAST{
+				Array: callee,
+				Index: parser.Expression(),
+			}
+			parser.Consumer.ConsumeErr(RIGHT_BRACKET, ERR_UNEXPECTED_TOKEN, "expected closing ']'")
+		} else if parser.Consumer.Expect(PERIOD) && parser.Consumer.ExpectAhead(LEFT_PAREN, 1) {
+			// a downcast of an any e.g. x.(i32)
+			parser.Consumer.AdvanceMul(2)
+			callee = &CastAST{
+				TavType: *parser.ParseType(),
+				Expr:    callee,
+				Checked: true,
 			}
 			parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+		} else if parser.Consumer.Consume(PERIOD) != nil {
+			// struct member get
+			callee = &StructGetAST{
+				Struct: callee,
+				Member: parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected struct member"),
+				Deref:  false,
+			}
+		} else if parser.Consumer.Consume(DEREF) != nil {
+			// struct member dereference
+			callee = &StructGetAST{
+				Struct: callee,
+				Member: parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected struct member"),
+				Deref:  true,
+			}
+		} else {
+			return callee
 		}
-		return &CallAST{
-			Caller: callee,
-			Args:   args,
+		parser.Mark(callee, start)
+	}
+}
+
+// parse the arguments of a call, the opening '(' must already be consumed
+func (parser *Parser) Args() []AST {
+	var args []AST
+	for !parser.Consumer.Expect(RIGHT_PAREN) {
+		args = append(args, parser.Expression())
+		if parser.Consumer.Expect(RIGHT_PAREN) {
+			break
+		}
+		parser.Consumer.ConsumeErr(COMMA, ERR_UNEXPECTED_TOKEN, "expected ',' between arguments")
+	}
+	parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+	return args
+}
+
+// parse a number literal such as 0xff, 1_000i64 or 1e-9. literals without a type suffix are untyped,
+// they default to i32/f32 and are cast by the checker to the type their context expects
+func (parser *Parser) Number(t *Token) AST {
+	text := t.Value.(string)
+	based := len(text) > 1 && text[0] == '0' && strings.ContainsRune("xbo", rune(text[1]))
+	lit := &LiteralAST{Type: NewTavType(TYPE_I32, "", 0, nil), Untyped: true}
+	for suffix, typ := range NumberSuffixes {
+		// f is a hex digit so 0x1f32 has no suffix
+		if strings.HasSuffix(text, suffix) && !(based && text[1] == 'x' && suffix[0] == 'f') {
+			text = strings.TrimSuffix(text, suffix)
+			lit.Type, lit.Untyped = NewTavType(typ, "", 0, nil), false
+			break
+		}
+	}
+	float := !based && strings.ContainsAny(text, ".eE")
+	if float {
+		if lit.Type.IsInt() && !lit.Untyped {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "float literal cannot have an integer suffix")
 		}
-	} else if parser.Consumer.Consume(PERIOD) != nil {
-		// struct member get
-		return &StructGetAST{
-			Struct: callee,
-			Member: parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected struct member"),
-			Deref:  false,
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "float literal "+t.Value.(string)+" is out of range")
 		}
-	} else if parser.Consumer.Consume(DEREF) != nil {
-		// struct member dereference
-		return &StructGetAST{
-			Struct: callee,
-			Member: parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected struct member"),
-			Deref:  true,
+		if lit.Untyped {
+			lit.Type = NewTavType(TYPE_F32, "", 0, nil)
+		}
+		lit.Value.Float = value
+	} else {
+		base := 10
+		if based {
+			base = map[byte]int{'x': 16, 'b': 2, 'o': 8}[text[1]]
+			text = text[2:]
+		}
+		value, err := strconv.ParseUint(text, base, 64)
+		if err != nil && lit.Untyped {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "integer literal "+t.Value.(string)+" is too large for any integer type")
+		}
+		// only u64 can hold values larger than the max i64, an untyped literal is checked once it has a type
+		if err != nil || (value > math.MaxInt64 && lit.Type.Type != TYPE_U64 && !lit.Untyped) {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "integer literal "+t.Value.(string)+" overflows "+lit.Type.String())
+		}
+		if lit.Type.IsFloat() {
+			lit.Value.Float = float64(value)
+		} else {
+			lit.Value.Int = int64(value)
+			lit.Magnitude = value
 		}
 	}
-
-	return callee
+	if !lit.Untyped && !Fits(lit) {
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_INVALID_NUMBER_LITERAL, "literal "+t.Value.(string)+" overflows "+lit.Type.String())
+	}
+	return lit
 }
 
 func (parser *Parser) SingleVal() AST {
+	start := parser.Consumer.Peek()
 	if t := parser.Consumer.Consume(IDENTIFIER); t != nil {
-		return &VariableAST{Identifier: t}
-	} else if t := parser.Consumer.Consume(NLITERAL); t != nil {
-		// check if its a float
-		if strings.Contains(t.Value.(string), ".") {
-			value, err := strconv.ParseFloat(t.Value.(string), 64)
-			Assert(err == nil, "couldn't parse float string value")
-			return &LiteralAST{
-				Type: TavType{
-					Type: TYPE_F32,
-				},
-				Value: TavValue{
-					Float: value,
-				},
-			}
-		} else {
-			value, err := strconv.ParseInt(t.Value.(string), 10, 64)
-			Assert(err == nil, "couldn't parse int string value")
-			return &LiteralAST{
-				Type: TavType{
-					Type: TYPE_I32,
-				},
-				Value: TavValue{
-					Int: value,
-				},
-			}
+		if parser.Consumer.Expect(LEFT_CURLY) && parser.IsStruct(t) {
+			return parser.StructLit(t)
+		}
+		// a literal of an instance of a generic struct e.g. Box[i32]{1}
+		if parser.Consumer.Expect(LEFT_BRACKET) && parser.IsStruct(t) {
+			args := parser.TypeArgs()
+			identifier := *t
+			identifier.Value = InstanceName(t.Lexme(), args)
+			lit := parser.StructLit(&identifier).(*StructLitAST)
+			lit.Args = args
+			return parser.Mark(lit, start)
 		}
+		if t.Lexme() == "type_of" && parser.Consumer.Expect(LEFT_PAREN) {
+			return parser.Mark(parser.TypeOf(), start)
+		}
+		return parser.Mark(&VariableAST{Identifier: t}, start)
+	} else if parser.Consumer.Consume(TYPE_INFO) != nil {
+		// #type_info(T) only takes a type, so it is always known at compile time
+		parser.Consumer.ConsumeErr(LEFT_PAREN, ERR_UNEXPECTED_TOKEN, "expected '(' after #type_info")
+		if !parser.IsTypeArg(int(parser.Consumer.Counter)) {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "expected a type", Note{Message: "use type_of to get the type of a value"})
+		}
+		typeOf := &TypeOfAST{Type: parser.ParseType()}
+		parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+		return parser.Mark(typeOf, start)
+	} else if parser.Consumer.Consume(RUN) != nil {
+		return parser.Mark(&RunAST{Expr: parser.Expression()}, start)
+	} else if parser.Consumer.Expect(TYPE) && parser.Consumer.Peek().Value.(uint32) == TYPE_FN {
+		return parser.Mark(parser.Closure(), start)
+	} else if t := parser.Consumer.Consume(NLITERAL); t != nil {
+		return parser.Mark(parser.Number(t), start)
 	} else if t := parser.Consumer.Consume(SLITERAL); t != nil {
-		// parse the string literal into a character array here
-		return &LiteralAST{
+		// the generator adds the null terminator when it interns the string
+		return parser.Mark(&LiteralAST{
 			Type: TavType{
 				Type:        TYPE_STRING,
 				// TODO this should probably be 1 as a string is just an *i8
@@ -500,40 +985,150 @@ func (parser *Parser) SingleVal() AST {
 				RetType:     nil,
 			},
 			Value: TavValue{
-				String: []byte(t.Value.(string)+"\000\n"),
+				String: []byte(t.Value.(string)),
 			},
+		}, start)
+	} else if t := parser.Consumer.Consume(CLITERAL); t != nil {
+		// a single byte is a u8, anything else is decoded as a unicode code point
+		str := t.Value.(string)
+		typ := TYPE_RUNE
+		r, _ := utf8.DecodeRuneInString(str)
+		if len(str) == 1 {
+			typ = TYPE_U8
+			r = rune(str[0])
 		}
+		return parser.Mark(&LiteralAST{
+			Type: TavType{
+				Type: typ,
+			},
+			Value: TavValue{
+				Int:    int64(r),
+				String: []byte(str),
+			},
+		}, start)
 	} else if t := parser.Consumer.Consume(TRUE); t != nil {
-		return &LiteralAST{
+		return parser.Mark(&LiteralAST{
 			Type: TavType{
 				Type: TYPE_BOOL,
 			},
 			Value: TavValue{
 				Bool: true,
 			},
-		}
+		}, start)
 	} else if t := parser.Consumer.Consume(FALSE); t != nil {
-		return &LiteralAST{
+		return parser.Mark(&LiteralAST{
 			Type: TavType{
 				Type: TYPE_BOOL,
 			},
 			Value: TavValue{
 				Bool: false,
 			},
-		}
+		}, start)
 	} else if parser.Consumer.Consume(LEFT_PAREN) != nil { // group expression e.g. (1+2)
 		expression := parser.Expression()
 		parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
-		return &GroupAST{Group: expression}
+		return parser.Mark(&GroupAST{Group: expression}, start)
 	} else {
 		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "unexpected token")
 	}
 	return nil
 }
 
+// parse the argument of type_of, which is either a type e.g. type_of(*Vec2) or an expression e.g. type_of(x)
+func (parser *Parser) TypeOf() AST {
+	parser.Consumer.Consume(LEFT_PAREN)
+	typeOf := &TypeOfAST{}
+	if parser.IsTypeArg(int(parser.Consumer.Counter)) {
+		typeOf.Type = parser.ParseType()
+	} else {
+		typeOf.Value = parser.Expression()
+	}
+	parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+	return typeOf
+}
+
+// returns true if the next tokens are a cast to a pointer e.g. (*Vec2) rather than a dereference e.g. (*p)
+func (parser *Parser) IsPtrCast() bool {
+	i := int(parser.Consumer.Counter) + 1
+	if i >= len(parser.Consumer.Tokens) || parser.Consumer.Tokens[i].Type != STAR || !parser.IsTypeArg(i) {
+		return false
+	}
+	for parser.Consumer.Tokens[i].Type == STAR {
+		i++
+	}
+	return i+1 < len(parser.Consumer.Tokens) && parser.Consumer.Tokens[i+1].Type == RIGHT_PAREN
+}
+
+// returns true if the tokens starting at i are a type rather than an expression. a '*' is a pointer
+// if it is followed by a type, otherwise it is a dereference
+func (parser *Parser) IsTypeArg(i int) bool {
+	tokens := parser.Consumer.Tokens
+	for i < len(tokens) && tokens[i].Type == STAR {
+		i++
+	}
+	if i >= len(tokens) {
+		return false
+	}
+	switch tokens[i].Type {
+	case TYPE, POLY, LEFT_BRACKET:
+		return true
+	case IDENTIFIER:
+		sym := parser.SymTable.Get(tokens[i].Lexme())
+		return sym != nil && (sym.Type.Type == TYPE_STRUCT || sym.Type.Type == TYPE_UNION || sym.Type.Type == TYPE_INTERFACE)
+	}
+	return false
+}
+
+// parse an anonymous function e.g. fn i32 (x : i32) { ret x * 2; }
+func (parser *Parser) Closure() AST {
+	t := parser.Consumer.Advance()
+	// 'fn' is a keyword so it can never be the name of a function, the closure doesn't hide anything
+	f := parser.Fn(&Token{Position: t.Position, Type: IDENTIFIER, Value: "fn", Span: t.Span}).(*FnAST)
+	if f.Proto {
+		parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "expected the body of the function")
+	}
+	return &ClosureAST{Fn: f}
+}
+
+// parse a struct literal, the fields are either all positional e.g. Vec2{1, 2} or all named e.g. Vec2{x = 1, y = 2}
+func (parser *Parser) StructLit(identifier *Token) AST {
+	lit := &StructLitAST{Identifier: identifier}
+	parser.Consumer.ConsumeErr(LEFT_CURLY, ERR_UNEXPECTED_TOKEN, "expected '{' at start of struct literal")
+	for !parser.Consumer.Expect(RIGHT_CURLY) && !parser.Consumer.End() {
+		named := parser.Consumer.Expect(IDENTIFIER) && parser.Consumer.ExpectAhead(ASSIGN, 1)
+		if len(lit.Values) > 0 && named != (lit.Fields != nil) {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_UNEXPECTED_TOKEN, "cannot mix named and positional fields in struct literal")
+		}
+		if named {
+			lit.Fields = append(lit.Fields, parser.Consumer.Consume(IDENTIFIER))
+			parser.Consumer.Consume(ASSIGN)
+		}
+		lit.Values = append(lit.Values, parser.Expression())
+		if parser.Consumer.Expect(RIGHT_CURLY) {
+			break
+		}
+		parser.Consumer.ConsumeErr(COMMA, ERR_UNEXPECTED_TOKEN, "expected ',' between fields")
+	}
+	parser.Consumer.ConsumeErr(RIGHT_CURLY, ERR_UNEXPECTED_TOKEN, "expected closing '}'")
+	return parser.Mark(lit, identifier)
+}
+
 // parse a type
 func (parser *Parser) ParseType() *TavType {
 	typ :=NewTavType(TYPE_VOID, "", 0, nil)
+	// arrays have a constant length e.g. [16]i32 or [N]i32, a length that names a constant is folded by the resolver
+	if parser.Consumer.Consume(LEFT_BRACKET) != nil {
+		size := parser.Expression()
+		if length, ok := Fold(size, nil); ok {
+			if !length.Type.IsInt() || length.Value.Int <= 0 {
+				parser.Compiler.Critical(parser.Consumer.Reporter, ERR_ARRAY_LENGTH, "array length must be a positive constant integer")
+			}
+			typ.Length = uint64(length.Value.Int)
+		} else {
+			typ.Size = size
+		}
+		parser.Consumer.ConsumeErr(RIGHT_BRACKET, ERR_UNEXPECTED_TOKEN, "expected closing ']'")
+	}
 	// if it is a pointer, recursively get the pointer value
 	for parser.Consumer.Consume(STAR) != nil {
 		typ.Indirection += 1
@@ -541,15 +1136,213 @@ func (parser *Parser) ParseType() *TavType {
 	if t := parser.Consumer.Consume(TYPE); t != nil {
 		// it isn't a pointer, so get the type
 		typ.Type = t.Value.(uint32)
+		if typ.Type == TYPE_FN && parser.IsFnType(int(parser.Consumer.Counter)) {
+			parser.Signature(&typ)
+		}
 	} else if t := parser.Consumer.Consume(IDENTIFIER); t != nil {
 		typ.Type = TYPE_INSTANCE
 		typ.Instance = t.Lexme()
+		// an instance of a generic struct e.g. Box[i32]
+		if parser.Consumer.Expect(LEFT_BRACKET) {
+			typ.Args = parser.TypeArgs()
+			typ.Instance = InstanceName(typ.Instance, typ.Args)
+		}
+	} else if t := parser.Consumer.Consume(POLY); t != nil {
+		typ = parser.TypeParam(t, typ)
 	}
 	return &typ
 }
 
+// parse the type arguments of a generic struct e.g. [i32, *u8]
+func (parser *Parser) TypeArgs() []TavType {
+	var args []TavType
+	parser.Consumer.Consume(LEFT_BRACKET)
+	for !parser.Consumer.Expect(RIGHT_BRACKET) {
+		args = append(args, *parser.ParseType())
+		if parser.Consumer.Consume(COMMA) == nil {
+			break
+		}
+	}
+	parser.Consumer.ConsumeErr(RIGHT_BRACKET, ERR_UNEXPECTED_TOKEN, "expected closing ']'")
+	return args
+}
+
+// parse a use of a type paramater e.g. *$T, any use can constrain it to an interface e.g. $T/Shape.
+// in an instance, the type paramater is replaced by its type argument
+func (parser *Parser) TypeParam(name *Token, typ TavType) TavType {
+	var constraint *Token
+	if parser.Consumer.Consume(DIV) != nil {
+		constraint = parser.Consumer.ConsumeErr(IDENTIFIER, ERR_UNEXPECTED_TOKEN, "expected the name of an interface after '/'")
+	}
+	if parser.Subst != nil {
+		arg := parser.Subst[name.Lexme()]
+		// arrays only have one dimension, and there are no pointers to them
+		if arg.Length > 0 && (typ.Length > 0 || typ.Indirection > 0) {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_TYPE_PARAM, "'$"+name.Lexme()+"' is '"+arg.String()+"', which can't be used in '"+TavType{Type: TYPE_PARAM, Instance: name.Lexme(), Length: typ.Length, Indirection: typ.Indirection}.String()+"'")
+		}
+		arg.Indirection += typ.Indirection
+		if typ.Length > 0 {
+			arg.Length = typ.Length
+		}
+		return arg
+	}
+	var param *TypeParam
+	for _, p := range parser.TypeParams {
+		if p.Name.Lexme() == name.Lexme() {
+			param = p
+		}
+	}
+	if param == nil {
+		param = &TypeParam{Name: name}
+		parser.TypeParams = append(parser.TypeParams, param)
+	}
+	if constraint != nil {
+		if param.Constraint != nil {
+			parser.Compiler.Critical(parser.Consumer.Reporter, ERR_TYPE_PARAM, "'$"+name.Lexme()+"' is already constrained to '"+param.Constraint.Lexme()+"'")
+		}
+		param.Constraint = constraint
+	}
+	typ.Type = TYPE_PARAM
+	typ.Instance = name.Lexme()
+	return typ
+}
+
+
+// set the span of a node to cover everything from the start token to the last token consumed
+func (parser *Parser) Mark(node AST, start *Token) AST {
+	end := parser.Consumer.Previous()
+	if start == nil || end == nil {
+		return node
+	}
+	node.SetSpan(JoinSpans(start.Span, end.Span))
+	return node
+}
+
+// parse the signature of a function type e.g. fn i32 (i32, i32), the 'fn' must already be consumed
+func (parser *Parser) Signature(typ *TavType) {
+	typ.RetType = parser.ParseType()
+	if parser.Consumer.Consume(LEFT_PAREN) == nil {
+		return
+	}
+	for !parser.Consumer.Expect(RIGHT_PAREN) {
+		if parser.Consumer.Consume(VARIADIC) != nil {
+			typ.Variadic = true
+			break
+		}
+		typ.Params = append(typ.Params, *parser.ParseType())
+		if parser.Consumer.Expect(RIGHT_PAREN) {
+			break
+		}
+		parser.Consumer.ConsumeErr(COMMA, ERR_UNEXPECTED_TOKEN, "expected ',' between parameter types")
+	}
+	parser.Consumer.ConsumeErr(RIGHT_PAREN, ERR_UNEXPECTED_TOKEN, "expected closing ')'")
+}
+
+// returns true if the 'fn' before token i starts a function type rather than a function decleration.
+// a decleration names its paramaters and is followed by a body or a ';', a type only lists the types
+func (parser *Parser) IsFnType(i int) bool {
+	tokens := parser.Consumer.Tokens
+	i = parser.SkipRetType(i)
+	if i >= len(tokens) {
+		return false
+	}
+	switch tokens[i].Type {
+	case LEFT_CURLY:
+		return false
+	case SEMICOLON:
+		return parser.Local
+	case LEFT_PAREN:
+		if parser.Params(i) > 0 {
+			return false
+		}
+		// fn () is only a decleration if a body or ';' follows it, a local can't be a prototype
+		if i+2 < len(tokens) && tokens[i+1].Type == RIGHT_PAREN {
+			return tokens[i+2].Type != LEFT_CURLY && (tokens[i+2].Type != SEMICOLON || parser.Local)
+		}
+	}
+	return true
+}
+
+// count the named paramaters of the function decleration whose return type starts at token i
+func (parser *Parser) Params(i int) int {
+	tokens := parser.Consumer.Tokens
+	i = parser.SkipRetType(i)
+	if i >= len(tokens) || tokens[i].Type != LEFT_PAREN {
+		return 0
+	}
+	count, depth := 0, 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case LEFT_PAREN:
+			depth++
+		case RIGHT_PAREN:
+			depth--
+		case IDENTIFIER:
+			if depth == 1 && i+1 < len(tokens) && tokens[i+1].Type == COLON {
+				count++
+			}
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	return count
+}
+
+// skip the tokens of the return type that starts at token i
+func (parser *Parser) SkipRetType(i int) int {
+	tokens := parser.Consumer.Tokens
+	for i < len(tokens) && (tokens[i].Type == TYPE || tokens[i].Type == IDENTIFIER || tokens[i].Type == STAR || tokens[i].Type == POLY) {
+		fn := tokens[i].Type == TYPE && tokens[i].Value.(uint32) == TYPE_FN
+		i++
+		// a constraint e.g. $T/Shape
+		if tokens[i-1].Type == POLY && i+1 < len(tokens) && tokens[i].Type == DIV {
+			i += 2
+		}
+		// the type arguments of a generic struct e.g. Box[i32]
+		if tokens[i-1].Type == IDENTIFIER && i < len(tokens) && tokens[i].Type == LEFT_BRACKET {
+			for depth := 0; i < len(tokens); i++ {
+				if tokens[i].Type == LEFT_BRACKET {
+					depth++
+				} else if tokens[i].Type == RIGHT_BRACKET {
+					depth--
+				}
+				if depth == 0 {
+					i++
+					break
+				}
+			}
+		}
+		// a function type that is returned includes the types of its paramaters e.g. fn fn i32 () (start : i32)
+		if fn {
+			i = parser.SkipRetType(i)
+			for depth := 0; i < len(tokens); i++ {
+				if tokens[i].Type == LEFT_PAREN {
+					depth++
+				} else if tokens[i].Type == RIGHT_PAREN {
+					depth--
+				}
+				if depth == 0 {
+					if tokens[i].Type == RIGHT_PAREN {
+						i++
+					}
+					break
+				}
+			}
+			return i
+		}
+	}
+	return i
+}
 
 // returns true if the next token is a type
 func (parser *Parser) IsType(token *Token) bool{
-	return token.Type == IDENTIFIER || token.Type==TYPE
-}
\ No newline at end of file
+	return token.Type == IDENTIFIER || token.Type==TYPE || token.Type == POLY
+}
+
+// returns true if the token is the identifier of a struct declared anywhere at the top level or in scope
+func (parser *Parser) IsStruct(token *Token) bool {
+	sym := parser.SymTable.Get(token.Lexme())
+	return sym != nil && sym.Type.Type == TYPE_STRUCT
+}
+
@@ -1,18 +1,37 @@
 package src
 
-import (
-	"bufio"
-	"strings"
-)
-
 // Perhaps the reporter should point to the source string rather than
 // holding it in the Reporter struct...
 
 // represents a position in code
 type Position struct {
 	// store a copy of the current line we are processing for reporting errors
-	Indent uint32
+	Indent uint32 // the column in characters
+	Bytes  uint32 // the column in bytes
 	Line   uint32
+	Offset uint32 // the byte offset into the source
+}
+
+// a range of source code. the line and columns of Start are those of the first character and
+// the line and columns of End are those of the last character, End.Offset is one past the last byte
+type Span struct {
+	Start Position
+	End   Position
+}
+
+// spans that weren't set by the lexer or parser (e.g. built in symbols) are invalid
+func (span Span) Valid() bool {
+	return span.Start.Line != 0
+}
+
+// the span covering both a and b
+func JoinSpans(a, b Span) Span {
+	if !a.Valid() {
+		return b
+	} else if !b.Valid() {
+		return a
+	}
+	return Span{Start: a.Start, End: b.End}
 }
 
 // reports messages to the current module
@@ -21,37 +40,25 @@ type Reporter struct {
 	Source      *string
 	CurrentLine string
 	Position    Position
+	Span        Span // the span that ends at Position, if there is one
 }
 
 func NewReporter(filename string, source *string) *Reporter {
-	return &Reporter{filename, source, "", Position{Indent: 0, Line: 1,}}
+	return &Reporter{filename, source, "", Position{Indent: 0, Line: 1,}, Span{}}
 }
 
-// display the current line and position we are processing
-func (reporter *Reporter) ReportLine() string {
-	// get a scanner to find the line that the error is at
-	scanner := bufio.NewScanner(strings.NewReader(*reporter.Source))
-	for i := 0; i < int(reporter.Position.Line); i++ {
-		scanner.Scan()
-	}
-	// first display the line
-	Log(scanner.Text())
-	// then display where we are in that line
-	var str strings.Builder
-	for i := 0; i < int(reporter.Position.Indent)-1; i++ {
-		str.WriteString(" ")
-	}
-	str.WriteString("^\n")
-	for i := 0; i < int(reporter.Position.Indent)-2; i++ {
-		str.WriteString(" ")
-	}
-	str.WriteString("/")
-	return str.String()
+// point the reporter at a span, errors reported from here underline the whole span
+func (reporter *Reporter) Mark(span Span) {
+	reporter.Span = span
+	reporter.Position = span.End
 }
 
 func (reporter *Reporter) GetIndent() uint32 {
 	return reporter.Position.Indent
 }
+func (reporter *Reporter) GetBytes() uint32 {
+	return reporter.Position.Bytes
+}
 func (reporter *Reporter) GetLine() uint32 {
 	return reporter.Position.Line
 }
@@ -0,0 +1,911 @@
+package src
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// implements Visitor
+// the resolver links every name to the symbol it refers to, so the checker and the generator never
+// look variables up by name. each symbol is given an id that is unique across the whole program
+type Resolver struct {
+	Compiler *Compiler
+	SymTable *SymTable
+	Reporter *Reporter
+	Root     *RootAST
+	Fn       *FnAST // the function being resolved
+	// the number of symbols declared so far, used as the next id
+	Count uint32
+	// variables, paramaters and functions that are warned about if they are never used
+	Declared []*Symbol
+	// the closures being resolved, innermost last
+	Closures []*ClosureAST
+	// how many closures deep each local variable is declared, to find the variables a closure captures
+	Depth map[*Symbol]int
+}
+
+func Resolve(compiler *Compiler, RootAST *RootAST) *RootAST {
+	reporter := NewReporter(compiler.File.Filename, compiler.File.Source)
+	resolver := Resolver{
+		Compiler: compiler,
+		SymTable: NewSymTable(),
+		Reporter: reporter,
+		Root:     RootAST,
+		Depth:    make(map[*Symbol]int),
+	}
+	resolver.Run()
+	return RootAST
+}
+
+func (resolver *Resolver) Run() {
+	resolver.Root.Visit(resolver)
+	resolver.Unused()
+	// the checker and the generator look up types and functions in the global scope
+	resolver.Root.SymTable = resolver.SymTable
+	resolver.Root.Symbols = resolver.Count
+}
+
+// resolve an instance of a generic function made by the checker, once the rest of the program is resolved
+func ResolveInstance(compiler *Compiler, RootAST *RootAST, decl AST) {
+	resolver := Resolver{
+		Compiler: compiler,
+		SymTable: RootAST.SymTable,
+		Reporter: NewReporter(compiler.File.Filename, compiler.File.Source),
+		Root:     RootAST,
+		Count:    RootAST.Symbols,
+		Depth:    make(map[*Symbol]int),
+	}
+	resolver.Instance(decl)
+	RootAST.Symbols = resolver.Count
+}
+
+// declare and resolve an instance of a generic decleration in the global scope, wherever it is first
+// used, then add it to the program so it is checked and generated like any other decleration
+func (resolver *Resolver) Instance(decl AST) {
+	scope, fn, closures := resolver.SymTable.CurrentScope, resolver.Fn, resolver.Closures
+	resolver.SymTable.CurrentScope, resolver.Closures = resolver.SymTable.Global(), nil
+	made := Instanced(decl)
+	resolver.Compiler.Enter(made)
+	resolver.Declaration(decl)
+	decl.Visit(resolver)
+	resolver.Compiler.Leave(made)
+	resolver.SymTable.CurrentScope, resolver.Fn, resolver.Closures = scope, fn, closures
+	resolver.Root.Statements = append(resolver.Root.Statements, decl)
+}
+
+// get where an instance of a generic decleration was made, nil for any other decleration
+func Instanced(decl AST) *Note {
+	switch decl := decl.(type) {
+	case *FnAST:
+		return decl.Made
+	case *StructAST:
+		return decl.Made
+	}
+	return nil
+}
+
+// make the instances of generic structs a type refers to e.g. Box[i32], the first time each is used
+func (resolver *Resolver) Instantiate(t TavType) {
+	if t.RetType != nil {
+		resolver.Instantiate(*t.RetType)
+	}
+	for _, param := range t.Params {
+		resolver.Instantiate(param)
+	}
+	if t.Type != TYPE_INSTANCE || t.IsGeneric() || (t.Args != nil && resolver.SymTable.Get(t.Instance) != nil) {
+		return
+	}
+	name := GenericName(t.Instance)
+	var generic *Generic
+	sym := resolver.SymTable.Get(name)
+	if sym != nil {
+		if s, ok := sym.Value.(*StructAST); ok {
+			generic = s.Generic
+		}
+	}
+	if t.Args == nil {
+		if generic != nil {
+			resolver.Compiler.Critical(resolver.Reporter, ERR_TYPE_PARAM, "'"+name+"' is generic, it needs type arguments e.g. "+name+"[i32]",
+				Note{Span: sym.Span, Message: "'" + name + "' is declared here"})
+		}
+		return
+	}
+	if generic == nil {
+		resolver.Compiler.Critical(resolver.Reporter, ERR_TYPE_PARAM, "'"+name+"' isn't a generic struct")
+	}
+	if len(t.Args) != len(generic.Params) {
+		resolver.Compiler.Critical(resolver.Reporter, ERR_TYPE_PARAM, "wrong number of type arguments to '"+name+"'",
+			Note{Span: sym.Span, Message: "'" + name + "' has " + strconv.Itoa(len(generic.Params)) + " type paramaters"})
+	}
+	args := make(map[string]TavType)
+	for i, param := range generic.Params {
+		resolver.Instantiate(t.Args[i])
+		Constraint(resolver.Compiler, resolver.Reporter, resolver.SymTable, param, t.Args[i])
+		args[param.Name.Lexme()] = t.Args[i]
+	}
+	made := resolver.Reporter.Span
+	s := Instantiate(resolver.Compiler, generic, t.Instance, args).(*StructAST)
+	s.Made = Made(generic, t.Instance, args, made)
+	resolver.Instance(s)
+	// the methods of a generic struct are made with each instance of it, they are all declared before
+	// any is resolved so they can call each other
+	var methods []*FnAST
+	for _, method := range generic.Methods {
+		methods = append(methods, resolver.MethodInstance(method, s.Symbol, t.Args, made))
+	}
+	for _, method := range methods {
+		resolver.Instance(method)
+	}
+}
+
+// make a generic method for an instance of its struct, binding the type paramaters of the method to
+// the type arguments of the instance through its first paramater e.g. self : *Box[$T]
+func (resolver *Resolver) MethodInstance(method *FnAST, instance *Symbol, types []TavType, made Span) *FnAST {
+	args := make(map[string]TavType)
+	for i, arg := range method.Params[0].Type.Args {
+		args[arg.Instance] = types[i]
+	}
+	fn := Instantiate(resolver.Compiler, method.Generic, method.Identifier.Lexme(), args).(*FnAST)
+	receiver := *fn.Receiver
+	receiver.Value = instance.Identifier
+	fn.Receiver = &receiver
+	fn.Made = Made(method.Generic, instance.Identifier+"."+method.Identifier.Lexme(), args, made)
+	resolver.Compiler.Enter(fn.Made)
+	resolver.Signature(instance.Members, fn)
+	resolver.Compiler.Leave(fn.Made)
+	return fn
+}
+
+// add a symbol to the current scope and give it the next id
+func (resolver *Resolver) Declare(identifier *Token, tavType TavType, value interface{}, kind uint8) *Symbol {
+	resolver.Count++
+	sym := resolver.SymTable.Add(identifier.Lexme(), tavType, value)
+	sym.Id, sym.Span, sym.Kind = resolver.Count, identifier.Span, kind
+	resolver.Depth[sym] = len(resolver.Closures)
+	return sym
+}
+
+// resolve an expression or a statement, returning what replaces it. only the name of a function without
+// paramaters is replaced, by a call to it
+func (resolver *Resolver) Expr(expression AST) AST {
+	if call, ok := expression.Visit(resolver).(*CallAST); ok {
+		return call
+	}
+	return expression
+}
+
+// find the symbol a variable refers to, if it is a local of an enclosing function then every closure
+// between the two captures it
+func (resolver *Resolver) Capture(identifier *Token) *Symbol {
+	sym := resolver.Lookup(identifier)
+	if sym.Kind != SYMBOL_VARIABLE && sym.Kind != SYMBOL_PARAM {
+		return sym
+	}
+	for _, closure := range resolver.Closures[resolver.Depth[sym]:] {
+		captured := false
+		for _, capture := range closure.Captures {
+			captured = captured || capture == sym
+		}
+		if !captured {
+			closure.Captures = append(closure.Captures, sym)
+		}
+	}
+	return sym
+}
+
+// find the symbol a name refers to, reporting an error if there isn't one
+func (resolver *Resolver) Lookup(identifier *Token) *Symbol {
+	resolver.Reporter.Mark(identifier.Span)
+	sym := resolver.SymTable.Get(identifier.Lexme())
+	if sym == nil {
+		resolver.Compiler.Critical(resolver.Reporter, ERR_NO_VAR, "variable doesn't exist")
+	}
+	return sym
+}
+
+// the builtin functions that can be called without being declared
+func (resolver *Resolver) Builtins() {
+	for _, name := range []string{"printf", "puts"} {
+		retType := NewTavType(TYPE_I32, "", 0, nil)
+		resolver.Count++
+		sym := resolver.SymTable.Add(name, NewTavType(TYPE_FN, "", 0, &retType), nil)
+		sym.Id, sym.Kind = resolver.Count, SYMBOL_FN
+	}
+	// the types that describe a type at runtime are declared like any other, before the program
+	resolver.Root.Statements = append(Prelude(), resolver.Root.Statements...)
+}
+
+// the declerations every program has, the TypeInfo of a type is returned by type_of and held by an any
+//	TypeInfo : struct {kind : i32; size : i64; name : string; elem : *TypeInfo; count : i64; fields : *TypeField; packed : bool;}
+//	TypeField : struct {name : string; info : *TypeInfo; offset : i64;}
+// elem is what a pointer points to or the elements of an array, count is the number of fields or elements.
+// the kind of a type is one of the KIND_ constants
+func Prelude() []AST {
+	name := func(identifier string) *Token {
+		return &Token{Type: IDENTIFIER, Value: identifier}
+	}
+	field := func(identifier string, t TavType) *VarDefAST {
+		return &VarDefAST{Identifier: name(identifier), Type: t}
+	}
+	info, fields := NewTavType(TYPE_INSTANCE, "TypeInfo", 1, nil), NewTavType(TYPE_INSTANCE, "TypeField", 1, nil)
+	prelude := []AST{
+		&StructAST{Identifier: name("TypeInfo"), Fields: []*VarDefAST{
+			field("kind", NewTavType(TYPE_I32, "", 0, nil)), field("size", NewTavType(TYPE_I64, "", 0, nil)),
+			field("name", NewTavType(TYPE_STRING, "", 0, nil)), field("elem", info),
+			field("count", NewTavType(TYPE_I64, "", 0, nil)), field("fields", fields), field("packed", NewTavType(TYPE_BOOL, "", 0, nil)),
+		}},
+		&StructAST{Identifier: name("TypeField"), Fields: []*VarDefAST{
+			field("name", NewTavType(TYPE_STRING, "", 0, nil)), field("info", info), field("offset", NewTavType(TYPE_I64, "", 0, nil)),
+		}},
+	}
+	for kind, identifier := range KindStrings {
+		lit := &LiteralAST{Type: NewTavType(TYPE_I32, "", 0, nil), Value: TavValue{Int: int64(kind)}}
+		prelude = append(prelude, &VarDefAST{Identifier: name(identifier), Type: lit.Type, Assignment: lit, Constant: true})
+	}
+	return prelude
+}
+
+// warn about anything that was declared but never used, names starting with '_' are unused on purpose
+func (resolver *Resolver) Unused() {
+	sort.SliceStable(resolver.Declared, func(i, j int) bool {
+		return resolver.Declared[i].Span.Start.Offset < resolver.Declared[j].Span.Start.Offset
+	})
+	for _, sym := range resolver.Declared {
+		if sym.Used || strings.HasPrefix(sym.Identifier, "_") {
+			continue
+		}
+		resolver.Reporter.Mark(sym.Span)
+		switch sym.Kind {
+		case SYMBOL_VARIABLE:
+			resolver.Compiler.Lint(resolver.Reporter, "unused_variable", "unused variable '"+sym.Identifier+"'")
+		case SYMBOL_PARAM:
+			resolver.Compiler.Lint(resolver.Reporter, "unused_parameter", "unused parameter '"+sym.Identifier+"'")
+		case SYMBOL_FN:
+			resolver.Compiler.Lint(resolver.Reporter, "unused_function", "function '"+sym.Identifier+"' is never called")
+		}
+	}
+}
+
+func (resolver *Resolver) VisitRootAST(RootAST *RootAST) interface{} {
+	resolver.Builtins()
+	// every top level name is declared before any body is resolved, so the order of declerations
+	// doesn't matter and functions can call each other
+	for _, statement := range RootAST.Statements {
+		resolver.Declaration(statement)
+	}
+	// constants are folded in order once every name is declared, so a #run can call any function and
+	// the lengths of arrays can name a constant
+	for _, statement := range RootAST.Statements {
+		if def, ok := statement.(*VarDefAST); ok && def.Constant {
+			def.Assignment = resolver.Expr(def.Assignment)
+			resolver.Constant(def)
+			def.Symbol.Value, def.Symbol.Type = def.Assignment, def.Type
+		}
+	}
+	// methods are declared once every struct is, so a method can come before its struct. the methods of
+	// generic structs are declared first, so every instance made by another method has them
+	statements := RootAST.Statements
+	for _, generic := range []bool{true, false} {
+		for _, statement := range statements {
+			if fn, ok := statement.(*FnAST); ok && fn.Receiver != nil && (fn.Generic != nil) == generic {
+				resolver.Method(fn)
+			}
+		}
+	}
+	// instances made while declaring methods were resolved when they were made
+	for _, statement := range statements {
+		if def, ok := statement.(*VarDefAST); ok {
+			if def.Constant {
+				continue
+			}
+			resolver.Reporter.Mark(def.Identifier.Span)
+			resolver.Length(&def.Type)
+			def.Symbol.Type = def.Type
+			resolver.Instantiate(def.Type)
+			if def.Assignment != nil {
+				def.Assignment = resolver.Expr(def.Assignment)
+			}
+			continue
+		}
+		statement.Visit(resolver)
+	}
+	return nil
+}
+
+// declare a top level function, type or global without resolving its body
+func (resolver *Resolver) Declaration(statement AST) {
+	switch statement := statement.(type) {
+	case *FnAST:
+		if statement.Receiver == nil {
+			resolver.Function(statement)
+		}
+	case *StructAST:
+		statement.Symbol = resolver.Type(statement.Identifier, TYPE_STRUCT, statement)
+	case *UnionAST:
+		statement.Symbol = resolver.Type(statement.Identifier, TYPE_UNION, statement)
+	case *InterfaceAST:
+		statement.Symbol = resolver.Type(statement.Identifier, TYPE_INTERFACE, statement)
+	case *VarDefAST:
+		resolver.Reporter.Mark(statement.Identifier.Span)
+		if previous := resolver.SymTable.GetLocal(statement.Identifier.Lexme()); previous != nil {
+			resolver.Redeclared(previous, "variable re-declared")
+		}
+		// constants are folded once every name is declared
+		if statement.Constant {
+			statement.Symbol = resolver.Declare(statement.Identifier, statement.Type, nil, SYMBOL_CONST)
+		} else {
+			statement.Symbol = resolver.Declare(statement.Identifier, statement.Type, nil, SYMBOL_GLOBAL)
+		}
+	}
+}
+
+func (resolver *Resolver) VisitCastAST(CastAST *CastAST) interface{} {
+	resolver.Reporter.Mark(CastAST.Span())
+	resolver.Length(&CastAST.TavType)
+	resolver.Instantiate(CastAST.TavType)
+	CastAST.Expr = resolver.Expr(CastAST.Expr)
+	return nil
+}
+
+func (resolver *Resolver) VisitVarSetAST(VarSetAST *VarSetAST) interface{} {
+	VarSetAST.Value = resolver.Expr(VarSetAST.Value)
+	VarSetAST.Symbol = resolver.Capture(VarSetAST.Identifier)
+	return nil
+}
+
+func (resolver *Resolver) VisitIndexSetAST(IndexSetAST *IndexSetAST) interface{} {
+	IndexSetAST.Array = resolver.Expr(IndexSetAST.Array)
+	IndexSetAST.Index = resolver.Expr(IndexSetAST.Index)
+	IndexSetAST.Value = resolver.Expr(IndexSetAST.Value)
+	return nil
+}
+
+// unroll a loop over the fields of a struct into a block per field, each declares the loop's name as the
+// field's TypeField e.g. f := #type_info(Vec2).fields[0] before the body
+func (resolver *Resolver) VisitFieldsAST(FieldsAST *FieldsAST) interface{} {
+	resolver.Reporter.Mark(FieldsAST.Span())
+	FieldsAST.Unrolled = &BlockAST{}
+	// the fields of a type paramater are only known in each instance of the function, anything the body
+	// names counts as used so the generic decleration isn't warned about
+	if FieldsAST.Type.IsGeneric() {
+		for _, t := range FieldsAST.Tokens {
+			if t.Type != IDENTIFIER {
+				continue
+			}
+			if sym := resolver.SymTable.Get(t.Lexme()); sym != nil {
+				sym.Used = true
+			}
+		}
+		return nil
+	}
+	resolver.Length(&FieldsAST.Type)
+	resolver.Instantiate(FieldsAST.Type)
+	var decl *StructAST
+	if t := FieldsAST.Type; t.Type == TYPE_INSTANCE && t.Indirection == 0 && t.Length == 0 {
+		if sym := resolver.SymTable.Get(t.Instance); sym != nil {
+			decl, _ = sym.Value.(*StructAST)
+		}
+	}
+	if decl == nil {
+		resolver.Compiler.Critical(resolver.Reporter, ERR_NOT_STRUCT, "can only loop over the fields of a struct", Note{Message: "found " + FieldsAST.Type.String()})
+	}
+	span := FieldsAST.Identifier.Span
+	mark := func(node AST) AST {
+		node.SetSpan(span)
+		return node
+	}
+	for i, field := range decl.Fields {
+		fields := mark(&StructGetAST{Struct: mark(&TypeOfAST{Type: &FieldsAST.Type}), Member: &Token{Type: IDENTIFIER, Value: "fields", Span: span}})
+		index := mark(&LiteralAST{Type: NewTavType(TYPE_I64, "", 0, nil), Value: TavValue{Int: int64(i)}})
+		def := mark(&VarDefAST{Identifier: FieldsAST.Identifier, Type: NewTavType(TYPE_INSTANCE, "TypeField", 0, nil),
+			Assignment: mark(&IndexAST{Array: fields, Index: index})}).(*VarDefAST)
+		body := mark(&BlockAST{Statements: []AST{def, Unroll(resolver.Compiler, FieldsAST, field.Identifier.Lexme())}})
+		body.Visit(resolver)
+		// the body doesn't have to use the field itself e.g. when it only uses v.f. the symbol keeps the
+		// expression for the field so f.offset can be folded into a constant
+		def.Symbol.Used, def.Symbol.Value = true, def.Assignment
+		FieldsAST.Unrolled.Statements = append(FieldsAST.Unrolled.Statements, body)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitReturnAST(ReturnAST *ReturnAST) interface{} {
+	if ReturnAST.Value != nil {
+		ReturnAST.Value = resolver.Expr(ReturnAST.Value)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitBreakAST(BreakAST *BreakAST) interface{} {
+	return nil
+}
+
+func (resolver *Resolver) VisitForAST(ForAST *ForAST) interface{} {
+	ForAST.Condition = resolver.Expr(ForAST.Condition)
+	ForAST.Body.Visit(resolver)
+	return nil
+}
+
+func (resolver *Resolver) VisitIfAST(IfAST *IfAST) interface{} {
+	IfAST.IfCondition = resolver.Expr(IfAST.IfCondition)
+	IfAST.IfBody.Visit(resolver)
+	for i, condition := range IfAST.ElifCondition {
+		IfAST.ElifCondition[i] = resolver.Expr(condition)
+		IfAST.ElifBody[i].Visit(resolver)
+	}
+	if IfAST.ElseBody != nil {
+		IfAST.ElseBody.Visit(resolver)
+	}
+	return nil
+}
+
+// the fields of a struct are kept in their own scope on the struct's symbol, in declaration order
+func (resolver *Resolver) VisitStructAST(StructAST *StructAST) interface{} {
+	if StructAST.Symbol == nil {
+		StructAST.Symbol = resolver.Type(StructAST.Identifier, TYPE_STRUCT, StructAST)
+	}
+	resolver.Members(StructAST.Symbol.Members, StructAST.Fields, "struct member re-declared")
+	resolver.Recursive(StructAST.Symbol)
+	return nil
+}
+
+func (resolver *Resolver) VisitUnionAST(UnionAST *UnionAST) interface{} {
+	if UnionAST.Symbol == nil {
+		UnionAST.Symbol = resolver.Type(UnionAST.Identifier, TYPE_UNION, UnionAST)
+	}
+	resolver.Members(UnionAST.Symbol.Members, UnionAST.Variants, "union variant re-declared")
+	resolver.Recursive(UnionAST.Symbol)
+	return nil
+}
+
+// report a struct or union that contains itself by value, directly or through the members of other types,
+// as it would need infinite space. a member that only points to it is fine
+func (resolver *Resolver) Recursive(sym *Symbol) {
+	visited := make(map[*Symbol]bool)
+	var path []*VarDefAST
+	var contains func(*Symbol) bool
+	contains = func(s *Symbol) bool {
+		visited[s] = true
+		var members []*VarDefAST
+		switch decl := s.Value.(type) {
+		case *StructAST:
+			members = decl.Fields
+		case *UnionAST:
+			members = decl.Variants
+		}
+		for _, member := range members {
+			// an array holds its elements by value too
+			if member.Type.Type != TYPE_INSTANCE || member.Type.Indirection != 0 {
+				continue
+			}
+			path = append(path, member)
+			inner := resolver.SymTable.Get(member.Type.Instance)
+			if inner == sym || (inner != nil && !visited[inner] && contains(inner)) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+	if !contains(sym) {
+		return
+	}
+	// e.g. A.b -> B.a -> A
+	owner, chain := sym.Identifier, ""
+	for _, member := range path {
+		chain += owner + "." + member.Identifier.Lexme() + " -> "
+		owner = member.Type.Instance
+	}
+	resolver.Reporter.Mark(path[0].Identifier.Span)
+	resolver.Compiler.Critical(resolver.Reporter, ERR_RECURSIVE_TYPE, "'"+sym.Identifier+"' contains itself",
+		Note{Span: sym.Span, Message: "'" + sym.Identifier + "' is declared here"},
+		Note{Message: "through " + chain + sym.Identifier + ", use a pointer e.g. *" + sym.Identifier + " to refer to it"})
+}
+
+// the methods of an interface are kept in the scope of its members, like the methods of a struct
+func (resolver *Resolver) VisitInterfaceAST(InterfaceAST *InterfaceAST) interface{} {
+	if InterfaceAST.Symbol == nil {
+		InterfaceAST.Symbol = resolver.Type(InterfaceAST.Identifier, TYPE_INTERFACE, InterfaceAST)
+	}
+	for _, method := range InterfaceAST.Methods {
+		resolver.Signature(InterfaceAST.Symbol.Members, method)
+		resolver.Instantiate(method.Symbol.Type)
+	}
+	return nil
+}
+
+// declare a struct, union or interface type, the decleration is kept as the value
+func (resolver *Resolver) Type(identifier *Token, kind uint32, decl AST) *Symbol {
+	resolver.Reporter.Mark(identifier.Span)
+	if previous := resolver.SymTable.GetLocal(identifier.Lexme()); previous != nil {
+		resolver.Redeclared(previous, "type re-declared")
+	}
+	sym := resolver.Declare(identifier, NewTavType(kind, "", 0, nil), decl, SYMBOL_OTHER)
+	sym.Members = NewScope(nil)
+	return sym
+}
+
+// declare the members of a struct or union in the scope of its members, the value of each member is its default
+func (resolver *Resolver) Members(scope *Scope, members []*VarDefAST, msg string) {
+	for _, member := range members {
+		resolver.Reporter.Mark(member.Identifier.Span)
+		if previous := scope.Get(member.Identifier.Lexme()); previous != nil {
+			// methods are declared before the members, but it is the method that clashes with the member
+			if previous.Kind == SYMBOL_FN {
+				resolver.Reporter.Mark(previous.Span)
+				resolver.Compiler.Critical(resolver.Reporter, ERR_REDECLARED, "method re-declared", Note{Span: member.Identifier.Span, Message: "previously declared here"})
+			}
+			resolver.Redeclared(previous, msg)
+		}
+		// defaults are resolved in the scope the type is declared in
+		if member.Assignment != nil {
+			member.Assignment = resolver.Expr(member.Assignment)
+		}
+		resolver.Length(&member.Type)
+		resolver.Instantiate(member.Type)
+		resolver.Count++
+		member.Symbol = NewSym(member.Identifier.Lexme(), member.Type, member.Assignment)
+		member.Symbol.Id, member.Symbol.Span = resolver.Count, member.Identifier.Span
+		scope.Add(member.Symbol)
+	}
+}
+
+// declare a method in the scope of the members of its struct, so it is only found through a value of the struct
+func (resolver *Resolver) Method(FnAST *FnAST) {
+	resolver.Reporter.Mark(FnAST.Receiver.Span)
+	sym := resolver.SymTable.Get(FnAST.Receiver.Lexme())
+	if sym == nil || sym.Type.Type != TYPE_STRUCT {
+		resolver.Compiler.Critical(resolver.Reporter, ERR_NO_VAR, "struct '"+FnAST.Receiver.Lexme()+"' doesn't exist")
+	}
+	generic := sym.Value.(*StructAST).Generic
+	if generic == nil {
+		if FnAST.Generic != nil {
+			resolver.Compiler.Critical(resolver.Reporter, ERR_TYPE_PARAM, "'"+sym.Identifier+"' isn't generic, its methods can't have type paramaters",
+				Note{Span: sym.Span, Message: "'" + sym.Identifier + "' is declared here"})
+		}
+		resolver.Signature(sym.Members, FnAST)
+		return
+	}
+	// a method of a generic struct either belongs to one instance e.g. self : *Box[i32], or to every
+	// instance e.g. self : *Box[$T]
+	var self TavType
+	if len(FnAST.Params) > 0 {
+		self = FnAST.Params[0].Type
+		resolver.Reporter.Mark(FnAST.Params[0].Identifier.Span)
+	}
+	if self.Type != TYPE_INSTANCE || GenericName(self.Instance) != sym.Identifier || self.Args == nil {
+		resolver.Compiler.Critical(resolver.Reporter, ERR_RECEIVER, "the first paramater of '"+sym.Identifier+"."+FnAST.Identifier.Lexme()+"' must be an instance of "+sym.Identifier,
+			Note{Message: "e.g. self : *" + InstanceName(sym.Identifier, []TavType{{Type: TYPE_PARAM, Instance: generic.Params[0].Name.Lexme()}}) + " for every instance"})
+	}
+	if FnAST.Generic == nil {
+		resolver.Instantiate(self)
+		receiver := *FnAST.Receiver
+		receiver.Value = self.Instance
+		FnAST.Receiver = &receiver
+		resolver.Signature(resolver.SymTable.Get(self.Instance).Members, FnAST)
+		return
+	}
+	// every type paramater of the method has to be bound by an instance, so each is a type argument of self
+	bound := make(map[string]bool)
+	for _, arg := range self.Args {
+		if arg.Type != TYPE_PARAM || arg.Indirection != 0 || arg.Length != 0 || bound[arg.Instance] {
+			resolver.Compiler.Critical(resolver.Reporter, ERR_RECEIVER, "the type arguments of '"+FnAST.Params[0].Identifier.Lexme()+"' must be distinct type paramaters",
+				Note{Message: "'" + FnAST.Params[0].Identifier.Lexme() + "' is " + self.String()})
+		}
+		bound[arg.Instance] = true
+	}
+	for _, param := range FnAST.Generic.Params {
+		if !bound[param.Name.Lexme()] {
+			resolver.Reporter.Mark(param.Name.Span)
+			resolver.Compiler.Critical(resolver.Reporter, ERR_TYPE_PARAM, "'$"+param.Name.Lexme()+"' isn't a type paramater of '"+sym.Identifier+"'",
+				Note{Span: FnAST.Params[0].Identifier.Span, Message: "the type paramaters of a method are the type arguments of its first paramater"})
+		}
+	}
+	// the generic method is kept with the generic struct, it is only checked and generated through its instances
+	resolver.Signature(sym.Members, FnAST)
+	generic.Methods = append(generic.Methods, FnAST)
+}
+
+// declare a method of a struct or interface in the scope of its members
+func (resolver *Resolver) Signature(scope *Scope, FnAST *FnAST) {
+	resolver.Reporter.Mark(FnAST.Identifier.Span)
+	if previous := scope.Names[FnAST.Identifier.Lexme()]; previous != nil {
+		resolver.Redeclared(previous, "method re-declared")
+	}
+	resolver.Lengths(FnAST)
+	resolver.Count++
+	FnAST.Symbol = NewSym(FnAST.Identifier.Lexme(), FnType(FnAST), FnAST)
+	FnAST.Symbol.Id, FnAST.Symbol.Span, FnAST.Symbol.Kind = resolver.Count, FnAST.Identifier.Span, SYMBOL_FN
+	scope.Add(FnAST.Symbol)
+}
+
+func (resolver *Resolver) VisitMatchAST(MatchAST *MatchAST) interface{} {
+	MatchAST.Value = resolver.Expr(MatchAST.Value)
+	for _, matchCase := range MatchAST.Cases {
+		// the binding only exists within the body of the case, its type is set by the checker
+		resolver.SymTable.NewScope()
+		if matchCase.Binding != nil {
+			resolver.Reporter.Mark(matchCase.Binding.Span)
+			resolver.Shadows(matchCase.Binding)
+			matchCase.Symbol = resolver.Declare(matchCase.Binding, TavType{}, nil, SYMBOL_VARIABLE)
+			resolver.Declared = append(resolver.Declared, matchCase.Symbol)
+		}
+		matchCase.Body = resolver.Expr(matchCase.Body)
+		resolver.SymTable.PopScope()
+	}
+	if MatchAST.ElseBody != nil {
+		MatchAST.ElseBody = resolver.Expr(MatchAST.ElseBody)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitFnAST(FnAST *FnAST) interface{} {
+	// top level functions were declared before any bodies were resolved, nested ones are declared
+	// before their body so they can call themselves
+	if FnAST.Symbol == nil {
+		resolver.Function(FnAST)
+	}
+	resolver.Body(FnAST)
+	return nil
+}
+
+// resolve the paramaters and the body of a function, they share a scope
+func (resolver *Resolver) Body(FnAST *FnAST) {
+	resolver.Fn = FnAST
+	resolver.Reporter.Mark(FnAST.Identifier.Span)
+	// a function is declared before the constants in its signature are folded
+	resolver.Lengths(FnAST)
+	if FnAST.Symbol != nil {
+		FnAST.Symbol.Type = FnType(FnAST)
+	}
+	resolver.Instantiate(FnAST.RetType)
+	resolver.SymTable.NewScope()
+	for i := range FnAST.Params {
+		resolver.Variable(&FnAST.Params[i], SYMBOL_PARAM)
+	}
+	for i, stmt := range FnAST.Body {
+		FnAST.Body[i] = resolver.Expr(stmt)
+	}
+	resolver.SymTable.PopScope()
+}
+
+func (resolver *Resolver) VisitClosureAST(ClosureAST *ClosureAST) interface{} {
+	fn := resolver.Fn
+	resolver.Closures = append(resolver.Closures, ClosureAST)
+	resolver.Body(ClosureAST.Fn)
+	resolver.Closures = resolver.Closures[:len(resolver.Closures)-1]
+	resolver.Fn = fn
+	return nil
+}
+
+// declare a function, it is kept as the value so calls can check their arguments
+func (resolver *Resolver) Function(FnAST *FnAST) {
+	resolver.Reporter.Mark(FnAST.Identifier.Span)
+	if previous := resolver.SymTable.Get(FnAST.Identifier.Lexme()); previous != nil {
+		resolver.Redeclared(previous, "function re-declared")
+	}
+	FnAST.Symbol = resolver.Declare(FnAST.Identifier, FnType(FnAST), FnAST, SYMBOL_FN)
+	// functions without a body are declared elsewhere
+	if FnAST.Identifier.Lexme() != "main" && !FnAST.Proto {
+		resolver.Declared = append(resolver.Declared, FnAST.Symbol)
+	}
+}
+
+func (resolver *Resolver) VisitVarDefAST(VarDefAST *VarDefAST) interface{} {
+	resolver.Variable(VarDefAST, SYMBOL_VARIABLE)
+	return nil
+}
+
+// declare a variable, kind is whether it is a local, paramater or global
+func (resolver *Resolver) Variable(VarDefAST *VarDefAST, kind uint8) {
+	// the value is resolved first, so x := x + 1 refers to an x in an outer scope
+	if VarDefAST.Assignment != nil {
+		VarDefAST.Assignment = resolver.Expr(VarDefAST.Assignment)
+	}
+	resolver.Reporter.Mark(VarDefAST.Identifier.Span)
+	// only check the local scope, otherwise we can redeclare global variables
+	if previous := resolver.SymTable.GetLocal(VarDefAST.Identifier.Lexme()); previous != nil {
+		resolver.Redeclared(previous, "variable re-declared")
+	}
+	resolver.Shadows(VarDefAST.Identifier)
+	// the folded value is kept so other constants can refer to it
+	if VarDefAST.Constant {
+		resolver.Constant(VarDefAST)
+		VarDefAST.Symbol = resolver.Declare(VarDefAST.Identifier, VarDefAST.Type, VarDefAST.Assignment, SYMBOL_CONST)
+		return
+	}
+	resolver.Length(&VarDefAST.Type)
+	resolver.Instantiate(VarDefAST.Type)
+	VarDefAST.Symbol = resolver.Declare(VarDefAST.Identifier, VarDefAST.Type, nil, kind)
+	// paramaters of functions without a body can't be used, and a method needs its receiver even if it doesn't use it
+	if kind == SYMBOL_VARIABLE || (kind == SYMBOL_PARAM && !resolver.Fn.Proto && (resolver.Fn.Receiver == nil || VarDefAST != &resolver.Fn.Params[0])) {
+		resolver.Declared = append(resolver.Declared, VarDefAST.Symbol)
+	}
+}
+
+// fold a constant once the names in it are resolved. members such as #type_info(T).size and #run
+// calls are left to the checker
+func (resolver *Resolver) Constant(VarDefAST *VarDefAST) {
+	lit, ok := Fold(VarDefAST.Assignment, resolver.SymTable)
+	if !ok && Member(VarDefAST.Assignment) {
+		return
+	}
+	if !ok {
+		resolver.Reporter.Mark(VarDefAST.Identifier.Span)
+		resolver.Compiler.Critical(resolver.Reporter, ERR_NOT_CONSTANT, "value of '"+VarDefAST.Identifier.Lexme()+"' must be known at compile time")
+	}
+	VarDefAST.Assignment, VarDefAST.Type = lit, lit.Type
+}
+
+// fold the lengths of the arrays in a type that name a constant e.g. [N]i32. lengths that get a member
+// e.g. [#type_info(T).size]u8 are left to the checker
+func (resolver *Resolver) Length(t *TavType) {
+	if t.RetType != nil {
+		resolver.Length(t.RetType)
+	}
+	for i := range t.Params {
+		resolver.Length(&t.Params[i])
+	}
+	for i := range t.Args {
+		resolver.Length(&t.Args[i])
+	}
+	if t.Size == nil {
+		return
+	}
+	t.Size = resolver.Expr(t.Size)
+	length, ok := Fold(t.Size, resolver.SymTable)
+	if !ok && Member(t.Size) {
+		return
+	}
+	if !ok || !length.Type.IsInt() || length.Value.Int <= 0 {
+		resolver.Reporter.Mark(t.Size.Span())
+		resolver.Compiler.Critical(resolver.Reporter, ERR_ARRAY_LENGTH, "array length must be a positive constant integer")
+	}
+	t.Length, t.Size = uint64(length.Value.Int), nil
+}
+
+// fold the lengths of the arrays in the signature of a function
+func (resolver *Resolver) Lengths(FnAST *FnAST) {
+	resolver.Length(&FnAST.RetType)
+	for i := range FnAST.Params {
+		resolver.Length(&FnAST.Params[i].Type)
+	}
+}
+
+// warn if a variable hides a variable of the same name in an outer scope
+func (resolver *Resolver) Shadows(identifier *Token) {
+	previous := resolver.SymTable.Get(identifier.Lexme())
+	if previous == nil || previous.Kind == SYMBOL_OTHER || previous.Kind == SYMBOL_FN || resolver.SymTable.GetLocal(identifier.Lexme()) != nil {
+		return
+	}
+	notes := []Note{Builtin(previous)}
+	if previous.Span.Valid() {
+		notes[0] = Note{Span: previous.Span, Message: "shadowed variable declared here"}
+	}
+	resolver.Compiler.Lint(resolver.Reporter, "shadowing", "'"+identifier.Lexme()+"' shadows a variable in an outer scope", notes...)
+}
+
+// report a symbol that was declared twice, pointing at the first decleration
+func (resolver *Resolver) Redeclared(previous *Symbol, msg string) {
+	note := Builtin(previous)
+	if previous.Span.Valid() {
+		note = Note{Span: previous.Span, Message: "previously declared here"}
+	}
+	resolver.Compiler.Critical(resolver.Reporter, ERR_REDECLARED, msg, note)
+}
+
+// the builtins and the prelude aren't declared in the program, so there is nowhere to point at
+func Builtin(sym *Symbol) Note {
+	return Note{Message: "'" + sym.Identifier + "' is built in, every program has it"}
+}
+
+func (resolver *Resolver) VisitBlockAST(BlockAST *BlockAST) interface{} {
+	resolver.SymTable.NewScope()
+	for i, stmt := range BlockAST.Statements {
+		BlockAST.Statements[i] = resolver.Expr(stmt)
+	}
+	resolver.SymTable.PopScope()
+	return nil
+}
+
+func (resolver *Resolver) VisitExprSmtAST(ExprStmtAST *ExprStmtAST) interface{} {
+	ExprStmtAST.Expression = resolver.Expr(ExprStmtAST.Expression)
+	return nil
+}
+
+func (resolver *Resolver) VisitLiteralAST(LiteralAST *LiteralAST) interface{} {
+	return nil
+}
+
+func (resolver *Resolver) VisitListAST(ListAST *ListAST) interface{} {
+	return nil
+}
+
+// a function without paramaters named without parentheses e.g. main is called, the call replaces the name.
+// a variable or paramater of the same name hides the function, so it is only a call if the name is the function
+func (resolver *Resolver) VisitVariableAST(VariableAST *VariableAST) interface{} {
+	VariableAST.Symbol = resolver.Capture(VariableAST.Identifier)
+	VariableAST.Symbol.Used = true
+	if fn, ok := VariableAST.Symbol.Value.(*FnAST); ok && VariableAST.Symbol.Kind == SYMBOL_FN && len(fn.Params) == 0 && !fn.Variadic {
+		call := &CallAST{Caller: VariableAST, Implicit: true}
+		call.SetSpan(VariableAST.Span())
+		return call
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitUnaryAST(UnaryAST *UnaryAST) interface{} {
+	UnaryAST.Right = resolver.Expr(UnaryAST.Right)
+	return nil
+}
+
+func (resolver *Resolver) VisitBinaryAST(BinaryAST *BinaryAST) interface{} {
+	BinaryAST.Left = resolver.Expr(BinaryAST.Left)
+	BinaryAST.Right = resolver.Expr(BinaryAST.Right)
+	return nil
+}
+
+func (resolver *Resolver) VisitConnectiveAST(ConnectiveAST *ConnectiveAST) interface{} {
+	return nil
+}
+
+func (resolver *Resolver) VisitCallAST(CallAST *CallAST) interface{} {
+	// the caller is called with its arguments, so a function without paramaters isn't called twice
+	CallAST.Caller.Visit(resolver)
+	for i, arg := range CallAST.Args {
+		CallAST.Args[i] = resolver.Expr(arg)
+	}
+	return nil
+}
+
+// members depend on the type of the struct, so they are left to the checker
+func (resolver *Resolver) VisitStructGetAST(StructGet *StructGetAST) interface{} {
+	StructGet.Struct = resolver.Expr(StructGet.Struct)
+	return nil
+}
+
+func (resolver *Resolver) VisitStructSetAST(StructSetAST *StructSetAST) interface{} {
+	StructSetAST.Struct = resolver.Expr(StructSetAST.Struct)
+	StructSetAST.Value = resolver.Expr(StructSetAST.Value)
+	return nil
+}
+
+func (resolver *Resolver) VisitStructLitAST(StructLitAST *StructLitAST) interface{} {
+	resolver.Reporter.Mark(StructLitAST.Identifier.Span)
+	for i := range StructLitAST.Args {
+		resolver.Length(&StructLitAST.Args[i])
+	}
+	resolver.Instantiate(InferType(StructLitAST, resolver.SymTable))
+	for i, val := range StructLitAST.Values {
+		StructLitAST.Values[i] = resolver.Expr(val)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitGroupAST(GroupAST *GroupAST) interface{} {
+	GroupAST.Group = resolver.Expr(GroupAST.Group)
+	return nil
+}
+
+func (resolver *Resolver) VisitTypeOfAST(TypeOfAST *TypeOfAST) interface{} {
+	resolver.Reporter.Mark(TypeOfAST.Span())
+	if TypeOfAST.Type != nil {
+		resolver.Length(TypeOfAST.Type)
+		resolver.Instantiate(*TypeOfAST.Type)
+		return nil
+	}
+	TypeOfAST.Value = resolver.Expr(TypeOfAST.Value)
+	return nil
+}
+
+func (resolver *Resolver) VisitRunAST(RunAST *RunAST) interface{} {
+	RunAST.Expr = resolver.Expr(RunAST.Expr)
+	return nil
+}
+
+func (resolver *Resolver) VisitIndexAST(IndexAST *IndexAST) interface{} {
+	IndexAST.Array = resolver.Expr(IndexAST.Array)
+	IndexAST.Index = resolver.Expr(IndexAST.Index)
+	return nil
+}
@@ -0,0 +1,134 @@
+package src
+
+import "strings"
+
+// the subset of the SARIF 2.1.0 log format that tav diagnostics use
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+
+type SarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+type SarifRun struct {
+	Tool    SarifTool     `json:"tool"`
+	Results []SarifResult `json:"results"`
+	// columns count characters, sarif otherwise assumes utf-16 code units
+	ColumnKind string `json:"columnKind"`
+}
+
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"`
+}
+
+type SarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []SarifRule `json:"rules"`
+}
+
+// each error code is a rule, results refer to them by id
+type SarifRule struct {
+	Id               string       `json:"id"`
+	ShortDescription SarifMessage `json:"shortDescription"`
+	FullDescription  SarifMessage `json:"fullDescription"`
+}
+
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+type SarifResult struct {
+	RuleId           string          `json:"ruleId"`
+	Level            string          `json:"level"`
+	Message          SarifMessage    `json:"message"`
+	Locations        []SarifLocation `json:"locations"`
+	RelatedLocations []SarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type SarifLocation struct {
+	Id               int                   `json:"id,omitempty"`
+	PhysicalLocation SarifPhysicalLocation `json:"physicalLocation"`
+	Message          *SarifMessage         `json:"message,omitempty"`
+}
+
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"`
+	Region           SarifRegion           `json:"region"`
+}
+
+type SarifArtifactLocation struct {
+	Uri string `json:"uri"`
+}
+
+// sarif columns are 1 based and the end column is one past the last character
+type SarifRegion struct {
+	StartLine   uint32 `json:"startLine"`
+	StartColumn uint32 `json:"startColumn"`
+	EndLine     uint32 `json:"endLine"`
+	EndColumn   uint32 `json:"endColumn"`
+	ByteOffset  uint32 `json:"byteOffset"`
+	ByteLength  uint32 `json:"byteLength"`
+}
+
+func NewSarifLocation(file string, span Span) SarifLocation {
+	region := SarifRegion{
+		StartLine:   span.Start.Line,
+		StartColumn: span.Start.Indent,
+		EndLine:     span.End.Line,
+		EndColumn:   span.End.Indent + 1,
+		ByteOffset:  span.Start.Offset,
+	}
+	if span.End.Offset > span.Start.Offset {
+		region.ByteLength = span.End.Offset - span.Start.Offset
+	}
+	return SarifLocation{
+		PhysicalLocation: SarifPhysicalLocation{
+			ArtifactLocation: SarifArtifactLocation{Uri: file},
+			Region:           region,
+		},
+	}
+}
+
+// convert diagnostics into a sarif log with a single run
+func Sarif(diagnostics []*Diagnostic) *SarifLog {
+	run := SarifRun{
+		Tool:       SarifTool{Driver: SarifDriver{Name: "tavc", Rules: []SarifRule{}}},
+		Results:    []SarifResult{},
+		ColumnKind: "unicodeCodePoints",
+	}
+	rules := map[uint32]bool{}
+	for _, diagnostic := range diagnostics {
+		if info, ok := Errors[diagnostic.Code]; ok && !rules[diagnostic.Code] {
+			rules[diagnostic.Code] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, SarifRule{
+				Id:               CodeString(diagnostic.Code),
+				ShortDescription: SarifMessage{Text: info.Title},
+				FullDescription:  SarifMessage{Text: info.Explanation},
+			})
+		}
+		// sarif has no separate help, so it follows the message
+		message := diagnostic.Message
+		if len(diagnostic.Help) > 0 {
+			message += "\nhelp: " + strings.Join(diagnostic.Help, "\nhelp: ")
+		}
+		result := SarifResult{
+			RuleId:    CodeString(diagnostic.Code),
+			Level:     diagnostic.SeverityString(),
+			Message:   SarifMessage{Text: message},
+			Locations: []SarifLocation{NewSarifLocation(diagnostic.File, diagnostic.Primary())},
+		}
+		for i, label := range diagnostic.Labels[1:] {
+			related := NewSarifLocation(diagnostic.File, label.Span)
+			related.Id = i + 1
+			related.Message = &SarifMessage{Text: label.Message}
+			result.RelatedLocations = append(result.RelatedLocations, related)
+		}
+		run.Results = append(run.Results, result)
+	}
+	return &SarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []SarifRun{run},
+	}
+}
@@ -7,6 +7,14 @@ const (
 	ATTRIB_EXPOSED uint8 = 0x1 << 1
 	// the symbol is runnable at compile time (used for functions)
 	ATTRIB_DOABLE uint8 = 0x1 << 2
+
+	// what declared a symbol
+	SYMBOL_OTHER    uint8 = 0x0 // types, members and scopes
+	SYMBOL_VARIABLE uint8 = 0x1
+	SYMBOL_PARAM    uint8 = 0x2
+	SYMBOL_GLOBAL   uint8 = 0x3
+	SYMBOL_CONST    uint8 = 0x4
+	SYMBOL_FN       uint8 = 0x5
 )
 
 // a symbol is identified by a type and an attribute
@@ -14,13 +22,20 @@ type Symbol struct {
 	Identifier string
 	Type       TavType
 	Value      interface{} // used for value checks etc
+	Span       Span        // where the symbol was declared
+	Kind       uint8
+	Used       bool   // set by the resolver when the symbol is read
+	Id         uint32 // unique across the program, set by the resolver
+	Members    *Scope // the fields and methods of a struct or the variants of a union
+	// captured by a closure that can outlive the function, so the variable is stored on the heap
+	Heap bool
 }
 
 type Scope struct {
-	Identifier string
 	// Store a reference to the parent so we can look up scopes for variable declerations
 	Parent  *Scope
-	Symbols []*Symbol
+	Symbols []*Symbol // in the order they were declared
+	Names   map[string]*Symbol
 }
 
 // keep a record of symbol identifiers along with their type and attribute
@@ -36,23 +51,22 @@ func NewSym(Identifier string, Type TavType, Value interface{}) *Symbol {
 	}
 }
 
-func NewScope(parent *Scope, identifier string) *Scope {
+func NewScope(parent *Scope) *Scope {
 	return &Scope{
-		Identifier: identifier,
-		Parent:     parent,
-		Symbols:    nil,
+		Parent:  parent,
+		Symbols: nil,
+		Names:   make(map[string]*Symbol),
 	}
 }
 
 func (Scope *Scope) Add(symbol *Symbol) {
 	Scope.Symbols = append(Scope.Symbols, symbol)
+	Scope.Names[symbol.Identifier] = symbol
 }
 
 func (Scope *Scope) Get(identifier string) *Symbol {
-	for _, sym := range Scope.Symbols {
-		if sym.Identifier == identifier {
-			return sym
-		}
+	if sym, ok := Scope.Names[identifier]; ok {
+		return sym
 	}
 	if Scope.Parent != nil {
 		return Scope.Parent.Get(identifier)
@@ -61,18 +75,12 @@ func (Scope *Scope) Get(identifier string) *Symbol {
 }
 
 func NewSymTable() *SymTable {
-	return &SymTable{CurrentScope: NewScope(nil, "root")}
+	return &SymTable{CurrentScope: NewScope(nil)}
 }
 
 // enter a new scope in the symbol table
-func (SymTable *SymTable) NewScope(Identifier string) {
-	// create a new scope
-	newScope := NewScope(SymTable.CurrentScope, Identifier)
-	// add the scope to the current symbol table
-	newScopeSym := NewSym(Identifier, NewTavType(TYPE_SYM_TABLE, "", 0, nil), newScope)
-	SymTable.CurrentScope.Add(newScopeSym)
-	// update the current scope
-	SymTable.CurrentScope = newScope
+func (SymTable *SymTable) NewScope() {
+	SymTable.CurrentScope = NewScope(SymTable.CurrentScope)
 }
 
 // return from the scope in the symbol table
@@ -80,22 +88,55 @@ func (SymTable *SymTable) PopScope() {
 	SymTable.CurrentScope = SymTable.CurrentScope.Parent
 }
 
-// add a symbol to the table and retrieve the integer id
-func (SymTable *SymTable) Add(identifier string, tavType TavType, value interface{}) {
-	SymTable.CurrentScope.Add(NewSym(identifier, tavType, value))
+// the outermost scope, where the top level declerations are
+func (SymTable *SymTable) Global() *Scope {
+	scope := SymTable.CurrentScope
+	for scope.Parent != nil {
+		scope = scope.Parent
+	}
+	return scope
+}
+
+// add a symbol to the table and retrieve the symbol
+func (SymTable *SymTable) Add(identifier string, tavType TavType, value interface{}) *Symbol {
+	sym := NewSym(identifier, tavType, value)
+	SymTable.CurrentScope.Add(sym)
+	return sym
 }
 
 // get the symbol value given an id
 func (SymTable *SymTable) GetLocal(identifier string) *Symbol {
-	for _, sym := range SymTable.CurrentScope.Symbols {
-		if sym.Identifier == identifier {
-			return sym
-		}
-	}
-	return nil
+	return SymTable.CurrentScope.Names[identifier]
 }
 
 // get the symbol value given an id
 func (SymTable *SymTable) Get(identifier string) *Symbol {
 	return SymTable.CurrentScope.Get(identifier)
 }
+
+// get a member of a struct or union along with its index, the members are stored
+// in a scope on the symbol of the type. methods are members without an index
+func (SymTable *SymTable) Member(instance string, member string) (*Symbol, int) {
+	sym := SymTable.Get(instance)
+	if sym == nil || sym.Members == nil {
+		return nil, -1
+	}
+	for i, s := range sym.Fields() {
+		if s.Identifier == member {
+			return s, i
+		}
+	}
+	return sym.Members.Names[member], -1
+}
+
+// the fields of a struct or the variants of a union in the order they were declared
+func (sym *Symbol) Fields() []*Symbol {
+	var fields []*Symbol
+	for _, s := range sym.Members.Symbols {
+		// methods share the scope but aren't stored in the struct
+		if s.Kind != SYMBOL_FN {
+			fields = append(fields, s)
+		}
+	}
+	return fields
+}
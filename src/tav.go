@@ -1,9 +1,11 @@
 package src
 
 import (
+	"math"
+	"math/big"
 	"os"
-
-	"github.com/llir/llvm/ir/types"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -29,8 +31,35 @@ const (
 	TYPE_FN        uint32 = 0x10
 	TYPE_ANY       uint32 = 0x11
 	TYPE_NULL      uint32 = 0x12
+	TYPE_UNION     uint32 = 0x13 // tagged union, each variant carries a payload
+	TYPE_RUNE      uint32 = 0x14 // a unicode code point
+	TYPE_INTERFACE uint32 = 0x15 // a set of methods, any struct that has them can be used as one
+	TYPE_PARAM     uint32 = 0x16 // a type paramater of a generic function or struct e.g. $T
+)
+
+// the kind of a type at runtime, stored in its TypeInfo. each is declared as a constant e.g. KIND_STRUCT
+const (
+	KIND_VOID int64 = iota
+	KIND_BOOL
+	KIND_INT
+	KIND_UINT
+	KIND_FLOAT
+	KIND_RUNE
+	KIND_STRING
+	KIND_POINTER
+	KIND_ARRAY
+	KIND_FN
+	KIND_STRUCT
+	KIND_UNION
+	KIND_INTERFACE
+	KIND_ANY
 )
 
+var KindStrings = []string{
+	"KIND_VOID", "KIND_BOOL", "KIND_INT", "KIND_UINT", "KIND_FLOAT", "KIND_RUNE", "KIND_STRING", "KIND_POINTER",
+	"KIND_ARRAY", "KIND_FN", "KIND_STRUCT", "KIND_UNION", "KIND_INTERFACE", "KIND_ANY",
+}
+
 type File struct {
 	Filename string
 	Source   *string
@@ -39,7 +68,7 @@ type File struct {
 type TavValue struct {
 	Int    int64
 	Float  float64
-	String []byte
+	String []byte // for character literals, this stores the characters so the checker can validate them
 	Bool   bool
 	Any    interface{}
 }
@@ -49,6 +78,13 @@ type TavType struct {
 	Instance    string // store the identifier of the instance we are referencing
 	Indirection int8
 	RetType     *TavType // used for function calls
+	Length      uint64   // the number of elements if this is an array, otherwise 0
+	Size        AST      // the length of an array that names a constant e.g. N in [N]i32, nil once the resolver folds it
+	// the signature of a function type e.g. fn i32 (i32, i32)
+	Params   []TavType
+	Variadic bool
+	// the type arguments of an instance of a generic struct e.g. i32 in Box[i32], the instance is named after them
+	Args []TavType
 }
 
 func NewTavType(Typ uint32, Instance string, Indirection int8, RetType *TavType) TavType {
@@ -60,96 +96,177 @@ func NewTavType(Typ uint32, Instance string, Indirection int8, RetType *TavType)
 	}
 }
 
+// check if 2 types are the same, function types are the same if their signatures are
+func (TavType TavType) Equals(other TavType) bool {
+	if TavType.Type != other.Type || TavType.Instance != other.Instance || TavType.Indirection != other.Indirection ||
+		TavType.Length != other.Length || TavType.Variadic != other.Variadic || len(TavType.Params) != len(other.Params) {
+		return false
+	}
+	if (TavType.RetType == nil) != (other.RetType == nil) || (TavType.RetType != nil && !TavType.RetType.Equals(*other.RetType)) {
+		return false
+	}
+	for i, param := range TavType.Params {
+		if !param.Equals(other.Params[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (TavType TavType) IsInt() bool {
-	return TavType.Type == TYPE_I8 || TavType.Type == TYPE_I16 || TavType.Type == TYPE_I32 || TavType.Type == TYPE_I64
+	return TavType.Type == TYPE_I8 || TavType.Type == TYPE_I16 || TavType.Type == TYPE_I32 || TavType.Type == TYPE_I64 ||
+		TavType.IsUnsigned() || TavType.Type == TYPE_RUNE
+}
+
+func (TavType TavType) IsUnsigned() bool {
+	return TavType.Type == TYPE_U8 || TavType.Type == TYPE_U16 || TavType.Type == TYPE_U32 || TavType.Type == TYPE_U64
 }
 
 func (TavType TavType) IsFloat() bool {
 	return TavType.Type == TYPE_F32 || TavType.Type == TYPE_F64
 }
 
+// the number of bits in a number type, 0 for anything else
+func (TavType TavType) Bits() uint {
+	switch TavType.Type {
+	case TYPE_I8, TYPE_U8:
+		return 8
+	case TYPE_I16, TYPE_U16:
+		return 16
+	case TYPE_I32, TYPE_U32, TYPE_RUNE, TYPE_F32:
+		return 32
+	case TYPE_I64, TYPE_U64, TYPE_F64:
+		return 64
+	}
+	return 0
+}
+
+// check if a type is a plain number, not a pointer or an array of numbers
+func (TavType TavType) IsNumber() bool {
+	return (TavType.IsInt() || TavType.IsFloat()) && TavType.Indirection == 0 && TavType.Length == 0
+}
+
 type Compiler struct {
-	File *File
+	File    *File
+	Options *Options
+	Lines   []string // the source split into lines, used when rendering diagnostics
+	// diagnostics that are written at the end of compilation, used for sarif
+	Diagnostics []*Diagnostic
+	Allowed     []Allowed // lints silenced with #allow
+	Errors      int       // errors reported without stopping compilation e.g. denied lints
+	// the lints already reported, the instances of a generic function are checked once for each set of types
+	Linted map[string]bool
+	// the instances of generic declerations being resolved or checked, innermost last
+	Instances []*Note
 }
 
 // report an error, the compiler will decide what to do given the severity
-func (compiler *Compiler) Report(severity uint8, reporter *Reporter, errCode uint32, msg string) {
+func (compiler *Compiler) Report(severity uint8, reporter *Reporter, errCode uint32, msg string, notes ...Note) {
 	switch severity {
 	case WARNING:
-		compiler.Warning(reporter, errCode, msg)
+		compiler.Warning(reporter, errCode, msg, notes...)
 	case CRITICAL:
-		compiler.Critical(reporter, errCode, msg)
+		compiler.Critical(reporter, errCode, msg, notes...)
 	}
 }
 
 // report a warning to the compiler. the compiler will continue and this will not effect the output
-func (compiler *Compiler) Warning(reporter *Reporter, errCode uint32, msg string) {
-	Log("WARNING", "line", reporter.GetLine(), "pos", reporter.GetIndent(), "in", compiler.File.Filename, "\n")
-	Log(msg)
-	Log("\n")
+func (compiler *Compiler) Warning(reporter *Reporter, errCode uint32, msg string, notes ...Note) {
+	compiler.Emit(NewDiagnostic(WARNING, reporter, errCode, msg, append(notes, compiler.Made()...)))
 }
 
 // report a critical error to the compiler. the compiler will exit from this point as it cannot continue
-func (compiler *Compiler) Critical(reporter *Reporter, errCode uint32, msg string) {
-	Log("CRITICAL ERROR", reporter.GetLine(), ":", reporter.GetIndent(), "in", compiler.File.Filename, "\n")
-	Log(reporter.ReportLine())
-	Log(msg)
-	Log("\n")
+func (compiler *Compiler) Critical(reporter *Reporter, errCode uint32, msg string, notes ...Note) {
+	compiler.Emit(NewDiagnostic(CRITICAL, reporter, errCode, msg, append(notes, compiler.Made()...)))
+	compiler.Flush()
 	os.Exit(2)
 }
 
-func ConvertType(tavType TavType, SymTable *SymTable) types.Type {
-	switch tavType.Type {
-	case TYPE_BOOL:
-		if tavType.Indirection > 0 {
-			return types.I1Ptr
-		}
-		return types.I1
-	case TYPE_I8:
-		if tavType.Indirection > 0 {
-			return types.I8Ptr
-		}
-		return types.I8
-	case TYPE_I16:
-		if tavType.Indirection > 0 {
-			return types.I16Ptr
-		}
-		return types.I16
-	case TYPE_I32:
-		if tavType.Indirection > 0 {
-			return types.I32Ptr
-		}
-		return types.I32
-	case TYPE_I64:
-		if tavType.Indirection > 0 {
-			return types.I64Ptr
-		}
-		return types.I64
-	case TYPE_F32:
-		if tavType.Indirection > 0 {
-			// NOT SURE HOW THIS WORKS
+// errors inside an instance point into the generic decleration, so they say where each instance
+// being compiled was made, innermost first
+func (compiler *Compiler) Made() []Note {
+	var notes []Note
+	for i := len(compiler.Instances) - 1; i >= 0; i-- {
+		notes = append(notes, *compiler.Instances[i])
+	}
+	return notes
+}
+
+// start compiling an instance of a generic decleration, made is nil for anything else
+func (compiler *Compiler) Enter(made *Note) {
+	if made != nil {
+		compiler.Instances = append(compiler.Instances, made)
+	}
+}
+
+func (compiler *Compiler) Leave(made *Note) {
+	if made != nil {
+		compiler.Instances = compiler.Instances[:len(compiler.Instances)-1]
+	}
+}
+
+// returns true if the type uses a type paramater, so it only exists inside a generic decleration
+func (TavType TavType) IsGeneric() bool {
+	if TavType.Type == TYPE_PARAM || (TavType.RetType != nil && TavType.RetType.IsGeneric()) {
+		return true
+	}
+	for _, t := range TavType.Params {
+		if t.IsGeneric() {
+			return true
 		}
-		return types.Float
-	case TYPE_F64:
-		if tavType.Indirection > 0 {
-			// NOT SURE HOW THIS WORKS
+	}
+	for _, t := range TavType.Args {
+		if t.IsGeneric() {
+			return true
 		}
-		return types.Double
-	case TYPE_STRING:
-		return types.I8Ptr
-	case TYPE_INSTANCE:
-		v := SymTable.Get(tavType.Instance).Value
-		return v.(types.Type)
 	}
-	return types.Void
+	return false
 }
 
-func InvertPtrType(tavType TavType, direction int8) TavType {
-	return TavType{
-		Type:        tavType.Type,
-		Indirection: tavType.Indirection + direction,
-		RetType:     tavType.RetType,
+// get the type of the elements of an array, or what a pointer points to as pointers can be indexed too
+func ElemType(tavType TavType) TavType {
+	if tavType.Length == 0 {
+		tavType.Indirection--
+	}
+	tavType.Length = 0
+	return tavType
+}
+
+// returns true if the type is any, a value of any other type is boxed when it is used as one
+func (TavType TavType) IsAny() bool {
+	return TavType.Type == TYPE_ANY && TavType.Indirection == 0 && TavType.Length == 0
+}
+
+// the name of an instance of a generic decleration e.g. max[i32] or Pair[i32, *u8]
+func InstanceName(name string, args []TavType) string {
+	var strs []string
+	for _, arg := range args {
+		strs = append(strs, arg.String())
+	}
+	return name + "[" + strings.Join(strs, ", ") + "]"
+}
+
+// the name of the generic decleration an instance was made from e.g. Box for Box[i32]
+func GenericName(instance string) string {
+	if i := strings.IndexByte(instance, '['); i >= 0 {
+		return instance[:i]
 	}
+	return instance
+}
+
+// get the type of a function from its decleration, this is the type of the function used as a value
+func FnType(FnAST *FnAST) TavType {
+	t := NewTavType(TYPE_FN, "", 0, &FnAST.RetType)
+	for _, param := range FnAST.Params {
+		t.Params = append(t.Params, param.Type)
+	}
+	t.Variadic = FnAST.Variadic
+	return t
+}
+
+func InvertPtrType(tavType TavType, direction int8) TavType {
+	tavType.Indirection += direction
+	return tavType
 }
 
 // TODO some type of check as to whether the inference join was valid
@@ -159,6 +276,9 @@ func InvertPtrType(tavType TavType, direction int8) TavType {
 func InferType(expression AST, SymTable *SymTable) TavType {
 	switch e := expression.(type) {
 	case *VariableAST:
+		if e.Symbol != nil {
+			return e.Symbol.Type
+		}
 		t := SymTable.Get(e.Identifier.Lexme())
 		if t != nil {
 			return t.Type
@@ -181,37 +301,80 @@ func InferType(expression AST, SymTable *SymTable) TavType {
 		}
 	case *LiteralAST:
 		return e.Type
+	case *GroupAST:
+		return InferType(e.Group, SymTable)
 	case *ReturnAST:
 		return InferType(e.Value, SymTable)
 	case *BinaryAST:
+		switch e.Operator.Type {
+		case EQUALS, NOT_EQUALS, LESS_THAN, LESS_EQUAL, GREAT_THAN, GREAT_EQUAL, AND, OR:
+			return NewTavType(TYPE_BOOL, "", 0, nil)
+		}
+		// an untyped constant adopts the type of the other side
+		if IsUntyped(e.Left) && !IsUntyped(e.Right) {
+			return InferType(e.Right, SymTable)
+		}
 		return JoinInfered(InferType(e.Left, SymTable), InferType(e.Right, SymTable))
 	case *CallAST:
+		if union, ok := UnionCtor(e, SymTable); ok {
+			return NewTavType(TYPE_INSTANCE, union, 0, nil)
+		}
 		t := InferType(e.Caller, SymTable)
+		if e.Reference {
+			return t
+		}
 		return *t.RetType
 	case *StructGetAST:
-		// get the name of the struct that we are referencing
+		// get the name of the struct that we are referencing, then the type of the member
 		s := InferType(e.Struct, SymTable).Instance
-		// now we know that the struct stores its members in a symbol table entry called
-		// structname_members
-		structSymName := s + "_members"
-		// get the symbol table for the struct
-		sym := SymTable.Get(structSymName)
-		t := sym.Value.(*Scope)
-		if t != nil {
-			// get the structs member symbol table and access the member
-			// finally get the type of the member in that symtable
-			return t.Get(e.Member.Lexme()).Type
+		if member, _ := SymTable.Member(s, e.Member.Lexme()); member != nil {
+			return member.Type
 		}
 		break
+	case *IndexAST:
+		return ElemType(InferType(e.Array, SymTable))
+	case *StructLitAST:
+		t := NewTavType(TYPE_INSTANCE, e.Identifier.Lexme(), 0, nil)
+		t.Args = e.Args
+		return t
 	case *VarDefAST:
 		return e.Type
 	case *CastAST:
 		return e.TavType
+	case *TypeOfAST:
+		return NewTavType(TYPE_INSTANCE, "TypeInfo", 1, nil)
+	case *RunAST:
+		if e.Value != nil {
+			return e.Value.Type
+		}
+		return InferType(e.Expr, SymTable)
+	case *ClosureAST:
+		return FnType(e.Fn)
 	}
 	// this is unreachable (in theory)
 	return TavType{}
 }
 
+// check if a call constructs a union variant e.g. Shape.Circle(1.0), if so return the union identifier
+func UnionCtor(CallAST *CallAST, SymTable *SymTable) (string, bool) {
+	get, ok := CallAST.Caller.(*StructGetAST)
+	if !ok {
+		return "", false
+	}
+	union, ok := get.Struct.(*VariableAST)
+	if !ok {
+		return "", false
+	}
+	sym := union.Symbol
+	if sym == nil {
+		sym = SymTable.Get(union.Identifier.Lexme())
+	}
+	if sym == nil || sym.Type.Type != TYPE_UNION {
+		return "", false
+	}
+	return union.Identifier.Lexme(), true
+}
+
 // TODO some way to cast the type if they can be joined
 // join 2 infered types and figure out what the next type will be
 func JoinInfered(type1, type2 TavType) TavType {
@@ -257,19 +420,128 @@ func Compatible(t1, t2 TavType) bool {
 	return false
 }
 
-// cast an expression to a certian type
-// TODO actually check if the cast is valid, this is very hacky
-// TODO also this probably shouldn't modify the expression, it may lead to some errors in code gen
-// TODO also make this work with other variables
-// as this is called in the checker
+// cast an untyped constant expression to the type its context expects, e.g. the 10 in
+// x : u8 = 10; or y : f64 = 1 + 2; returns false if the expression can't adopt the type
 func Cast(tavType TavType, expression AST) bool {
-	//switch e:=expression.(type){
-	//case *LiteralAST:
-	//	if Compatible(tavType, e.Type){
-	//		e.Type = tavType
-	//
-	//		return true
-	//	}
-	//}
+	if !IsUntyped(expression) || tavType.Indirection != 0 || tavType.Length != 0 {
+		return false
+	}
+	switch e := expression.(type) {
+	case *LiteralAST:
+		switch {
+		case e.Type.IsInt() && tavType.IsInt():
+		case e.Type.IsFloat() && tavType.IsFloat():
+		case e.Type.IsInt() && tavType.IsFloat():
+			e.Value.Float, _ = new(big.Float).SetInt(e.Exact()).Float64()
+		case e.Type.IsFloat() && tavType.IsInt():
+			// only floats with no fractional part can become integers
+			if e.Value.Float != math.Trunc(e.Value.Float) {
+				return false
+			}
+			e.Value.Int = int64(e.Value.Float)
+		default:
+			return false
+		}
+		e.Type = tavType
+		e.Untyped = false
+		return true
+	case *GroupAST:
+		return Cast(tavType, e.Group)
+	case *UnaryAST:
+		return Cast(tavType, e.Right)
+	case *BinaryAST:
+		return Cast(tavType, e.Left) && Cast(tavType, e.Right)
+	}
 	return false
 }
+
+// check if converting a number type to another loses information
+func Narrows(from, to TavType) bool {
+	return (from.IsFloat() && to.IsInt()) || from.Bits() > to.Bits()
+}
+
+// check if an expression is made up only of untyped number literals
+func IsUntyped(expression AST) bool {
+	switch e := expression.(type) {
+	case *LiteralAST:
+		return e.Untyped
+	case *GroupAST:
+		return IsUntyped(e.Group)
+	case *UnaryAST:
+		return (e.Operator.Type == WIGGLE || e.Operator.Type == MINUS) && IsUntyped(e.Right)
+	case *BinaryAST:
+		switch e.Operator.Type {
+		case PLUS, MINUS, STAR, DIV, BIN_AND, BIN_OR, SLEFT, SRIGHT:
+			return IsUntyped(e.Left) && IsUntyped(e.Right)
+		}
+	}
+	return false
+}
+
+// check if a constant value fits in its type, an untyped integer is checked using its exact value
+func Fits(lit *LiteralAST) bool {
+	switch {
+	case lit.Untyped && lit.Type.IsInt():
+		if lit.Negative {
+			return !lit.Type.IsUnsigned() && lit.Magnitude <= uint64(1)<<(lit.Type.Bits()-1)
+		}
+		max := uint64(math.MaxUint64) >> (64 - lit.Type.Bits())
+		if !lit.Type.IsUnsigned() {
+			max >>= 1
+		}
+		return lit.Magnitude <= max
+	case lit.Type.Type == TYPE_U64:
+		// u64 values above the max i64 are stored wrapped around
+		return true
+	case lit.Type.IsUnsigned():
+		return lit.Value.Int >= 0 && lit.Value.Int < int64(1)<<lit.Type.Bits()
+	case lit.Type.IsInt():
+		n := lit.Type.Bits()
+		if n == 64 {
+			return true
+		}
+		return lit.Value.Int >= -(int64(1)<<(n-1)) && lit.Value.Int < int64(1)<<(n-1)
+	case lit.Type.Type == TYPE_F32:
+		return math.IsInf(lit.Value.Float, 0) || math.Abs(lit.Value.Float) <= math.MaxFloat32
+	}
+	return true
+}
+
+var TypeStrings = map[uint32]string{
+	TYPE_VOID: "void", TYPE_U8: "u8", TYPE_I8: "i8", TYPE_U16: "u16", TYPE_I16: "i16",
+	TYPE_U32: "u32", TYPE_I32: "i32", TYPE_F32: "f32", TYPE_U64: "u64", TYPE_I64: "i64",
+	TYPE_F64: "f64", TYPE_BOOL: "bool", TYPE_STRING: "string", TYPE_FN: "fn", TYPE_ANY: "any", TYPE_INTERFACE: "interface",
+	TYPE_NULL: "null", TYPE_RUNE: "rune",
+}
+
+// get the type as it would be written in source e.g. [4]*i32
+func (TavType TavType) String() string {
+	s := strings.Builder{}
+	if TavType.Length > 0 {
+		s.WriteString("[" + strconv.FormatUint(TavType.Length, 10) + "]")
+	}
+	for i := int8(0); i < TavType.Indirection; i++ {
+		s.WriteByte('*')
+	}
+	if TavType.Type == TYPE_PARAM {
+		s.WriteString("$" + TavType.Instance)
+	} else if TavType.Instance != "" {
+		s.WriteString(TavType.Instance)
+	} else if TavType.Type == TYPE_FN && TavType.RetType != nil {
+		s.WriteString("fn ")
+		if TavType.RetType.Type != TYPE_VOID {
+			s.WriteString(TavType.RetType.String() + " ")
+		}
+		var params []string
+		for _, param := range TavType.Params {
+			params = append(params, param.String())
+		}
+		if TavType.Variadic {
+			params = append(params, "...")
+		}
+		s.WriteString("(" + strings.Join(params, ", ") + ")")
+	} else {
+		s.WriteString(TypeStrings[TavType.Type])
+	}
+	return s.String()
+}
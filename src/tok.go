@@ -67,19 +67,29 @@ const (
 	SLEFT    uint32 = 0x3B
 	SRIGHT   uint32 = 0x3C
 	DEREF    uint32 = 0x3D
+	MATCH    uint32 = 0x3E
+
+	CONST_ASSIGN uint32 = 0x3F // ::
+	CLITERAL     uint32 = 0x40 // character literal e.g. 'a'
+	ALLOW        uint32 = 0x41 // #allow(lint)
+	UNINIT       uint32 = 0x42 // ---
+	POLY         uint32 = 0x43 // type paramater e.g. $T
+	TYPE_INFO    uint32 = 0x44 // #type_info(T)
+	FIELDS       uint32 = 0x45 // #for v.f : T {...}, a loop over the fields of a struct
 )
 
 var (
 	TokStrings = [...]string{"", "{", "}", "[", "]", "(", ")", ",", ".", ";", ":", "?", "*", "!", "?",
 		"&", "|", "~", "+", "-", "/", "=", ":=", "==", "!=", "<", ">", "<=", ">=", "..", "...", "identifier", "@", "type",
 		"null","true","false", "sliteral", "nliteral", "native","def", "run", "ifdef", "endif", "hide", "expose", "pack",
-		"import", "if", "elif", "else", "for", "switch", "case", "break", "continue", "return", "<<", ">>","->"}
+		"import", "if", "elif", "else", "for", "switch", "case", "break", "continue", "return", "<<", ">>","->", "match", "::", "cliteral", "allow", "---", "$", "type_info", "#for"}
 )
 
 type Token struct {
 	Position Position
 	Type  	 uint32
 	Value 	 interface{}
+	Span     Span // the range of source the token was lexed from
 }
 
 func (token *Token) Debug() {
@@ -1,36 +1,51 @@
 package src
 
 import (
-	"strings"
 	"unicode"
 )
 
-func LineInString(source string, line int) string {
-	lineCounter := 0
-	found := false
-	sb := strings.Builder{}
+// split source into lines, \r\n and a lone \r both end a line
+func SplitLines(source string) []string {
+	var lines []string
+	start := 0
 	for i := 0; i < len(source); i++ {
-		if !found && lineCounter == line {
-			found = true
-		}
 		if source[i] == '\n' || source[i] == '\r' {
-			// if we have reached the end of the current line
-			if found == true {
-				return sb.String()
+			lines = append(lines, source[start:i])
+			if source[i] == '\r' && i+1 < len(source) && source[i+1] == '\n' {
+				i++
 			}
-			lineCounter++
-		}
-		if found {
-			sb.WriteByte(source[i])
+			start = i + 1
 		}
 	}
-	return ""
+	return append(lines, source[start:])
+}
+
+// only ascii digits are used in number literals
+func IsNum(r rune) bool {
+	return r >= '0' && r <= '9'
 }
 
-func IsChar(r rune) bool {
-	return r != ' ' && unicode.IsLetter(r)
+// approximates unicode XID_Start, identifiers can also start with '_'
+func IsIdentStart(r rune) bool {
+	return r == '_' || unicode.In(r, unicode.L, unicode.Nl, unicode.Other_ID_Start)
 }
 
-func IsNum(r rune) bool {
-	return unicode.IsDigit(r)
-}
\ No newline at end of file
+// approximates unicode XID_Continue
+func IsIdentContinue(r rune) bool {
+	return IsIdentStart(r) || unicode.In(r, unicode.Mn, unicode.Mc, unicode.Nd, unicode.Pc, unicode.Other_ID_Continue)
+}
+
+func IsHex(r rune) bool {
+	return IsNum(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// get the value of a single hex digit
+func HexValue(r rune) uint32 {
+	switch {
+	case r >= 'a' && r <= 'f':
+		return uint32(r-'a') + 10
+	case r >= 'A' && r <= 'F':
+		return uint32(r-'A') + 10
+	}
+	return uint32(r - '0')
+}
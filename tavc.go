@@ -24,16 +24,34 @@ func NewFile(filename string) (*src.File, error) {
 
 func main() {
 	src.Log("tav v_a_0_1")
-	args := os.Args[1:]
+	options, args, err := src.ParseOptions(os.Args[1:])
+	if err != nil {
+		src.Log(err)
+		return
+	}
+	// show the write-up of an error code e.g. tavc explain T0001
+	if len(args) > 0 && args[0] == "explain" {
+		if len(args) < 2 {
+			src.Log("usage: tavc explain <code> e.g. tavc explain T0001")
+			return
+		}
+		code, ok := src.ParseCode(args[1])
+		if !ok {
+			src.Log("unknown error code " + args[1])
+			return
+		}
+		src.Log(src.Explain(code))
+		return
+	}
 	// read the file into a byte array
 	file, err := NewFile(args[1]+EXTENSION)
 	if err == nil {
 		// build to an executable
 		if args[0] == "build" {
-			program := src.AheadCompile(file)
+			program := src.AheadCompile(file, options)
 			src.BuildExe(args[1], program)
 		} else if args[0] == "run" {
-			src.JITCompile(file)
+			src.JITCompile(file, options)
 		}
 	} else {
 		src.Log(err)
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"tav/src"
+)
+
+// set when the test binary is run as the compiler, an error exits the process so each program is compiled in its own
+const COMPILE_ENV = "TAV_TEST_COMPILE"
+
+var (
+	// the header comment of a test says what it should do e.g. "builds and returns 3." or "fails with T0012.",
+	// a failure can also give the line and column the error points at e.g. "fails with T0012 at 4:15."
+	returns = regexp.MustCompile(`builds and returns (\d+)\.`)
+	fails   = regexp.MustCompile(`fails with (T\d{4})(?: at (\d+:\d+))?\.`)
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(COMPILE_ENV) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// build each program in tests/ and check it returns or fails as its header says
+func TestPrograms(t *testing.T) {
+	for _, tool := range []string{"llc", "gcc"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skip(tool + " is needed to build the tests")
+		}
+	}
+	files, err := filepath.Glob("tests/*" + EXTENSION)
+	if err != nil || len(files) == 0 {
+		t.Fatal("no tests found in tests/")
+	}
+	for _, file := range files {
+		file := file
+		t.Run(strings.TrimSuffix(filepath.Base(file), EXTENSION), func(t *testing.T) {
+			Program(t, file)
+		})
+	}
+}
+
+func Program(t *testing.T, file string) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, flags := Header(string(bytes))
+	name := strings.TrimSuffix(filepath.Base(file), EXTENSION)
+	dir, out, err := Compile(t, name, bytes, flags...)
+
+	if code := fails.FindStringSubmatch(header); code != nil {
+		if err == nil {
+			t.Fatalf("expected %s but it compiled\n%s", code[1], out)
+		}
+		at := strings.Index(string(out), "error["+code[1]+"]")
+		if at < 0 {
+			t.Fatalf("expected %s\n%s", code[1], out)
+		}
+		// the line after the message says where the error is
+		if lines := strings.SplitN(string(out[at:]), "\n", 3); code[2] != "" && (len(lines) < 2 || strings.TrimSpace(lines[1]) != "--> "+name+EXTENSION+":"+code[2]) {
+			t.Fatalf("expected %s at %s\n%s", code[1], code[2], out)
+		}
+		return
+	}
+	want := returns.FindStringSubmatch(header)
+	if want == nil {
+		t.Fatalf("the header of %s must say 'builds and returns N.' or 'fails with TXXXX.'", file)
+	}
+	if err != nil {
+		t.Fatalf("failed to compile: %v\n%s", err, out)
+	}
+	code := 0
+	if err := exec.Command(filepath.Join(dir, src.TAV_OUT, name+".exe")).Run(); err != nil {
+		exit, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatalf("failed to run: %v\n%s", err, out)
+		}
+		code = exit.ExitCode()
+	}
+	if strconv.Itoa(code) != want[1] {
+		t.Fatalf("expected it to return %s, returned %d", want[1], code)
+	}
+}
+
+// build a program in a directory of its own, so its output doesn't clash with the other tests
+func Compile(t *testing.T, name string, source []byte, flags ...string) (string, []byte, error) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, src.TAV_OUT), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name+EXTENSION), source, 0644); err != nil {
+		t.Fatal(err)
+	}
+	args := append(append([]string{"build", "--color=never"}, flags...), name)
+	compile := exec.Command(os.Args[0], args...)
+	compile.Dir = dir
+	compile.Env = append(os.Environ(), COMPILE_ENV+"=1")
+	out, err := compile.CombinedOutput()
+	return dir, out, err
+}
+
+// the end of a span in json is one past its last character, in characters, bytes and from the start of the file
+func TestJSONSpans(t *testing.T) {
+	source := "main : fn i32 {\n    y : i32 = \"hé\";\n    ret 0;\n}\n"
+	_, out, _ := Compile(t, "span", []byte(source), "--diagnostics=json")
+	for _, line := range strings.Split(string(out), "\n") {
+		var diagnostic src.JSONDiagnostic
+		if json.Unmarshal([]byte(line), &diagnostic) != nil || diagnostic.Code != "T0012" {
+			continue
+		}
+		start, end := diagnostic.Span.Start, diagnostic.Span.End
+		// "hé" is 4 characters and 5 bytes, starting at column 15 and byte 30 of the file
+		want := src.JSONPosition{Line: 2, Column: 19, Byte: 20, Offset: 35}
+		if start.Column != 15 || start.Byte != 15 || start.Offset != 30 || end != want {
+			t.Fatalf("expected the span of \"hé\" to end at %+v, got %+v to %+v", want, start, end)
+		}
+		if source[start.Offset:end.Offset] != "\"hé\"" {
+			t.Fatalf("expected the offsets to cover \"hé\", got %q", source[start.Offset:end.Offset])
+		}
+		return
+	}
+	t.Fatalf("expected T0012\n%s", out)
+}
+
+// the example of each error code in tavc explain must report that code
+func TestExplainExamples(t *testing.T) {
+	for code, info := range src.Errors {
+		if info.Example == "" {
+			continue
+		}
+		code, info := src.CodeString(code), info
+		t.Run(code, func(t *testing.T) {
+			_, out, _ := Compile(t, "example", []byte(info.Example))
+			if !strings.Contains(string(out), "["+code+"]") {
+				t.Fatalf("expected the example to report %s\n%s\n%s", code, info.Example, out)
+			}
+		})
+	}
+}
+
+// explain without a code says how to use it
+func TestExplainUsage(t *testing.T) {
+	explain := exec.Command(os.Args[0], "explain")
+	explain.Env = append(os.Environ(), COMPILE_ENV+"=1")
+	out, err := explain.CombinedOutput()
+	if err != nil || !strings.Contains(string(out), "usage: tavc explain") {
+		t.Fatalf("expected a usage message, got %v\n%s", err, out)
+	}
+}
+
+// sarif columns count characters, so a character outside the basic multilingual plane is one column
+func TestSarifColumns(t *testing.T) {
+	source := "main : fn i32 {\n    s := \"😀\"; y : i32 = \"a\";\n    ret 0;\n}\n"
+	_, out, _ := Compile(t, "sarif", []byte(source), "--diagnostics=sarif")
+	text := string(out)
+	var log src.SarifLog
+	if at := strings.Index(text, "{"); at < 0 || json.Unmarshal([]byte(text[at:]), &log) != nil {
+		t.Fatalf("expected a sarif log\n%s", out)
+	}
+	run := log.Runs[0]
+	if run.ColumnKind != "unicodeCodePoints" {
+		t.Fatalf("expected columnKind unicodeCodePoints, got %q", run.ColumnKind)
+	}
+	for _, result := range run.Results {
+		if result.RuleId != "T0012" {
+			continue
+		}
+		region := result.Locations[0].PhysicalLocation.Region
+		if region.StartLine != 2 || region.StartColumn != 25 || region.EndColumn != 28 {
+			t.Fatalf("expected \"a\" at 2:25 to 2:28, got %+v", region)
+		}
+		return
+	}
+	t.Fatalf("expected T0012\n%s", out)
+}
+
+// errors show the file, line and column, the lines of source with each label underlined and any help
+func TestRender(t *testing.T) {
+	source := "A : struct {\n    x : i32;\n    b : B;\n}\n\nB : struct {\n    a : A;\n}\n"
+	want := `error[T0045]: 'A' contains itself
+ --> render.tv:3:5
+  |
+1 | A : struct {
+  | - 'A' is declared here
+...
+3 |     b : B;
+  |     ^
+  = help: through A.b -> B.a -> A, use a pointer e.g. *A to refer to it
+`
+	for _, color := range []string{"never", "auto"} {
+		_, out, _ := Compile(t, "render", []byte(source), "--color="+color)
+		if got := Rendered(out); got != want {
+			t.Fatalf("--color=%s, expected\n%s\ngot\n%s", color, want, got)
+		}
+	}
+	// coloured output is the same once the escape codes are taken out
+	_, out, _ := Compile(t, "render", []byte(source), "--color=always")
+	got := Rendered(out)
+	if !strings.Contains(got, "\x1b[") {
+		t.Fatalf("--color=always, expected escape codes\n%s", got)
+	}
+	if plain := regexp.MustCompile("\x1b\\[[0-9;]*m").ReplaceAllString(got, ""); plain != want {
+		t.Fatalf("--color=always, expected\n%s\ngot\n%s", want, plain)
+	}
+}
+
+// the diagnostics in the output of the compiler, without what it logs before them
+func Rendered(out []byte) string {
+	text := string(out)
+	if at := strings.Index(text, "error["); at >= 0 {
+		text = text[at:]
+	}
+	return strings.TrimRight(text, "\n") + "\n"
+}
+
+// the comment at the top of a test joined into one line, and the compiler flags given by a "flags:" line in it
+func Header(source string) (string, []string) {
+	var lines, flags []string
+	for _, line := range strings.Split(source, "\n") {
+		if !strings.HasPrefix(line, "//") {
+			break
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "//"))
+		if strings.HasPrefix(line, "flags:") {
+			flags = append(flags, strings.Fields(strings.TrimPrefix(line, "flags:"))...)
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, " "), flags
+}